@@ -25,9 +25,14 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
-	"k8s.io/apimachinery/pkg/util/wait"
+	"github.com/go-logr/logr/funcr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/cloud-provider/app"
 	cloudcontrollerconfig "k8s.io/cloud-provider/app/config"
@@ -40,12 +45,24 @@ import (
 	"k8s.io/klog/v2"
 
 	_ "github.com/deckhouse/yandex-cloud-controller-manager/pkg/cloudprovider/yandex"
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/version"
 )
 
 const (
 	yandexCloudProviderName = "yandex"
+
+	// envLogFormat selects the log format, "text" (default) or "json"
+	envLogFormat = "YANDEX_CLOUD_LOG_FORMAT"
 )
 
+// cloud is the initialized cloud provider, it's drained on termination
+var cloud cloudprovider.Interface
+
+// shutdowner is implemented by cloud providers draining in-flight operations before the process exits
+type shutdowner interface {
+	Shutdown()
+}
+
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
@@ -60,9 +77,37 @@ func main() {
 	controllerInitializers := app.DefaultInitFuncConstructors
 	fss := cliflag.NamedFlagSets{}
 
-	command := app.NewCloudControllerManagerCommand(opts, cloudInitializer, controllerInitializers, fss, wait.NeverStop)
+	// stopCh only stops controllers without the leader election, with it they keep running until the process exits.
+	// Either way the cloud provider stops its own loops and rejects new operations on SIGTERM, draining in-flight ones.
+	stopCh := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		klog.InfoS("Received termination signal, shutting down", "signal", sig.String())
+		close(stopCh)
+	}()
+
+	command := app.NewCloudControllerManagerCommand(opts, cloudInitializer, controllerInitializers, fss, stopCh)
+
+	// the log format is applied after the flags are parsed to honor the requested verbosity
+	runE := command.RunE
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		if err := applyLogFormat(cmd.Flags(), os.Getenv(envLogFormat)); err != nil {
+			return err
+		}
 
-	if err := command.Execute(); err != nil {
+		info := version.Get()
+		klog.InfoS("Starting Yandex.Cloud CCM", "version", info.Version, "gitCommit", info.GitCommit, "buildDate", info.BuildDate, "goVersion", info.GoVersion)
+
+		return runE(cmd, args)
+	}
+
+	err = command.Execute()
+	if s, ok := cloud.(shutdowner); ok {
+		s.Shutdown()
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
@@ -77,7 +122,8 @@ func cloudInitializer(config *cloudcontrollerconfig.CompletedConfig) cloudprovid
 	}
 
 	// initialize cloud provider with the cloud provider name and config file provided
-	cloud, err := cloudprovider.InitCloudProvider(providerName, cloudConfig.CloudConfigFile)
+	var err error
+	cloud, err = cloudprovider.InitCloudProvider(providerName, cloudConfig.CloudConfigFile)
 	if err != nil {
 		klog.Fatalf("Cloud provider could not be initialized: %v", err)
 	}
@@ -95,3 +141,34 @@ func cloudInitializer(config *cloudcontrollerconfig.CompletedConfig) cloudprovid
 
 	return cloud
 }
+
+// applyLogFormat switches klog to the requested format. Structured calls (klog.InfoS, klog.ErrorS)
+// keep their key/value pairs as JSON fields, other messages are put into the "msg" field.
+func applyLogFormat(fs *pflag.FlagSet, format string) error {
+	switch format {
+	case "", "text":
+		return nil
+	case "json":
+	default:
+		return fmt.Errorf("unsupported %q env value %q, expected \"text\" or \"json\"", envLogFormat, format)
+	}
+
+	var verbosity int
+	if v := fs.Lookup("v"); v != nil {
+		var err error
+		verbosity, err = strconv.Atoi(v.Value.String())
+		if err != nil {
+			return fmt.Errorf("invalid verbosity %q: %v", v.Value.String(), err)
+		}
+	}
+
+	klog.SetLogger(funcr.NewJSON(func(obj string) {
+		fmt.Fprintln(os.Stderr, obj)
+	}, funcr.Options{
+		LogCaller:    funcr.All,
+		LogTimestamp: true,
+		Verbosity:    verbosity,
+	}))
+
+	return nil
+}
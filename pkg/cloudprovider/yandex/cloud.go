@@ -1,16 +1,34 @@
 package yandex
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	v1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	netutils "k8s.io/utils/net"
 
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/tracing"
 	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/yapi"
 
 	mapset "github.com/deckarep/golang-set"
@@ -27,21 +45,112 @@ import (
 )
 
 const (
-	providerName = "yandex"
-
-	envClusterName        = "YANDEX_CLUSTER_NAME"
-	envRouteTableID       = "YANDEX_CLOUD_ROUTE_TABLE_ID"
-	envServiceAccountJSON = "YANDEX_CLOUD_SERVICE_ACCOUNT_JSON"
-	envFolderID           = "YANDEX_CLOUD_FOLDER_ID"
-	envLbListenerSubnetID = "YANDEX_CLOUD_DEFAULT_LB_LISTENER_SUBNET_ID"
-	envLbTgNetworkID      = "YANDEX_CLOUD_DEFAULT_LB_TARGET_GROUP_NETWORK_ID"
-	envInternalNetworkIDs = "YANDEX_CLOUD_INTERNAL_NETWORK_IDS"
-	envExternalNetworkIDs = "YANDEX_CLOUD_EXTERNAL_NETWORK_IDS"
+	providerName         = "yandex"
+	eventSourceComponent = "yandex-cloud-controller-manager"
+
+	envClusterName         = "YANDEX_CLUSTER_NAME"
+	envStrictClusterLabels = "YANDEX_CLOUD_STRICT_CLUSTER_LABELS"
+	envRoutesEnabled       = "YANDEX_CLOUD_ROUTES_ENABLED"
+	envRouteTableID        = "YANDEX_CLOUD_ROUTE_TABLE_ID"
+	envRouteTablesByZone   = "YANDEX_CLOUD_ROUTE_TABLES_BY_ZONE"
+	envRouteLabelPrefix    = "YANDEX_CLOUD_ROUTE_LABEL_PREFIX"
+	envRouteAPILockTimeout = "YANDEX_CLOUD_ROUTE_API_LOCK_TIMEOUT"
+	envRouteGCInterval     = "YANDEX_CLOUD_ROUTE_GC_INTERVAL"
+	envRouteFamilies       = "YANDEX_CLOUD_ROUTE_ADDRESS_FAMILIES"
+	envRouteGCConcurrency  = "YANDEX_CLOUD_ROUTE_GC_CONCURRENCY"
+	envRouteResyncInterval = "YANDEX_CLOUD_ROUTE_RESYNC_INTERVAL"
+	envRouteTableMaxRoutes = "YANDEX_CLOUD_ROUTE_TABLE_MAX_ROUTES"
+	envRouteQuotaWarnRatio = "YANDEX_CLOUD_ROUTE_TABLE_QUOTA_WARNING_RATIO"
+	envLbConcurrency       = "YANDEX_CLOUD_LB_CONCURRENCY"
+	envNextHopAddressType  = "YANDEX_CLOUD_ROUTE_NEXT_HOP_ADDRESS_TYPE"
+	envNextHopSubnetCIDRs  = "YANDEX_CLOUD_ROUTE_NEXT_HOP_SUBNET_CIDRS"
+	envValidateNextHop     = "YANDEX_CLOUD_ROUTE_VALIDATE_NEXT_HOP"
+	envRouteManagedCIDRs   = "YANDEX_CLOUD_ROUTE_MANAGED_CIDRS"
+	envRouteReportForeign  = "YANDEX_CLOUD_ROUTE_REPORT_FOREIGN"
+	envRouteFailureLogWin  = "YANDEX_CLOUD_ROUTE_FAILURE_LOG_WINDOW"
+	envDefaultRouteNextHop = "YANDEX_CLOUD_ROUTE_DEFAULT_NEXT_HOP"
+	envDefaultRouteDest    = "YANDEX_CLOUD_ROUTE_DEFAULT_DESTINATION"
+	envServiceAccountJSON  = "YANDEX_CLOUD_SERVICE_ACCOUNT_JSON"
+	envMutationSAJSON      = "YANDEX_CLOUD_MUTATION_SERVICE_ACCOUNT_JSON"
+	envAuthMode            = "YANDEX_CLOUD_AUTH_MODE"
+	envOAuthToken          = "YANDEX_CLOUD_OAUTH_TOKEN"
+	envFolderID            = "YANDEX_CLOUD_FOLDER_ID"
+	envLbListenerSubnetID  = "YANDEX_CLOUD_DEFAULT_LB_LISTENER_SUBNET_ID"
+	envLbTgNetworkID       = "YANDEX_CLOUD_DEFAULT_LB_TARGET_GROUP_NETWORK_ID"
+	envLbNodeSelector      = "YANDEX_CLOUD_LB_NODE_SELECTOR"
+	envLbClass             = "YANDEX_CLOUD_LB_CLASS"
+	envLbClassNotDefault   = "YANDEX_CLOUD_LB_CLASS_NOT_DEFAULT"
+	envLbHCInterval        = "YANDEX_CLOUD_LB_HEALTH_CHECK_INTERVAL"
+	envLbHCTimeout         = "YANDEX_CLOUD_LB_HEALTH_CHECK_TIMEOUT"
+	envLbHCHealthy         = "YANDEX_CLOUD_LB_HEALTH_CHECK_HEALTHY_THRESHOLD"
+	envLbHCUnhealthy       = "YANDEX_CLOUD_LB_HEALTH_CHECK_UNHEALTHY_THRESHOLD"
+	envLbHCPort            = "YANDEX_CLOUD_LB_HEALTH_CHECK_PORT"
+	envLbHCProtocol        = "YANDEX_CLOUD_LB_HEALTH_CHECK_PROTOCOL"
+	envLbHCPath            = "YANDEX_CLOUD_LB_HEALTH_CHECK_PATH"
+	envInternalNetworkIDs  = "YANDEX_CLOUD_INTERNAL_NETWORK_IDS"
+	envExternalNetworkIDs  = "YANDEX_CLOUD_EXTERNAL_NETWORK_IDS"
+	envTaintPreemptible    = "YANDEX_CLOUD_TAINT_PREEMPTIBLE_NODES"
+	envNodeInstanceLabels  = "YANDEX_CLOUD_NODE_INSTANCE_LABELS"
+	envNodeLabelPrefix     = "YANDEX_CLOUD_NODE_INSTANCE_LABEL_PREFIX"
+	envPrimaryNetworkID    = "YANDEX_CLOUD_PRIMARY_NETWORK_ID"
+	envPrimarySubnetID     = "YANDEX_CLOUD_PRIMARY_SUBNET_ID"
+	envAPIEndpoint         = "YANDEX_CLOUD_API_ENDPOINT"
+	envAPICAFile           = "YANDEX_CLOUD_API_CA_FILE"
+	envAPIQPS              = "YANDEX_CLOUD_API_QPS"
+	envAPIBurst            = "YANDEX_CLOUD_API_BURST"
+	envAPIMaxRetries       = "YANDEX_CLOUD_API_MAX_RETRIES"
+	envAPIRetryBaseDelay   = "YANDEX_CLOUD_API_RETRY_BASE_DELAY"
+	envOperationTimeout    = "YANDEX_CLOUD_OPERATION_TIMEOUT"
+	envOperationPoll       = "YANDEX_CLOUD_OPERATION_POLL_INTERVAL"
+	envInstanceCacheTTL    = "YANDEX_CLOUD_INSTANCE_CACHE_TTL"
+	envInstanceNameStrip   = "YANDEX_CLOUD_INSTANCE_NAME_STRIP_SUFFIX"
+	envInstanceNameAppend  = "YANDEX_CLOUD_INSTANCE_NAME_APPEND_SUFFIX"
+	envInstanceNameRegexp  = "YANDEX_CLOUD_INSTANCE_NAME_REGEXP"
+	envInstanceNameRepl    = "YANDEX_CLOUD_INSTANCE_NAME_REPLACEMENT"
+	envHealthListenAddress = "YANDEX_CLOUD_HEALTH_LISTEN_ADDRESS"
+	envHealthCheckInterval = "YANDEX_CLOUD_HEALTH_CHECK_INTERVAL"
+	envShutdownGracePeriod = "YANDEX_CLOUD_SHUTDOWN_GRACE_PERIOD"
+	envInformerResync      = "YANDEX_CLOUD_INFORMER_RESYNC_PERIOD"
+	envTracingEndpoint     = "YANDEX_CLOUD_TRACING_OTLP_ENDPOINT"
+	envTracingInsecure     = "YANDEX_CLOUD_TRACING_OTLP_INSECURE"
+
+	authModeKeyFile  = "key-file"
+	authModeMetadata = "metadata"
+	authModeOAuth    = "oauth"
+
+	defaultAPIQPS   = 10
+	defaultAPIBurst = 20
+
+	defaultAPIMaxRetries     = 3
+	defaultAPIRetryBaseDelay = 200 * time.Millisecond
+
+	defaultOperationTimeout      = 10 * time.Minute
+	defaultOperationPollInterval = time.Second
+
+	defaultAPIHealthCheckInterval = 30 * time.Second
+
+	// routeTableValidationCallTimeout bounds a single attempt to get a RouteTable while validating them at startup
+	routeTableValidationCallTimeout = 10 * time.Second
+
+	defaultInformerResyncPeriod = 30 * time.Second
 )
 
+// routeTablesValidationTimeout bounds the startup validation of the RouteTables, so that a hung API call fails
+// the startup instead of blocking it. Every Get may be retried after the jittered backoff of the API options.
+func routeTablesValidationTimeout(routeTables int, opts yapi.APIOptions) time.Duration {
+	perRouteTable := routeTableValidationCallTimeout
+	for attempt := 0; attempt < opts.MaxRetries; attempt++ {
+		perRouteTable += routeTableValidationCallTimeout + 2*opts.RetryBaseDelay<<attempt
+	}
+
+	return time.Duration(routeTables) * perRouteTable
+}
+
 // CloudConfig includes all the necessary configuration for creating Cloud object
 type CloudConfig struct {
 	ClusterName string
+	// StrictClusterLabels makes the CCM ignore StaticRoutes and NLBs without the cluster name label
+	StrictClusterLabels bool
 
 	lbListenerSubnetID string
 	lbTgNetworkID      string
@@ -49,10 +158,91 @@ type CloudConfig struct {
 	LocalRegion        string
 	LocalZone          string
 	RouteTableID       string
+	RouteTablesByZone  map[string]string
+	RouteLabelPrefix   string
+	// RoutesEnabled set to false disables route management even if RouteTables are configured
+	RoutesEnabled bool
+
+	// LbNodeSelector restricts Nodes added to TargetGroups, nil selects all of them
+	LbNodeSelector labels.Selector
+	// LbClass is the Service LoadBalancerClass NLBs are provisioned for, Services of other classes are skipped.
+	// Services without a class are handled too, unless LbClassNotDefault is set.
+	LbClass           string
+	LbClassNotDefault bool
+	// lbHealthCheckDefaults are used for NLB health checks not overridden by Service annotations,
+	// unset ones fall back to the hardcoded defaults
+	lbHealthCheckDefaults healthCheckParameters
+	// LbConcurrency bounds the number of NLBs reconciled concurrently, reconciles of the same NLB are always serialized
+	LbConcurrency int
+
+	// PrimaryNetworkID and PrimarySubnetID select the network interface used as the route next hop on multi-NIC Nodes
+	PrimaryNetworkID string
+	PrimarySubnetID  string
+	// NextHopAddressType is the type of Node addresses used as route next hops, InternalIP or ExternalIP
+	NextHopAddressType corev1.NodeAddressType
+	// NextHopSubnetCIDRs restricts InternalIPs used as route next hops to these subnets, e.g. the management ones on
+	// multi-NIC Nodes. Empty means all.
+	NextHopSubnetCIDRs []*net.IPNet
+	// RouteValidateNextHop enables checking that next hops belong to the RouteTable's Network before adding routes
+	RouteValidateNextHop bool
+
+	RouteAPILockTimeout time.Duration
+	RouteGCInterval     time.Duration
+	// RouteGCConcurrency bounds the number of Nodes looked up in the API server concurrently during route GC
+	RouteGCConcurrency int
+	// RouteResyncInterval is how often routes of all Nodes are recomputed to correct drift, 0 disables resyncs
+	RouteResyncInterval time.Duration
+	// RouteTableMaxRoutes is the StaticRoutes quota of a RouteTable, RouteTables holding RouteQuotaWarningRatio of it
+	// are warned about. 0 disables warnings.
+	RouteTableMaxRoutes    int
+	RouteQuotaWarningRatio float64
+	// RouteAddressFamilies restricts PodCIDR families routes are managed for, "ipv4" and "ipv6". Empty means all.
+	RouteAddressFamilies []string
+	// RouteManagedCIDRs restricts route destinations to these supernets, other routes are left to other systems. Empty means all.
+	RouteManagedCIDRs []*net.IPNet
+	// RouteReportForeign makes ListRoutes and the routes dump report routes of Nodes not managed by this cluster
+	// as unmanaged. They are never modified.
+	RouteReportForeign bool
+	// RouteDefaultNextHop is the address, e.g. of a NAT Instance, the default route to RouteDefaultDestination
+	// is programmed to in all RouteTables. Empty disables the default route.
+	RouteDefaultNextHop     string
+	RouteDefaultDestination string
+	// RouteFailureLogWindow is how often the same route failure of a Node is logged, 0 logs every failure
+	RouteFailureLogWindow time.Duration
 
 	InternalNetworkIDsSet map[string]struct{}
 	ExternalNetworkIDsSet map[string]struct{}
 
+	TaintPreemptibleNodes bool
+
+	// NodeInstanceLabels are keys of Instance labels mirrored onto Nodes, prefixed with NodeInstanceLabelPrefix
+	NodeInstanceLabels      []string
+	NodeInstanceLabelPrefix string
+
+	// InstanceCacheTTL is how long Compute Instance lookups are cached, 0 disables caching
+	InstanceCacheTTL time.Duration
+	// nodeNameMapping converts Node names to the names of their Instances, identity by default
+	nodeNameMapping nodeNameMapping
+
+	APIOptions yapi.APIOptions
+
+	// HealthListenAddress is the address /healthz reflecting Yandex.Cloud API connectivity and debug endpoints
+	// are served on, empty disables them
+	HealthListenAddress string
+	HealthCheckInterval time.Duration
+
+	// ShutdownGracePeriod is how long in-flight route and NLB operations may take to complete on termination
+	ShutdownGracePeriod time.Duration
+
+	// InformerResyncPeriod is how often Service and Node informers redeliver cached objects, 0 disables resyncs
+	InformerResyncPeriod time.Duration
+
+	// TracingEndpoint is the OTLP gRPC collector spans of cloud operations are exported to, empty disables tracing
+	TracingEndpoint string
+	TracingInsecure bool
+
+	// AuthMode selects the source of Credentials: key-file, metadata or oauth
+	AuthMode    string
 	Credentials ycsdk.Credentials
 }
 
@@ -60,9 +250,32 @@ type CloudConfig struct {
 type Cloud struct {
 	yandexService         *yapi.YandexCloudAPI
 	nodeTargetGroupSyncer *NodeTargetGroupSyncer
-	config                CloudConfig
-
+	routeTables           map[string]*managedRouteTable
+	instanceCache         *instanceCache
+	// caches Subnet Networks of Node interfaces for route next hops, LB Targets and Node addresses
+	nodeAddresses *nodeAddressResolver
+	config        CloudConfig
+
+	// serializes reconciles of the same NLB, including ones shared by multiple Services, and bounds their concurrency
+	lbWorkers *lbWorkers
+	// tracks in-flight route and NLB operations to drain them on shutdown
+	drainer *operationDrainer
+	// serializes rebuilds of the cluster's source ranges SecurityGroups from rules of all Services
+	sourceRangesSGLock sync.Mutex
+	// deduplicates logs of route failures repeated every route controller reconciliation
+	routeFailureLogs *logThrottle
+	// flushes spans exported to TracingEndpoint, nil if tracing is disabled
+	tracingShutdown func(context.Context) error
+	// stops the health checker and the HTTP server, nil if HealthListenAddress is not set
+	stopHTTP chan struct{}
+	// stops the periodic loops started by Initialize once Shutdown is called
+	stopLoops chan struct{}
+
+	kubeClient kubernetes.Interface
 	nodeLister v1.NodeLister
+	// nodesSynced is closed once nodeLister is populated, route operations wait for it
+	nodesSynced   chan struct{}
+	eventRecorder record.EventRecorder
 }
 
 func init() {
@@ -74,12 +287,34 @@ func init() {
 				return nil, err
 			}
 
-			api, err := yapi.NewYandexCloudAPI(config.Credentials, config.LocalRegion, config.FolderID)
+			api, err := yapi.NewYandexCloudAPI(config.Credentials, config.LocalRegion, config.FolderID, config.APIOptions)
+			if err != nil {
+				return nil, err
+			}
+
+			cloud := NewCloud(*config, api)
+			ctx, cancel := context.WithTimeout(context.Background(), routeTablesValidationTimeout(len(cloud.routeTables), config.APIOptions))
+			err = cloud.validateRouteTables(ctx)
+			cancel()
 			if err != nil {
 				return nil, err
 			}
 
-			return NewCloud(*config, api), nil
+			if len(config.TracingEndpoint) > 0 {
+				cloud.tracingShutdown, err = tracing.Setup(context.Background(), config.TracingEndpoint, config.TracingInsecure)
+				if err != nil {
+					return nil, err
+				}
+				klog.InfoS("Exporting traces of cloud operations", "endpoint", config.TracingEndpoint)
+			}
+
+			// Initialize is only called once the leader lease is acquired, so that standby replicas pass their probes too
+			if len(config.HealthListenAddress) > 0 {
+				cloud.stopHTTP = make(chan struct{})
+				cloud.serveHTTP(cloud.stopHTTP)
+			}
+
+			return cloud, nil
 		})
 }
 
@@ -88,23 +323,30 @@ func NewCloudConfig() (*CloudConfig, error) {
 	cloudConfig := &CloudConfig{}
 	metadata := NewMetadataService()
 
-	// Retrieve Service Account Json
-	saJSON := os.Getenv(envServiceAccountJSON)
-	if saJSON == "" {
-		return nil, fmt.Errorf("environment variable %q is required", envServiceAccountJSON)
-	}
-	var iamKey iamkey.Key
-	err := json.Unmarshal([]byte(saJSON), &iamKey)
-	if err != nil {
-		return nil, errors.Wrap(err, "malformed service account json")
+	cloudConfig.AuthMode = os.Getenv(envAuthMode)
+	if len(cloudConfig.AuthMode) == 0 {
+		// keep using the Service Account key if it is provided, otherwise rely on the Instance's Service Account
+		if len(os.Getenv(envServiceAccountJSON)) > 0 {
+			cloudConfig.AuthMode = authModeKeyFile
+		} else {
+			cloudConfig.AuthMode = authModeMetadata
+		}
 	}
-	credentials, err := ycsdk.ServiceAccountKey(&iamKey)
+
+	credentials, err := getCredentials(cloudConfig.AuthMode)
 	if err != nil {
-		return nil, errors.Wrap(err, "invalid auth credentials")
+		return nil, err
 	}
 
 	cloudConfig.Credentials = credentials
 
+	if saJSON := os.Getenv(envMutationSAJSON); len(saJSON) > 0 {
+		cloudConfig.APIOptions.MutationCredentials, err = serviceAccountKeyCredentials(saJSON)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envMutationSAJSON)
+		}
+	}
+
 	// Retrieve FolderID
 	// firstly - try to find it in env. variables
 	folderID := os.Getenv(envFolderID)
@@ -123,8 +365,307 @@ func NewCloudConfig() (*CloudConfig, error) {
 		log.Fatalf("%q env is required", envClusterName)
 	}
 
+	if len(os.Getenv(envStrictClusterLabels)) > 0 {
+		cloudConfig.StrictClusterLabels, err = strconv.ParseBool(os.Getenv(envStrictClusterLabels))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envStrictClusterLabels)
+		}
+	}
+
+	cloudConfig.RoutesEnabled = true
+	if len(os.Getenv(envRoutesEnabled)) > 0 {
+		cloudConfig.RoutesEnabled, err = strconv.ParseBool(os.Getenv(envRoutesEnabled))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envRoutesEnabled)
+		}
+	}
+
 	cloudConfig.RouteTableID = os.Getenv(envRouteTableID)
 
+	cloudConfig.RouteTablesByZone = make(map[string]string)
+	if len(os.Getenv(envRouteTablesByZone)) > 0 {
+		for _, zoneRouteTable := range strings.Split(os.Getenv(envRouteTablesByZone), ",") {
+			zone, routeTableID, found := strings.Cut(zoneRouteTable, "=")
+			if !found || len(zone) == 0 || len(routeTableID) == 0 {
+				return nil, fmt.Errorf("malformed %q env, expected comma separated list of zone=RouteTableID pairs", envRouteTablesByZone)
+			}
+			cloudConfig.RouteTablesByZone[zone] = routeTableID
+		}
+	}
+
+	cloudConfig.RouteLabelPrefix = os.Getenv(envRouteLabelPrefix)
+	if len(cloudConfig.RouteLabelPrefix) == 0 {
+		cloudConfig.RouteLabelPrefix = defaultRouteLabelsPrefix
+	}
+
+	cloudConfig.PrimaryNetworkID = os.Getenv(envPrimaryNetworkID)
+	cloudConfig.PrimarySubnetID = os.Getenv(envPrimarySubnetID)
+
+	cloudConfig.NextHopAddressType = corev1.NodeInternalIP
+	if len(os.Getenv(envNextHopAddressType)) > 0 {
+		cloudConfig.NextHopAddressType = corev1.NodeAddressType(os.Getenv(envNextHopAddressType))
+		if cloudConfig.NextHopAddressType != corev1.NodeInternalIP && cloudConfig.NextHopAddressType != corev1.NodeExternalIP {
+			return nil, fmt.Errorf("unsupported %q env value %q, expected %q or %q", envNextHopAddressType,
+				cloudConfig.NextHopAddressType, corev1.NodeInternalIP, corev1.NodeExternalIP)
+		}
+	}
+
+	if len(os.Getenv(envValidateNextHop)) > 0 {
+		cloudConfig.RouteValidateNextHop, err = strconv.ParseBool(os.Getenv(envValidateNextHop))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envValidateNextHop)
+		}
+	}
+
+	if len(os.Getenv(envRouteReportForeign)) > 0 {
+		cloudConfig.RouteReportForeign, err = strconv.ParseBool(os.Getenv(envRouteReportForeign))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envRouteReportForeign)
+		}
+	}
+
+	cloudConfig.RouteAPILockTimeout, err = getDurationEnv(envRouteAPILockTimeout, defaultRouteAPILockTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	cloudConfig.RouteGCInterval, err = getDurationEnv(envRouteGCInterval, defaultRouteGCInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	cloudConfig.RouteResyncInterval, err = getDurationEnv(envRouteResyncInterval, defaultRouteResyncInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	cloudConfig.RouteFailureLogWindow, err = getDurationEnv(envRouteFailureLogWin, defaultRouteFailureLogWindow)
+	if err != nil {
+		return nil, err
+	}
+	if cloudConfig.RouteFailureLogWindow < 0 {
+		return nil, fmt.Errorf("%q env must not be negative", envRouteFailureLogWin)
+	}
+
+	if len(os.Getenv(envRouteTableMaxRoutes)) > 0 {
+		cloudConfig.RouteTableMaxRoutes, err = strconv.Atoi(os.Getenv(envRouteTableMaxRoutes))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envRouteTableMaxRoutes)
+		}
+		if cloudConfig.RouteTableMaxRoutes < 0 {
+			return nil, fmt.Errorf("%q env must not be negative", envRouteTableMaxRoutes)
+		}
+	}
+
+	cloudConfig.RouteQuotaWarningRatio = defaultRouteQuotaWarningRatio
+	if len(os.Getenv(envRouteQuotaWarnRatio)) > 0 {
+		cloudConfig.RouteQuotaWarningRatio, err = strconv.ParseFloat(os.Getenv(envRouteQuotaWarnRatio), 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envRouteQuotaWarnRatio)
+		}
+		if cloudConfig.RouteQuotaWarningRatio <= 0 || cloudConfig.RouteQuotaWarningRatio > 1 {
+			return nil, fmt.Errorf("%q env must be in the (0, 1] range", envRouteQuotaWarnRatio)
+		}
+	}
+
+	cloudConfig.LbConcurrency = defaultLbConcurrency
+	if len(os.Getenv(envLbConcurrency)) > 0 {
+		cloudConfig.LbConcurrency, err = strconv.Atoi(os.Getenv(envLbConcurrency))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envLbConcurrency)
+		}
+		if cloudConfig.LbConcurrency <= 0 {
+			return nil, fmt.Errorf("%q env must be positive", envLbConcurrency)
+		}
+	}
+
+	cloudConfig.RouteGCConcurrency = defaultRouteGCConcurrency
+	if len(os.Getenv(envRouteGCConcurrency)) > 0 {
+		cloudConfig.RouteGCConcurrency, err = strconv.Atoi(os.Getenv(envRouteGCConcurrency))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envRouteGCConcurrency)
+		}
+		if cloudConfig.RouteGCConcurrency <= 0 {
+			return nil, fmt.Errorf("%q env must be positive", envRouteGCConcurrency)
+		}
+	}
+
+	if len(os.Getenv(envRouteFamilies)) > 0 {
+		for _, family := range strings.Split(os.Getenv(envRouteFamilies), ",") {
+			family = strings.TrimSpace(family)
+			if family != "ipv4" && family != "ipv6" {
+				return nil, fmt.Errorf("unsupported address family %q in %q env, expected \"ipv4\" or \"ipv6\"", family, envRouteFamilies)
+			}
+			cloudConfig.RouteAddressFamilies = append(cloudConfig.RouteAddressFamilies, family)
+		}
+	}
+
+	if len(os.Getenv(envRouteManagedCIDRs)) > 0 {
+		cloudConfig.RouteManagedCIDRs, err = netutils.ParseCIDRs(strings.Split(os.Getenv(envRouteManagedCIDRs), ","))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envRouteManagedCIDRs)
+		}
+	}
+
+	if len(os.Getenv(envNextHopSubnetCIDRs)) > 0 {
+		cloudConfig.NextHopSubnetCIDRs, err = netutils.ParseCIDRs(strings.Split(os.Getenv(envNextHopSubnetCIDRs), ","))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envNextHopSubnetCIDRs)
+		}
+	}
+
+	if nextHop := os.Getenv(envDefaultRouteNextHop); len(nextHop) > 0 {
+		nextHopIP := netutils.ParseIPSloppy(nextHop)
+		if nextHopIP == nil {
+			return nil, fmt.Errorf("%q env must be an IP address, got %q", envDefaultRouteNextHop, nextHop)
+		}
+		destination := defaultRouteDestination
+		if nextHopIP.To4() == nil {
+			destination = defaultRouteDestinationIPv6
+		}
+		if value := os.Getenv(envDefaultRouteDest); len(value) > 0 {
+			_, destinationNet, err := netutils.ParseCIDRSloppy(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %q env", envDefaultRouteDest)
+			}
+			destination = destinationNet.String()
+		}
+		if ipFamilyOfCIDR(destination) != ipFamilyOfIP(nextHop) {
+			return nil, fmt.Errorf("%q env and %q env must be of the same address family", envDefaultRouteDest, envDefaultRouteNextHop)
+		}
+		// the default route is ensured by route resyncs
+		if cloudConfig.RouteResyncInterval <= 0 {
+			return nil, fmt.Errorf("%q env requires route resyncs, %q env must be positive", envDefaultRouteNextHop, envRouteResyncInterval)
+		}
+		cloudConfig.RouteDefaultNextHop = nextHopIP.String()
+		cloudConfig.RouteDefaultDestination = destination
+	} else if len(os.Getenv(envDefaultRouteDest)) > 0 {
+		return nil, fmt.Errorf("%q env is required when %q is set", envDefaultRouteNextHop, envDefaultRouteDest)
+	}
+
+	if len(os.Getenv(envTaintPreemptible)) > 0 {
+		cloudConfig.TaintPreemptibleNodes, err = strconv.ParseBool(os.Getenv(envTaintPreemptible))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envTaintPreemptible)
+		}
+	}
+
+	cloudConfig.NodeInstanceLabelPrefix = defaultNodeInstanceLabelPrefix
+	if value, ok := os.LookupEnv(envNodeLabelPrefix); ok {
+		cloudConfig.NodeInstanceLabelPrefix = value
+	}
+	if len(os.Getenv(envNodeInstanceLabels)) > 0 {
+		for _, key := range strings.Split(os.Getenv(envNodeInstanceLabels), ",") {
+			key = strings.TrimSpace(key)
+			if len(key) == 0 {
+				continue
+			}
+			if errs := validation.IsQualifiedName(cloudConfig.NodeInstanceLabelPrefix + key); len(errs) > 0 {
+				return nil, fmt.Errorf("%q env: invalid Node label key %q: %s", envNodeInstanceLabels, cloudConfig.NodeInstanceLabelPrefix+key, strings.Join(errs, "; "))
+			}
+			cloudConfig.NodeInstanceLabels = append(cloudConfig.NodeInstanceLabels, key)
+		}
+	}
+
+	cloudConfig.APIOptions.Endpoint = os.Getenv(envAPIEndpoint)
+
+	if caFile := os.Getenv(envAPICAFile); len(caFile) > 0 {
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %q env file", envAPICAFile)
+		}
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no PEM encoded certificates found in %q env file %q", envAPICAFile, caFile)
+		}
+		cloudConfig.APIOptions.TLSConfig = &tls.Config{RootCAs: certPool}
+	}
+
+	cloudConfig.APIOptions.QPS = defaultAPIQPS
+	if len(os.Getenv(envAPIQPS)) > 0 {
+		cloudConfig.APIOptions.QPS, err = strconv.ParseFloat(os.Getenv(envAPIQPS), 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envAPIQPS)
+		}
+	}
+
+	cloudConfig.APIOptions.Burst = defaultAPIBurst
+	if len(os.Getenv(envAPIBurst)) > 0 {
+		cloudConfig.APIOptions.Burst, err = strconv.Atoi(os.Getenv(envAPIBurst))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envAPIBurst)
+		}
+	}
+
+	cloudConfig.APIOptions.MaxRetries = defaultAPIMaxRetries
+	if len(os.Getenv(envAPIMaxRetries)) > 0 {
+		cloudConfig.APIOptions.MaxRetries, err = strconv.Atoi(os.Getenv(envAPIMaxRetries))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envAPIMaxRetries)
+		}
+	}
+
+	cloudConfig.APIOptions.RetryBaseDelay, err = getDurationEnv(envAPIRetryBaseDelay, defaultAPIRetryBaseDelay)
+	if err != nil {
+		return nil, err
+	}
+
+	cloudConfig.APIOptions.OperationTimeout, err = getDurationEnv(envOperationTimeout, defaultOperationTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	cloudConfig.APIOptions.OperationPollInterval, err = getDurationEnv(envOperationPoll, defaultOperationPollInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	cloudConfig.InstanceCacheTTL, err = getDurationEnv(envInstanceCacheTTL, defaultInstanceCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	if cloudConfig.InstanceCacheTTL < 0 {
+		return nil, fmt.Errorf("%q env must not be negative", envInstanceCacheTTL)
+	}
+
+	cloudConfig.nodeNameMapping, err = getNodeNameMappingEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	cloudConfig.HealthListenAddress = os.Getenv(envHealthListenAddress)
+	cloudConfig.HealthCheckInterval, err = getDurationEnv(envHealthCheckInterval, defaultAPIHealthCheckInterval)
+	if err != nil {
+		return nil, err
+	}
+	if cloudConfig.HealthCheckInterval <= 0 {
+		return nil, fmt.Errorf("%q env must be positive", envHealthCheckInterval)
+	}
+
+	cloudConfig.ShutdownGracePeriod, err = getDurationEnv(envShutdownGracePeriod, defaultShutdownGracePeriod)
+	if err != nil {
+		return nil, err
+	}
+	if cloudConfig.ShutdownGracePeriod < 0 {
+		return nil, fmt.Errorf("%q env must not be negative", envShutdownGracePeriod)
+	}
+
+	cloudConfig.InformerResyncPeriod, err = getDurationEnv(envInformerResync, defaultInformerResyncPeriod)
+	if err != nil {
+		return nil, err
+	}
+	if cloudConfig.InformerResyncPeriod < 0 {
+		return nil, fmt.Errorf("%q env must not be negative", envInformerResync)
+	}
+
+	cloudConfig.TracingEndpoint = os.Getenv(envTracingEndpoint)
+	if len(os.Getenv(envTracingInsecure)) > 0 {
+		cloudConfig.TracingInsecure, err = strconv.ParseBool(os.Getenv(envTracingInsecure))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envTracingInsecure)
+		}
+	}
+
 	cloudConfig.lbListenerSubnetID = os.Getenv(envLbListenerSubnetID)
 
 	cloudConfig.lbTgNetworkID = os.Getenv(envLbTgNetworkID)
@@ -132,6 +673,29 @@ func NewCloudConfig() (*CloudConfig, error) {
 		log.Fatalf("%q env is required", envLbTgNetworkID)
 	}
 
+	if len(os.Getenv(envLbNodeSelector)) > 0 {
+		cloudConfig.LbNodeSelector, err = labels.Parse(os.Getenv(envLbNodeSelector))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envLbNodeSelector)
+		}
+	}
+
+	cloudConfig.LbClass = os.Getenv(envLbClass)
+	if len(os.Getenv(envLbClassNotDefault)) > 0 {
+		cloudConfig.LbClassNotDefault, err = strconv.ParseBool(os.Getenv(envLbClassNotDefault))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q env", envLbClassNotDefault)
+		}
+	}
+	if cloudConfig.LbClassNotDefault && len(cloudConfig.LbClass) == 0 {
+		return nil, fmt.Errorf("%q env is required when %q is set", envLbClass, envLbClassNotDefault)
+	}
+
+	cloudConfig.lbHealthCheckDefaults, err = getHealthCheckDefaultsEnv()
+	if err != nil {
+		return nil, err
+	}
+
 	cloudConfig.InternalNetworkIDsSet = make(map[string]struct{})
 	cloudConfig.ExternalNetworkIDsSet = make(map[string]struct{})
 
@@ -158,19 +722,193 @@ func NewCloudConfig() (*CloudConfig, error) {
 	return cloudConfig, nil
 }
 
+// getCredentials builds the credentials used to authenticate Yandex.Cloud API calls.
+// The SDK exchanges them for IAM tokens and refreshes those before expiry on its own.
+func getCredentials(authMode string) (ycsdk.Credentials, error) {
+	switch authMode {
+	case authModeKeyFile:
+		saJSON := os.Getenv(envServiceAccountJSON)
+		if saJSON == "" {
+			return nil, fmt.Errorf("environment variable %q is required", envServiceAccountJSON)
+		}
+
+		return serviceAccountKeyCredentials(saJSON)
+	case authModeMetadata:
+		return ycsdk.InstanceServiceAccount(), nil
+	case authModeOAuth:
+		token := os.Getenv(envOAuthToken)
+		if token == "" {
+			return nil, fmt.Errorf("environment variable %q is required", envOAuthToken)
+		}
+
+		return ycsdk.OAuthToken(token), nil
+	default:
+		return nil, fmt.Errorf("unsupported %q env value %q, expected one of %q, %q or %q", envAuthMode, authMode, authModeKeyFile, authModeMetadata, authModeOAuth)
+	}
+}
+
+// serviceAccountKeyCredentials builds credentials of the Service Account the authorized key saJSON belongs to
+func serviceAccountKeyCredentials(saJSON string) (ycsdk.Credentials, error) {
+	var iamKey iamkey.Key
+	err := json.Unmarshal([]byte(saJSON), &iamKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed service account json")
+	}
+	credentials, err := ycsdk.ServiceAccountKey(&iamKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid auth credentials")
+	}
+
+	return credentials, nil
+}
+
+func getDurationEnv(name string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %q env", name)
+	}
+
+	return duration, nil
+}
+
+// getHealthCheckDefaultsEnv parses NLB health check defaults, validating them against the same limits as annotations
+func getHealthCheckDefaultsEnv() (hcParams healthCheckParameters, err error) {
+	for _, env := range []struct {
+		name  string
+		value *time.Duration
+		min   time.Duration
+		max   time.Duration
+	}{
+		{envLbHCInterval, &hcParams.interval, minHealthCheckInterval, maxHealthCheckInterval},
+		{envLbHCTimeout, &hcParams.timeout, minHealthCheckTimeout, maxHealthCheckTimeout},
+	} {
+		if *env.value, err = getDurationEnv(env.name, 0); err != nil {
+			return hcParams, err
+		}
+		if *env.value != 0 && (*env.value < env.min || *env.value > env.max) {
+			return hcParams, fmt.Errorf("%q env must be between %s and %s, got %s", env.name, env.min, env.max, *env.value)
+		}
+	}
+
+	for _, env := range []struct {
+		name  string
+		value *int64
+	}{
+		{envLbHCHealthy, &hcParams.healthyThreshold},
+		{envLbHCUnhealthy, &hcParams.unhealthyThreshold},
+	} {
+		if len(os.Getenv(env.name)) == 0 {
+			continue
+		}
+		if *env.value, err = strconv.ParseInt(os.Getenv(env.name), 10, 64); err != nil {
+			return hcParams, errors.Wrapf(err, "failed to parse %q env", env.name)
+		}
+		if *env.value < minHealthCheckThreshold || *env.value > maxHealthCheckThreshold {
+			return hcParams, fmt.Errorf("%q env must be between %d and %d, got %d", env.name, minHealthCheckThreshold, maxHealthCheckThreshold, *env.value)
+		}
+	}
+
+	if len(os.Getenv(envLbHCPort)) > 0 {
+		port, err := strconv.Atoi(os.Getenv(envLbHCPort))
+		if err != nil {
+			return hcParams, errors.Wrapf(err, "failed to parse %q env", envLbHCPort)
+		}
+		if port < 1 || port > 65535 {
+			return hcParams, fmt.Errorf("%q env must be a valid port, got %d", envLbHCPort, port)
+		}
+		hcParams.port = int32(port)
+	}
+
+	if value := os.Getenv(envLbHCPath); len(value) > 0 {
+		if !strings.HasPrefix(value, "/") {
+			return hcParams, fmt.Errorf("%q env must be an absolute path, got %q", envLbHCPath, value)
+		}
+		hcParams.path = value
+	}
+
+	switch value := strings.ToUpper(os.Getenv(envLbHCProtocol)); value {
+	case "":
+	case healthCheckProtocolHTTP, healthCheckProtocolTCP:
+		hcParams.protocol = value
+	default:
+		return hcParams, fmt.Errorf("unsupported %q env value %q, expected %q or %q", envLbHCProtocol, os.Getenv(envLbHCProtocol), healthCheckProtocolHTTP, healthCheckProtocolTCP)
+	}
+	if hcParams.protocol == healthCheckProtocolTCP && len(hcParams.path) > 0 {
+		return hcParams, fmt.Errorf("%q env can't be used with %q protocol", envLbHCPath, healthCheckProtocolTCP)
+	}
+
+	if withFallbacks := hcParams.withFallbacks(); withFallbacks.timeout >= withFallbacks.interval {
+		return hcParams, fmt.Errorf("health check timeout %s must be less than interval %s", withFallbacks.timeout, withFallbacks.interval)
+	}
+
+	return hcParams, nil
+}
+
+func getNodeNameMappingEnv() (nodeNameMapping, error) {
+	mapping := nodeNameMapping{
+		stripSuffix:  os.Getenv(envInstanceNameStrip),
+		appendSuffix: os.Getenv(envInstanceNameAppend),
+		replacement:  os.Getenv(envInstanceNameRepl),
+	}
+
+	if len(os.Getenv(envInstanceNameRegexp)) == 0 {
+		if len(mapping.replacement) > 0 {
+			return nodeNameMapping{}, fmt.Errorf("%q env is required when %q is set", envInstanceNameRegexp, envInstanceNameRepl)
+		}
+		return mapping, nil
+	}
+	if len(mapping.stripSuffix) > 0 || len(mapping.appendSuffix) > 0 {
+		return nodeNameMapping{}, fmt.Errorf("%q env can't be combined with %q and %q", envInstanceNameRegexp, envInstanceNameStrip, envInstanceNameAppend)
+	}
+
+	var err error
+	mapping.regexp, err = regexp.Compile(os.Getenv(envInstanceNameRegexp))
+	if err != nil {
+		return nodeNameMapping{}, errors.Wrapf(err, "failed to parse %q env", envInstanceNameRegexp)
+	}
+
+	return mapping, nil
+}
+
 // NewCloud creates a new instance of Cloud object
 func NewCloud(config CloudConfig, api *yapi.YandexCloudAPI) *Cloud {
-	return &Cloud{
-		yandexService: api,
-		config:        config,
+	yc := &Cloud{
+		yandexService:    api,
+		instanceCache:    newInstanceCache(config.InstanceCacheTTL),
+		nodeAddresses:    newNodeAddressResolver(),
+		lbWorkers:        newLBWorkers(config.LbConcurrency),
+		drainer:          newOperationDrainer(),
+		routeFailureLogs: newLogThrottle(config.RouteFailureLogWindow),
+		nodesSynced:      make(chan struct{}),
+		stopLoops:        make(chan struct{}),
+		config:           config,
+	}
+	// the route controller isn't started without RouteTables, see Routes
+	switch {
+	case !config.RoutesEnabled:
+		klog.InfoS("Route management is disabled, VPC RouteTables won't be touched", "env", envRoutesEnabled)
+	case len(config.RouteTableID) == 0 && len(config.RouteTablesByZone) == 0:
+		klog.InfoS("Route management is disabled, no RouteTables are configured", "env", envRouteTableID)
+	default:
+		yc.routeTables = yc.newManagedRouteTables()
 	}
+
+	registerMetrics()
+
+	return yc
 }
 
 // Initialize passes a Kubernetes clientBuilder interface to the cloud provider
 func (yc *Cloud) Initialize(clientBuilder cloudprovider.ControllerClientBuilder, stop <-chan struct{}) {
 	clientset := clientBuilder.ClientOrDie("cloud-controller-manager")
+	yc.kubeClient = clientset
 
-	informerFactory := informers.NewSharedInformerFactory(clientset, time.Second*30)
+	informerFactory := informers.NewSharedInformerFactory(clientset, yc.config.InformerResyncPeriod)
 	serviceInformer := informerFactory.Core().V1().Services()
 	nodeInformer := informerFactory.Core().V1().Nodes()
 
@@ -182,15 +920,46 @@ func (yc *Cloud) Initialize(clientBuilder cloudprovider.ControllerClientBuilder,
 
 	yc.nodeLister = nodeInformer.Lister()
 
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	yc.eventRecorder = eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventSourceComponent})
+
 	go serviceInformer.Informer().Run(stop)
 	go nodeInformer.Informer().Run(stop)
 
-	if !cache.WaitForCacheSync(stop, serviceInformer.Informer().HasSynced) {
+	// Nodes are waited for first, route operations blocked on nodesSynced may proceed before the other caches sync
+	if !cache.WaitForCacheSync(stop, nodeInformer.Informer().HasSynced) {
 		log.Fatal("Timed out waiting for caches to sync")
 	}
-	if !cache.WaitForCacheSync(stop, nodeInformer.Informer().HasSynced) {
+	klog.InfoS("Node informer cache synced", "resyncPeriod", yc.config.InformerResyncPeriod)
+	close(yc.nodesSynced)
+
+	if !cache.WaitForCacheSync(stop, serviceInformer.Informer().HasSynced) {
 		log.Fatal("Timed out waiting for caches to sync")
 	}
+
+	// with the leader election enabled stop is never closed on termination, so the loops are stopped by Shutdown
+	loopsStop := yc.stopOnShutdown(stop)
+
+	go wait.Until(func() {
+		yc.SyncNodeLabels(context.Background())
+	}, nodeLabelsSyncInterval, loopsStop)
+
+	if len(yc.routeTables) > 0 && yc.config.RouteGCInterval > 0 {
+		go wait.Until(func() {
+			if err := yc.GarbageCollectRoutes(context.Background()); err != nil {
+				klog.ErrorS(err, "Failed to garbage collect routes", "operation", "gc", "errorKind", yapi.ErrorKind(err))
+			}
+		}, yc.config.RouteGCInterval, loopsStop)
+	}
+
+	if len(yc.routeTables) > 0 && yc.config.RouteResyncInterval > 0 {
+		go wait.JitterUntil(func() {
+			if err := yc.ResyncRoutes(context.Background()); err != nil {
+				klog.ErrorS(err, "Failed to resync routes", "operation", "resync", "errorKind", yapi.ErrorKind(err))
+			}
+		}, yc.config.RouteResyncInterval, routeResyncJitter, true, loopsStop)
+	}
 }
 
 // LoadBalancer returns a balancer interface if supported.
@@ -213,9 +982,9 @@ func (yc *Cloud) Clusters() (cloudprovider.Clusters, bool) {
 	return nil, false
 }
 
-// Routes returns a routes interface if supported
+// Routes returns a routes interface if supported, i.e. route management is enabled and RouteTables are configured
 func (yc *Cloud) Routes() (cloudprovider.Routes, bool) {
-	if len(yc.config.RouteTableID) == 0 {
+	if len(yc.routeTables) == 0 {
 		return nil, false
 	}
 
@@ -233,7 +1002,6 @@ func (yc *Cloud) HasClusterID() bool {
 }
 
 // InstancesV2 returns a InstancesV2 interface if supported
-// TODO (zuzzas): implement once it's stable enough (starting in v0.20.0)
 func (yc *Cloud) InstancesV2() (cloudprovider.InstancesV2, bool) {
-	return nil, false
+	return yc, true
 }
@@ -0,0 +1,29 @@
+package yandex
+
+const (
+	clusterNameLabelName = "cluster-name"
+	// clusterNameLabel is put on NLBs and TargetGroups created by the CCM, StaticRoutes use the configured route label prefix
+	clusterNameLabel = defaultRouteLabelsPrefix + clusterNameLabelName
+)
+
+// clusterLabels returns the labels identifying cloud resources created by this cluster, merged with the extra ones
+func (yc *Cloud) clusterLabels(extra map[string]string) map[string]string {
+	labels := map[string]string{clusterNameLabel: yc.config.ClusterName}
+	for key, value := range extra {
+		labels[key] = value
+	}
+
+	return labels
+}
+
+// ownsResource reports whether a cloud resource with the labels may be managed by this cluster.
+// Resources labeled with another cluster's name are never touched. Unlabeled ones, e.g. created by older CCM versions,
+// are only adopted unless StrictClusterLabels is set.
+func (yc *Cloud) ownsResource(labels map[string]string) bool {
+	clusterName, ok := labels[clusterNameLabel]
+	if ok {
+		return clusterName == yc.config.ClusterName
+	}
+
+	return !yc.config.StrictClusterLabels
+}
@@ -0,0 +1,322 @@
+package yandex
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	//nolint:staticcheck // Ignore SA1019. Need to keep deprecated package for compatibility.
+	"github.com/golang/protobuf/proto"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/compute/v1"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/loadbalancer/v1"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/operation"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
+	ycsdkoperation "github.com/yandex-cloud/go-sdk/operation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/yapi"
+)
+
+// fakeRouteTableClient keeps RouteTables in memory, Update applies the StaticRoutes right away
+type fakeRouteTableClient struct {
+	mu          sync.Mutex
+	routeTables map[string]*vpc.RouteTable
+	updates     int
+	// updateFailures make the next Updates complete with these errors without applying the StaticRoutes
+	updateFailures []*status.Status
+}
+
+func newFakeRouteTableClient(routeTables ...*vpc.RouteTable) *fakeRouteTableClient {
+	c := &fakeRouteTableClient{routeTables: make(map[string]*vpc.RouteTable)}
+	for _, routeTable := range routeTables {
+		c.routeTables[routeTable.Id] = routeTable
+	}
+
+	return c
+}
+
+func (c *fakeRouteTableClient) Get(_ context.Context, in *vpc.GetRouteTableRequest, _ ...grpc.CallOption) (*vpc.RouteTable, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	routeTable, ok := c.routeTables[in.RouteTableId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "RouteTable %q not found", in.RouteTableId)
+	}
+
+	return proto.Clone(routeTable).(*vpc.RouteTable), nil
+}
+
+func (c *fakeRouteTableClient) Update(_ context.Context, in *vpc.UpdateRouteTableRequest, _ ...grpc.CallOption) (*operation.Operation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	routeTable, ok := c.routeTables[in.RouteTableId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "RouteTable %q not found", in.RouteTableId)
+	}
+	if len(c.updateFailures) > 0 {
+		st := c.updateFailures[0]
+		c.updateFailures = c.updateFailures[1:]
+		return &operation.Operation{Id: "op-update-" + in.RouteTableId, Done: true, Result: &operation.Operation_Error{Error: st.Proto()}}, nil
+	}
+	routeTable.StaticRoutes = in.StaticRoutes
+	c.updates++
+
+	return &operation.Operation{Id: "op-update-" + in.RouteTableId, Done: true}, nil
+}
+
+func (c *fakeRouteTableClient) staticRoutes(routeTableID string) []*vpc.StaticRoute {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.routeTables[routeTableID].StaticRoutes
+}
+
+// fakeComputeClient serves Instances from memory, filters by name are honored.
+// Network interface updates are applied right away.
+type fakeComputeClient struct {
+	yapi.ComputeClient
+	instances map[string]*compute.Instance
+}
+
+func (c *fakeComputeClient) Get(_ context.Context, in *compute.GetInstanceRequest, _ ...grpc.CallOption) (*compute.Instance, error) {
+	instance, ok := c.instances[in.InstanceId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Instance %q not found", in.InstanceId)
+	}
+
+	return instance, nil
+}
+
+func (c *fakeComputeClient) List(_ context.Context, in *compute.ListInstancesRequest, _ ...grpc.CallOption) (*compute.ListInstancesResponse, error) {
+	resp := &compute.ListInstancesResponse{}
+	for _, instance := range c.instances {
+		if len(in.Filter) == 0 || in.Filter == fmt.Sprintf("name = \"%s\"", instance.Name) {
+			resp.Instances = append(resp.Instances, instance)
+		}
+	}
+
+	return resp, nil
+}
+
+func (c *fakeComputeClient) UpdateNetworkInterface(_ context.Context, in *compute.UpdateInstanceNetworkInterfaceRequest, _ ...grpc.CallOption) (*operation.Operation, error) {
+	instance, ok := c.instances[in.InstanceId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Instance %q not found", in.InstanceId)
+	}
+	for _, iface := range instance.NetworkInterfaces {
+		if iface.Index == in.NetworkInterfaceIndex {
+			iface.SecurityGroupIds = in.SecurityGroupIds
+		}
+	}
+
+	return &operation.Operation{Done: true}, nil
+}
+
+// fakeNLBClient lists NetworkLoadBalancers from memory, filters by name are honored.
+// Mutating calls are applied right away and recorded by their method names.
+type fakeNLBClient struct {
+	yapi.NLBClient
+	loadBalancers []*loadbalancer.NetworkLoadBalancer
+	mutations     []string
+}
+
+func (c *fakeNLBClient) List(_ context.Context, in *loadbalancer.ListNetworkLoadBalancersRequest, _ ...grpc.CallOption) (*loadbalancer.ListNetworkLoadBalancersResponse, error) {
+	resp := &loadbalancer.ListNetworkLoadBalancersResponse{}
+	for _, lb := range c.loadBalancers {
+		if len(in.Filter) == 0 || in.Filter == fmt.Sprintf("name = \"%s\"", lb.Name) {
+			resp.NetworkLoadBalancers = append(resp.NetworkLoadBalancers, lb)
+		}
+	}
+
+	return resp, nil
+}
+
+func (c *fakeNLBClient) get(id string) (*loadbalancer.NetworkLoadBalancer, error) {
+	for _, lb := range c.loadBalancers {
+		if lb.Id == id {
+			return lb, nil
+		}
+	}
+
+	return nil, status.Errorf(codes.NotFound, "NetworkLoadBalancer %q not found", id)
+}
+
+func (c *fakeNLBClient) Update(_ context.Context, in *loadbalancer.UpdateNetworkLoadBalancerRequest, _ ...grpc.CallOption) (*operation.Operation, error) {
+	lb, err := c.get(in.NetworkLoadBalancerId)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range in.UpdateMask.GetPaths() {
+		switch path {
+		case "labels":
+			lb.Labels = in.Labels
+		case "attached_target_groups":
+			lb.AttachedTargetGroups = in.AttachedTargetGroups
+		}
+	}
+	c.mutations = append(c.mutations, "Update")
+
+	return &operation.Operation{Done: true}, nil
+}
+
+func (c *fakeNLBClient) AttachTargetGroup(_ context.Context, in *loadbalancer.AttachNetworkLoadBalancerTargetGroupRequest, _ ...grpc.CallOption) (*operation.Operation, error) {
+	lb, err := c.get(in.NetworkLoadBalancerId)
+	if err != nil {
+		return nil, err
+	}
+	lb.AttachedTargetGroups = append(lb.AttachedTargetGroups, in.AttachedTargetGroup)
+	c.mutations = append(c.mutations, "AttachTargetGroup")
+
+	return &operation.Operation{Done: true}, nil
+}
+
+func (c *fakeNLBClient) Delete(_ context.Context, in *loadbalancer.DeleteNetworkLoadBalancerRequest, _ ...grpc.CallOption) (*operation.Operation, error) {
+	for i, lb := range c.loadBalancers {
+		if lb.Id == in.NetworkLoadBalancerId {
+			c.loadBalancers = append(c.loadBalancers[:i], c.loadBalancers[i+1:]...)
+			c.mutations = append(c.mutations, "Delete")
+			return &operation.Operation{Done: true}, nil
+		}
+	}
+
+	return nil, status.Errorf(codes.NotFound, "NetworkLoadBalancer %q not found", in.NetworkLoadBalancerId)
+}
+
+// fakeTargetGroupClient serves TargetGroups from memory
+type fakeTargetGroupClient struct {
+	loadbalancer.TargetGroupServiceClient
+	targetGroups map[string]*loadbalancer.TargetGroup
+}
+
+func (c *fakeTargetGroupClient) Get(_ context.Context, in *loadbalancer.GetTargetGroupRequest, _ ...grpc.CallOption) (*loadbalancer.TargetGroup, error) {
+	tg, ok := c.targetGroups[in.TargetGroupId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "TargetGroup %q not found", in.TargetGroupId)
+	}
+
+	return tg, nil
+}
+
+func (c *fakeTargetGroupClient) List(_ context.Context, in *loadbalancer.ListTargetGroupsRequest, _ ...grpc.CallOption) (*loadbalancer.ListTargetGroupsResponse, error) {
+	resp := &loadbalancer.ListTargetGroupsResponse{}
+	for _, tg := range c.targetGroups {
+		if len(in.Filter) == 0 || in.Filter == fmt.Sprintf("name = \"%s\"", tg.Name) {
+			resp.TargetGroups = append(resp.TargetGroups, tg)
+		}
+	}
+
+	return resp, nil
+}
+
+// fakeSecurityGroupClient lists SecurityGroups from memory, filters by name are honored, and counts Lists.
+// Rule updates are recorded, deletions are applied right away.
+type fakeSecurityGroupClient struct {
+	vpc.SecurityGroupServiceClient
+	securityGroups []*vpc.SecurityGroup
+	lists          int
+	ruleUpdates    []*vpc.UpdateSecurityGroupRulesRequest
+}
+
+func (c *fakeSecurityGroupClient) List(_ context.Context, in *vpc.ListSecurityGroupsRequest, _ ...grpc.CallOption) (*vpc.ListSecurityGroupsResponse, error) {
+	c.lists++
+	resp := &vpc.ListSecurityGroupsResponse{}
+	for _, sg := range c.securityGroups {
+		if len(in.Filter) == 0 || in.Filter == fmt.Sprintf("name = \"%s\"", sg.Name) {
+			resp.SecurityGroups = append(resp.SecurityGroups, sg)
+		}
+	}
+
+	return resp, nil
+}
+
+func (c *fakeSecurityGroupClient) UpdateRules(_ context.Context, in *vpc.UpdateSecurityGroupRulesRequest, _ ...grpc.CallOption) (*operation.Operation, error) {
+	c.ruleUpdates = append(c.ruleUpdates, in)
+	return &operation.Operation{Done: true}, nil
+}
+
+func (c *fakeSecurityGroupClient) Delete(_ context.Context, in *vpc.DeleteSecurityGroupRequest, _ ...grpc.CallOption) (*operation.Operation, error) {
+	for i, sg := range c.securityGroups {
+		if sg.Id == in.SecurityGroupId {
+			c.securityGroups = append(c.securityGroups[:i], c.securityGroups[i+1:]...)
+			return &operation.Operation{Done: true}, nil
+		}
+	}
+
+	return nil, status.Errorf(codes.NotFound, "SecurityGroup %q not found", in.SecurityGroupId)
+}
+
+// fakeSubnetClient serves Subnets from memory and counts Gets
+type fakeSubnetClient struct {
+	vpc.SubnetServiceClient
+	subnets map[string]*vpc.Subnet
+
+	mu   sync.Mutex
+	gets int
+}
+
+func (c *fakeSubnetClient) Get(_ context.Context, in *vpc.GetSubnetRequest, _ ...grpc.CallOption) (*vpc.Subnet, error) {
+	c.mu.Lock()
+	c.gets++
+	c.mu.Unlock()
+
+	subnet, ok := c.subnets[in.SubnetId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Subnet %q not found", in.SubnetId)
+	}
+
+	return subnet, nil
+}
+
+// fakeOperationWaiter treats operations returned by fakes as completed, the ones completed with an error fail
+// like they do with the real OperationWaiter
+func fakeOperationWaiter(_ context.Context, origFunc func() (*operation.Operation, error)) (proto.Message, *ycsdkoperation.Operation, error) {
+	op, err := origFunc()
+	if err != nil {
+		return nil, nil, err
+	}
+	if op.GetError() != nil {
+		return nil, nil, yapi.WrapError(&yapi.OperationError{OperationID: op.Id, Status: status.FromProto(op.GetError())})
+	}
+
+	return nil, nil, nil
+}
+
+// newFakeRouteCloud creates a Cloud managing routes in routeTableID of rtClient for the Nodes
+func newFakeRouteCloud(routeTableID string, rtClient yapi.RouteTableClient, computeClient yapi.ComputeClient, nodes ...*v1.Node) *Cloud {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, node := range nodes {
+		_ = indexer.Add(node)
+	}
+
+	cloudCtx := &yapi.CloudContext{OperationWaiter: fakeOperationWaiter}
+	yc := &Cloud{
+		yandexService: &yapi.YandexCloudAPI{
+			VPCSvc:     yapi.NewVPCService(nil, nil, rtClient, nil, cloudCtx),
+			ComputeSvc: yapi.NewComputeService(computeClient, nil, cloudCtx),
+
+			OperationWaiter: fakeOperationWaiter,
+		},
+		instanceCache: newInstanceCache(0),
+		nodeAddresses: newNodeAddressResolver(),
+		nodeLister:    corev1listers.NewNodeLister(indexer),
+		config: CloudConfig{
+			RouteTableID:       routeTableID,
+			RouteLabelPrefix:   defaultRouteLabelsPrefix,
+			RouteGCConcurrency: 1,
+		},
+	}
+	yc.routeTables = yc.newManagedRouteTables()
+	// there are no concurrent callers to batch in tests
+	for _, rt := range yc.routeTables {
+		rt.batcher.delay = 0
+	}
+
+	return yc
+}
@@ -0,0 +1,111 @@
+package yandex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/version"
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/yapi"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// apiHealthStaleIntervals is the number of check intervals without a successful API call after which
+// the CCM is reported unhealthy, so that a single transient failure does not restart it
+const apiHealthStaleIntervals = 3
+
+// apiHealthChecker periodically pings the Yandex.Cloud API and serves the result on /healthz
+type apiHealthChecker struct {
+	ping     func(ctx context.Context) error
+	interval time.Duration
+	now      func() time.Time
+
+	mu          sync.RWMutex
+	lastSuccess time.Time
+	lastErr     error
+}
+
+func newAPIHealthChecker(ping func(ctx context.Context) error, interval time.Duration) *apiHealthChecker {
+	return &apiHealthChecker{
+		ping:     ping,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+func (hc *apiHealthChecker) run(stop <-chan struct{}) {
+	wait.Until(hc.check, hc.interval, stop)
+}
+
+func (hc *apiHealthChecker) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), hc.interval)
+	defer cancel()
+
+	err := hc.ping(ctx)
+	if err != nil {
+		klog.ErrorS(err, "Yandex.Cloud API health check failed", "errorKind", yapi.ErrorKind(err))
+	}
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	hc.lastErr = err
+	if err == nil {
+		hc.lastSuccess = hc.now()
+	}
+}
+
+func (hc *apiHealthChecker) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	hc.mu.RLock()
+	lastSuccess, lastErr := hc.lastSuccess, hc.lastErr
+	hc.mu.RUnlock()
+
+	if lastSuccess.IsZero() || hc.now().Sub(lastSuccess) > apiHealthStaleIntervals*hc.interval {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if lastSuccess.IsZero() {
+			fmt.Fprintf(w, "Yandex.Cloud API is unreachable: no successful calls yet, last error: %v\n", lastErr)
+		} else {
+			fmt.Fprintf(w, "Yandex.Cloud API is unreachable: last success at %s, last error: %v\n", lastSuccess.Format(time.RFC3339), lastErr)
+		}
+		return
+	}
+
+	fmt.Fprintf(w, "ok: last success at %s\n", lastSuccess.Format(time.RFC3339))
+}
+
+// serveHTTP starts the health checker and the HTTP server with /healthz and debug endpoints regardless of
+// the leader election, they are stopped once stop is closed
+func (yc *Cloud) serveHTTP(stop <-chan struct{}) {
+	hc := newAPIHealthChecker(yc.yandexService.VPCSvc.Ping, yc.config.HealthCheckInterval)
+	go hc.run(stop)
+
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", hc)
+	mux.HandleFunc("/version", serveVersion)
+	if len(yc.routeTables) > 0 {
+		mux.HandleFunc("/debug/routes", yc.serveRouteDump)
+	}
+	server := &http.Server{Addr: yc.config.HealthListenAddress, Handler: mux}
+
+	go func() {
+		<-stop
+		_ = server.Close()
+	}()
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			klog.Fatalf("Failed to serve HTTP endpoints on %q: %v", yc.config.HealthListenAddress, err)
+		}
+	}()
+}
+
+// serveVersion writes the build information of the CCM as JSON
+func serveVersion(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(version.Get()); err != nil {
+		klog.ErrorS(err, "Failed to write version")
+	}
+}
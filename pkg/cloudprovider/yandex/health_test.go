@@ -0,0 +1,61 @@
+package yandex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/version"
+)
+
+func TestAPIHealthChecker(t *testing.T) {
+	var pingErr error
+	now := time.Now()
+	hc := newAPIHealthChecker(func(context.Context) error { return pingErr }, time.Minute)
+	hc.now = func() time.Time { return now }
+
+	status := func() int {
+		rec := httptest.NewRecorder()
+		hc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return rec.Code
+	}
+
+	if code := status(); code != http.StatusServiceUnavailable {
+		t.Errorf("should be unhealthy before the first check, got %d", code)
+	}
+
+	hc.check()
+	if code := status(); code != http.StatusOK {
+		t.Errorf("should be healthy after a successful check, got %d", code)
+	}
+
+	pingErr = errors.New("connection refused")
+	now = now.Add(2 * time.Minute)
+	hc.check()
+	if code := status(); code != http.StatusOK {
+		t.Errorf("should tolerate failures for less than %d intervals, got %d", apiHealthStaleIntervals, code)
+	}
+
+	now = now.Add(2 * time.Minute)
+	hc.check()
+	if code := status(); code != http.StatusServiceUnavailable {
+		t.Errorf("should be unhealthy after %d intervals without success, got %d", apiHealthStaleIntervals, code)
+	}
+}
+
+func TestServeVersion(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	serveVersion(recorder, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	var info version.Info
+	if err := json.Unmarshal(recorder.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info != version.Get() {
+		t.Errorf("unexpected version info %+v", info)
+	}
+}
@@ -0,0 +1,133 @@
+package yandex
+
+import (
+	"sync"
+	"time"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/compute/v1"
+)
+
+// defaultInstanceCacheTTL is how long an Instance fetched from Compute is reused by subsequent lookups
+const defaultInstanceCacheTTL = time.Minute
+
+const (
+	instanceCacheByID   = "id"
+	instanceCacheByName = "name"
+)
+
+// instanceCache holds recently fetched Instances keyed by their IDs, along with the Instance name to ID mapping,
+// so that lookups by Node name don't have to list Instances either. It is shared by the instances and zones code paths.
+type instanceCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	instances map[string]instanceCacheEntry
+	names     map[string]instanceNameCacheEntry
+}
+
+type instanceCacheEntry struct {
+	instance  *compute.Instance
+	expiresAt time.Time
+}
+
+type instanceNameCacheEntry struct {
+	instanceID string
+	expiresAt  time.Time
+}
+
+// newInstanceCache creates an instanceCache, zero ttl disables caching
+func newInstanceCache(ttl time.Duration) *instanceCache {
+	return &instanceCache{
+		ttl:       ttl,
+		now:       time.Now,
+		instances: make(map[string]instanceCacheEntry),
+		names:     make(map[string]instanceNameCacheEntry),
+	}
+}
+
+func (c *instanceCache) Get(instanceID string) *compute.Instance {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	instance := c.get(instanceID)
+	observeInstanceCacheLookup(instanceCacheByID, instance != nil)
+
+	return instance
+}
+
+// GetByName returns the cached Instance named instanceName, provided both the name mapping and the Instance are fresh
+func (c *instanceCache) GetByName(instanceName string) *compute.Instance {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var instance *compute.Instance
+	if entry, ok := c.names[instanceName]; ok {
+		if c.now().After(entry.expiresAt) {
+			delete(c.names, instanceName)
+		} else {
+			instance = c.get(entry.instanceID)
+		}
+	}
+	observeInstanceCacheLookup(instanceCacheByName, instance != nil)
+
+	return instance
+}
+
+func (c *instanceCache) get(instanceID string) *compute.Instance {
+	entry, ok := c.instances[instanceID]
+	if !ok {
+		return nil
+	}
+	if c.now().After(entry.expiresAt) {
+		delete(c.instances, instanceID)
+		return nil
+	}
+
+	return entry.instance
+}
+
+func (c *instanceCache) Set(instance *compute.Instance) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.now().Add(c.ttl)
+	c.instances[instance.Id] = instanceCacheEntry{
+		instance:  instance,
+		expiresAt: expiresAt,
+	}
+	if len(instance.Name) != 0 {
+		c.names[instance.Name] = instanceNameCacheEntry{
+			instanceID: instance.Id,
+			expiresAt:  expiresAt,
+		}
+	}
+}
+
+// Delete drops the Instance with instanceID and the name mappings pointing to it
+func (c *instanceCache) Delete(instanceID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.instances, instanceID)
+	for name, entry := range c.names {
+		if entry.instanceID == instanceID {
+			delete(c.names, name)
+		}
+	}
+}
+
+// DeleteByName drops the name mapping for instanceName and the Instance it points to
+func (c *instanceCache) DeleteByName(instanceName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.names[instanceName]; ok {
+		delete(c.instances, entry.instanceID)
+		delete(c.names, instanceName)
+	}
+}
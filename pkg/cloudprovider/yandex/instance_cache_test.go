@@ -0,0 +1,52 @@
+package yandex
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/compute/v1"
+)
+
+func TestInstanceCache(t *testing.T) {
+	now := time.Now()
+	c := newInstanceCache(time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Set(&compute.Instance{Id: "fhm1", Name: "node-1"})
+	c.Set(&compute.Instance{Id: "fhm2", Name: "node-2"})
+
+	if instance := c.Get("fhm1"); instance == nil || instance.Name != "node-1" {
+		t.Errorf("expected fhm1 to be cached, got %v", instance)
+	}
+	if instance := c.GetByName("node-2"); instance == nil || instance.Id != "fhm2" {
+		t.Errorf("expected node-2 to be cached, got %v", instance)
+	}
+	if instance := c.GetByName("node-3"); instance != nil {
+		t.Errorf("expected node-3 to be missing, got %v", instance)
+	}
+
+	c.Delete("fhm1")
+	if instance := c.GetByName("node-1"); instance != nil {
+		t.Errorf("expected node-1 to be invalidated, got %v", instance)
+	}
+
+	c.DeleteByName("node-2")
+	if instance := c.Get("fhm2"); instance != nil {
+		t.Errorf("expected fhm2 to be invalidated, got %v", instance)
+	}
+
+	c.Set(&compute.Instance{Id: "fhm3", Name: "node-3"})
+	now = now.Add(2 * time.Minute)
+	if instance := c.GetByName("node-3"); instance != nil {
+		t.Errorf("expected node-3 to expire, got %v", instance)
+	}
+	if instance := c.Get("fhm3"); instance != nil {
+		t.Errorf("expected fhm3 to expire, got %v", instance)
+	}
+
+	disabled := newInstanceCache(0)
+	disabled.Set(&compute.Instance{Id: "fhm4", Name: "node-4"})
+	if instance := disabled.Get("fhm4"); instance != nil {
+		t.Errorf("expected zero TTL to disable caching, got %v", instance)
+	}
+}
@@ -3,13 +3,13 @@ package yandex
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
-	"github.com/pkg/errors"
 	"github.com/yandex-cloud/go-genproto/yandex/cloud/compute/v1"
-	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	cloudprovider "k8s.io/cloud-provider"
@@ -42,12 +42,22 @@ func (yc *Cloud) InstanceID(ctx context.Context, nodeName types.NodeName) (strin
 	return instance.Id, nil
 }
 
-func (yc *Cloud) InstanceType(_ context.Context, _ types.NodeName) (string, error) {
-	return "", nil
+func (yc *Cloud) InstanceType(ctx context.Context, nodeName types.NodeName) (string, error) {
+	instance, err := yc.getInstanceByNodeName(ctx, nodeName)
+	if err != nil {
+		return "", err
+	}
+
+	return getInstanceType(instance), nil
 }
 
-func (yc *Cloud) InstanceTypeByProviderID(_ context.Context, _ string) (string, error) {
-	return "", nil
+func (yc *Cloud) InstanceTypeByProviderID(ctx context.Context, providerID string) (string, error) {
+	instance, err := yc.getInstanceByProviderID(ctx, providerID)
+	if err != nil {
+		return "", err
+	}
+
+	return getInstanceType(instance), nil
 }
 
 func (yc *Cloud) AddSSHKeyToAllInstances(_ context.Context, _ string, _ []byte) error {
@@ -59,7 +69,7 @@ func (yc *Cloud) CurrentNodeName(_ context.Context, hostName string) (types.Node
 }
 
 func (yc *Cloud) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
-	_, err := yc.getInstanceByProviderID(ctx, providerID)
+	instance, err := yc.getInstanceByProviderID(ctx, providerID)
 	if err != nil {
 		if err == cloudprovider.InstanceNotFound {
 			return false, nil
@@ -68,7 +78,7 @@ func (yc *Cloud) InstanceExistsByProviderID(ctx context.Context, providerID stri
 		return false, err
 	}
 
-	return true, nil
+	return !instanceIsDeleted(instance), nil
 }
 
 func (yc *Cloud) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
@@ -77,7 +87,23 @@ func (yc *Cloud) InstanceShutdownByProviderID(ctx context.Context, providerID st
 		return false, err
 	}
 
-	return instance.Status == compute.Instance_STOPPED, nil
+	return instanceIsShutdown(instance), nil
+}
+
+// instanceIsShutdown reports whether the Instance is stopped or is being stopped by the user.
+// Transient states, e.g. PROVISIONING, STARTING, RESTARTING or UPDATING, don't count, so that rebooting Nodes are not tainted.
+func instanceIsShutdown(instance *compute.Instance) bool {
+	switch instance.Status {
+	case compute.Instance_STOPPING, compute.Instance_STOPPED:
+		return true
+	default:
+		return false
+	}
+}
+
+// instanceIsDeleted reports whether the Instance is going away and its Node should be removed
+func instanceIsDeleted(instance *compute.Instance) bool {
+	return instance.Status == compute.Instance_DELETING
 }
 
 func (yc *Cloud) extractNodeAddresses(ctx context.Context, instance *compute.Instance) ([]v1.NodeAddress, error) {
@@ -89,7 +115,7 @@ func (yc *Cloud) extractNodeAddresses(ctx context.Context, instance *compute.Ins
 
 	if len(yc.config.InternalNetworkIDsSet) > 0 {
 		for _, iface := range instance.NetworkInterfaces {
-			networkID, err := mapSubnetIdToNetworkID(ctx, yc.yandexService.VPCSvc.SubnetSvc, iface.SubnetId)
+			networkID, err := yc.getSubnetNetworkID(ctx, iface.SubnetId)
 			if err != nil {
 				return nil, err
 			}
@@ -112,7 +138,7 @@ func (yc *Cloud) extractNodeAddresses(ctx context.Context, instance *compute.Ins
 
 	if len(yc.config.ExternalNetworkIDsSet) > 0 {
 		for _, iface := range instance.NetworkInterfaces {
-			networkID, err := mapSubnetIdToNetworkID(ctx, yc.yandexService.VPCSvc.SubnetSvc, iface.SubnetId)
+			networkID, err := yc.getSubnetNetworkID(ctx, iface.SubnetId)
 			if err != nil {
 				return nil, err
 			}
@@ -140,29 +166,37 @@ func (yc *Cloud) getInstanceByProviderID(ctx context.Context, providerID string)
 	}
 
 	if instanceNameIsId {
-		instance, err := yc.yandexService.ComputeSvc.InstanceSvc.Get(ctx, &compute.GetInstanceRequest{InstanceId: instanceName})
-		if err != nil {
-			if status.Code(err) == codes.NotFound {
-				return nil, cloudprovider.InstanceNotFound
-			}
-			return nil, err
-		}
+		return yc.getInstanceByID(ctx, instanceName)
+	}
+
+	return yc.findInstanceByName(ctx, instanceName)
+}
+
+func (yc *Cloud) getInstanceByID(ctx context.Context, instanceID string) (*compute.Instance, error) {
+	if instance := yc.instanceCache.Get(instanceID); instance != nil {
 		return instance, nil
 	}
 
-	instance, err := yc.yandexService.ComputeSvc.FindInstanceByName(ctx, instanceName)
+	instance, err := yc.yandexService.ComputeSvc.InstanceSvc.Get(ctx, &compute.GetInstanceRequest{InstanceId: instanceID})
 	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, cloudprovider.InstanceNotFound
+		}
 		return nil, err
 	}
-	if instance == nil {
-		return nil, cloudprovider.InstanceNotFound
-	}
+	yc.instanceCache.Set(instance)
 
 	return instance, nil
 }
 
 func (yc *Cloud) getInstanceByNodeName(ctx context.Context, nodeName types.NodeName) (*compute.Instance, error) {
-	instanceName := MapNodeNameToInstanceName(nodeName)
+	return yc.findInstanceByName(ctx, yc.mapNodeNameToInstanceName(nodeName))
+}
+
+func (yc *Cloud) findInstanceByName(ctx context.Context, instanceName string) (*compute.Instance, error) {
+	if instance := yc.instanceCache.GetByName(instanceName); instance != nil {
+		return instance, nil
+	}
 
 	instance, err := yc.yandexService.ComputeSvc.FindInstanceByName(ctx, instanceName)
 	if err != nil {
@@ -171,16 +205,35 @@ func (yc *Cloud) getInstanceByNodeName(ctx context.Context, nodeName types.NodeN
 	if instance == nil {
 		return nil, cloudprovider.InstanceNotFound
 	}
+	yc.instanceCache.Set(instance)
 
 	return instance, nil
 }
 
-// TODO: move?
-func mapSubnetIdToNetworkID(ctx context.Context, vpcSdk vpc.SubnetServiceClient, subnetID string) (string, error) {
-	subnet, err := vpcSdk.Get(ctx, &vpc.GetSubnetRequest{SubnetId: subnetID})
-	if err != nil {
-		return "", errors.WithStack(err)
+const (
+	bytesInGiB = 1 << 30
+	// instances having more memory per core are considered memory-optimized
+	highMemoryPerCore = 8 * bytesInGiB
+)
+
+// getInstanceType maps Instance's platform and resources to an instance type in the "${platformID}-${cores}-${memoryGiB}" form, e.g. "standard-v3-2-8".
+// GPU instances have the number of GPUs added, e.g. "gpu-standard-v3-1gpu-8-96", memory-optimized ones are marked as "highmem", e.g. "standard-v3-highmem-2-32".
+func getInstanceType(instance *compute.Instance) string {
+	if instance.Resources == nil {
+		return instance.PlatformId
+	}
+
+	resources := instance.Resources
+	parts := []string{instance.PlatformId}
+	if resources.Gpus > 0 {
+		parts = append(parts, strconv.FormatInt(resources.Gpus, 10)+"gpu")
+	} else if resources.Cores > 0 && resources.Memory/resources.Cores >= highMemoryPerCore {
+		parts = append(parts, "highmem")
 	}
+	parts = append(parts,
+		strconv.FormatInt(resources.Cores, 10),
+		strconv.FormatFloat(float64(resources.Memory)/bytesInGiB, 'f', -1, 64),
+	)
 
-	return subnet.NetworkId, nil
+	return strings.Join(parts, "-")
 }
@@ -0,0 +1,58 @@
+package yandex
+
+import (
+	"testing"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/compute/v1"
+)
+
+func TestGetInstanceType(t *testing.T) {
+	testCases := []struct {
+		instance     *compute.Instance
+		instanceType string
+	}{
+		{
+			instance:     &compute.Instance{PlatformId: "standard-v3", Resources: &compute.Resources{Cores: 2, Memory: 8 * bytesInGiB}},
+			instanceType: "standard-v3-2-8",
+		},
+		{
+			instance:     &compute.Instance{PlatformId: "standard-v2", Resources: &compute.Resources{Cores: 2, Memory: bytesInGiB / 2}},
+			instanceType: "standard-v2-2-0.5",
+		},
+		{
+			instance:     &compute.Instance{PlatformId: "standard-v3", Resources: &compute.Resources{Cores: 2, Memory: 32 * bytesInGiB}},
+			instanceType: "standard-v3-highmem-2-32",
+		},
+		{
+			instance:     &compute.Instance{PlatformId: "gpu-standard-v3", Resources: &compute.Resources{Cores: 28, Memory: 119 * bytesInGiB, Gpus: 1}},
+			instanceType: "gpu-standard-v3-1gpu-28-119",
+		},
+		{
+			instance:     &compute.Instance{PlatformId: "standard-v1"},
+			instanceType: "standard-v1",
+		},
+	}
+
+	for _, tc := range testCases {
+		if instanceType := getInstanceType(tc.instance); instanceType != tc.instanceType {
+			t.Errorf("expected instance type %q, got %q", tc.instanceType, instanceType)
+		}
+	}
+}
+
+func TestInstanceIsShutdown(t *testing.T) {
+	shutdownStatuses := map[compute.Instance_Status]bool{
+		compute.Instance_STOPPING: true,
+		compute.Instance_STOPPED:  true,
+	}
+
+	for status := range compute.Instance_Status_name {
+		instance := &compute.Instance{Status: compute.Instance_Status(status)}
+		if isShutdown := instanceIsShutdown(instance); isShutdown != shutdownStatuses[instance.Status] {
+			t.Errorf("unexpected shutdown state %t for status %s", isShutdown, instance.Status)
+		}
+		if isDeleted := instanceIsDeleted(instance); isDeleted != (instance.Status == compute.Instance_DELETING) {
+			t.Errorf("unexpected deleted state %t for status %s", isDeleted, instance.Status)
+		}
+	}
+}
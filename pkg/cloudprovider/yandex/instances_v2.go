@@ -0,0 +1,95 @@
+package yandex
+
+import (
+	"context"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+func (yc *Cloud) InstanceExists(ctx context.Context, node *v1.Node) (bool, error) {
+	instance, err := yc.getInstanceByNode(ctx, node)
+	if err != nil {
+		if err == cloudprovider.InstanceNotFound {
+			yc.invalidateInstanceCache(node)
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	if instanceIsDeleted(instance) {
+		yc.instanceCache.Delete(instance.Id)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (yc *Cloud) InstanceShutdown(ctx context.Context, node *v1.Node) (bool, error) {
+	instance, err := yc.getInstanceByNode(ctx, node)
+	if err != nil {
+		return false, err
+	}
+
+	return instanceIsShutdown(instance), nil
+}
+
+func (yc *Cloud) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
+	instance, err := yc.getInstanceByNode(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeAddresses, err := yc.extractNodeAddresses(ctx, instance)
+	if err != nil {
+		return nil, err
+	}
+
+	zone, err := yc.getZone(instance.ZoneId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cloudprovider.InstanceMetadata{
+		ProviderID:    FormatProviderID(instance.Id),
+		InstanceType:  getInstanceType(instance),
+		NodeAddresses: nodeAddresses,
+		Zone:          zone.FailureDomain,
+		Region:        zone.Region,
+	}, nil
+}
+
+// instanceIDLabel may be set on Nodes to the ID of their Instance, for environments where Node names don't match Instance names
+const instanceIDLabel = "yandex.cpi.flant.com/instance-id"
+
+// getInstanceByNode finds the Instance by Node's ProviderID. Until the ProviderID is set, the Instance is looked up by
+// the ID in instanceIDLabel, and then by the Node name.
+func (yc *Cloud) getInstanceByNode(ctx context.Context, node *v1.Node) (*compute.Instance, error) {
+	if len(node.Spec.ProviderID) != 0 {
+		return yc.getInstanceByProviderID(ctx, node.Spec.ProviderID)
+	}
+	if instanceID := node.Labels[instanceIDLabel]; len(instanceID) != 0 {
+		return yc.getInstanceByID(ctx, instanceID)
+	}
+
+	return yc.getInstanceByNodeName(ctx, types.NodeName(node.Name))
+}
+
+// invalidateInstanceCache drops cached lookups of the Node's Instance, so that a Node recreated with the same name
+// is not matched to the gone Instance
+func (yc *Cloud) invalidateInstanceCache(node *v1.Node) {
+	if len(node.Spec.ProviderID) != 0 {
+		if instanceName, instanceNameIsId, err := ParseProviderID(node.Spec.ProviderID); err == nil {
+			if instanceNameIsId {
+				yc.instanceCache.Delete(instanceName)
+			} else {
+				yc.instanceCache.DeleteByName(instanceName)
+			}
+		}
+	}
+
+	yc.instanceCache.DeleteByName(yc.mapNodeNameToInstanceName(types.NodeName(node.Name)))
+}
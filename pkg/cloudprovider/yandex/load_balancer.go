@@ -2,21 +2,80 @@ package yandex
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"log"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
 	"github.com/yandex-cloud/go-genproto/yandex/cloud/loadbalancer/v1"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	cloudprovider "k8s.io/cloud-provider"
 	svchelpers "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/klog/v2"
+
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/tracing"
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/yapi"
 )
 
 const (
 	targetGroupNetworkIdAnnotation = "yandex.cpi.flant.com/target-group-network-id"
 	externalLoadBalancerAnnotation = "yandex.cpi.flant.com/loadbalancer-external"
 	listenerSubnetIdAnnotation     = "yandex.cpi.flant.com/listener-subnet-id"
+	listenerSubnetIDsAnnotation    = "yandex.cpi.flant.com/loadbalancer-subnet-ids"
 	listenerAddressIPv4            = "yandex.cpi.flant.com/listener-address-ipv4"
+	loadBalancerTypeAnnotation     = "yandex.cpi.flant.com/loadbalancer-type"
+	folderIDAnnotation             = "yandex.cpi.flant.com/loadbalancer-folder-id"
+	sharedNameAnnotation           = "yandex.cpi.flant.com/loadbalancer-shared-name"
+	nameAnnotation                 = "yandex.cpi.flant.com/loadbalancer-name"
+
+	// TODO: the annotations below are reserved for features the NLB API or the vendored SDK lack. Services requesting them
+	// fail to reconcile instead of silently getting a load balancer without the feature.
+	externalIPIDAnnotation      = "yandex.cpi.flant.com/loadbalancer-external-ip-id"
+	loadBalancerClassAnnotation = "yandex.cpi.flant.com/loadbalancer-class"
+	logGroupIDAnnotation        = "yandex.cpi.flant.com/loadbalancer-log-group-id"
+	idleTimeoutAnnotation       = "yandex.cpi.flant.com/loadbalancer-idle-timeout"
+	proxyProtocolAnnotation     = "yandex.cpi.flant.com/loadbalancer-proxy-protocol"
+	targetWeightsAnnotation     = "yandex.cpi.flant.com/target-weights"
+	zonesAnnotation             = "yandex.cpi.flant.com/loadbalancer-zones"
+
+	// targetGroupIDAnnotation attaches the NLB to a TargetGroup managed outside the CCM, whose Targets are left intact
+	targetGroupIDAnnotation = "yandex.cpi.flant.com/loadbalancer-target-group-id"
+	// labelsAnnotation holds extra labels of the NLB and its dedicated TargetGroup, e.g. for cost allocation
+	labelsAnnotation = "yandex.cpi.flant.com/loadbalancer-labels"
+	// ignoreAnnotation set to "true" leaves the Service's NLB to be managed by hand, e.g. during migrations
+	ignoreAnnotation = "yandex.cpi.flant.com/loadbalancer-ignore"
+
+	// NLBs and their dedicated TargetGroups are labeled with the UID, namespace and name of their Service,
+	// so that they are found after renames and restarts
+	serviceUIDLabel       = "service-uid"
+	serviceNamespaceLabel = "service-namespace"
+	serviceNameLabel      = "service-name"
+
+	healthCheckIntervalAnnotation           = "yandex.cpi.flant.com/healthcheck-interval"
+	healthCheckTimeoutAnnotation            = "yandex.cpi.flant.com/healthcheck-timeout"
+	healthCheckHealthyThresholdAnnotation   = "yandex.cpi.flant.com/healthcheck-healthy-threshold"
+	healthCheckUnhealthyThresholdAnnotation = "yandex.cpi.flant.com/healthcheck-unhealthy-threshold"
+	healthCheckPathAnnotation               = "yandex.cpi.flant.com/healthcheck-path"
+	healthCheckPortAnnotation               = "yandex.cpi.flant.com/healthcheck-port"
+	healthCheckProtocolAnnotation           = "yandex.cpi.flant.com/healthcheck-protocol"
+
+	healthCheckProtocolHTTP = "HTTP"
+	healthCheckProtocolTCP  = "TCP"
+
+	loadBalancerTypeInternal = "internal"
+	loadBalancerTypeExternal = "external"
+
+	loadBalancerClassNLB = "nlb"
+	loadBalancerClassALB = "alb"
 
 	nodesHealthCheckPath = "/healthz"
 	// NOTE: Please keep the following port in sync with ProxyHealthzPort in pkg/cluster/ports/ports.go
@@ -24,6 +83,28 @@ const (
 	// cloud provider which is required as part of the out-of-tree cloud provider efforts.
 	// TODO: use a shared constant once ports in pkg/cluster/ports are in a common external repo.
 	lbNodesHealthCheckPort = 10256
+
+	// defaults and limits of the Yandex.Cloud NLB health checks
+	defaultHealthCheckInterval  = 2 * time.Second
+	defaultHealthCheckTimeout   = time.Second
+	defaultHealthCheckThreshold = 2
+	minHealthCheckInterval      = 2 * time.Second
+	maxHealthCheckInterval      = 300 * time.Second
+	minHealthCheckTimeout       = time.Second
+	maxHealthCheckTimeout       = 60 * time.Second
+	minHealthCheckThreshold     = 2
+	maxHealthCheckThreshold     = 10
+
+	// maxResourceLabels is the limit of labels on a Yandex.Cloud resource
+	maxResourceLabels = 64
+)
+
+var regExpLoadBalancerName = regexp.MustCompile(`^[a-z]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// label keys and values allowed by Yandex.Cloud
+var (
+	regExpLabelKey   = regexp.MustCompile(`^[a-z][-_./\\@0-9a-z]{0,62}$`)
+	regExpLabelValue = regexp.MustCompile(`^[-_./\\@0-9a-z]{0,63}$`)
 )
 
 var kubeToYandexServiceProtoMapping = map[v1.Protocol]loadbalancer.Listener_Protocol{
@@ -33,58 +114,313 @@ var kubeToYandexServiceProtoMapping = map[v1.Protocol]loadbalancer.Listener_Prot
 
 // GetLoadBalancer is an implementation of LoadBalancer.GetLoadBalancer
 func (yc *Cloud) GetLoadBalancer(ctx context.Context, _ string, service *v1.Service) (status *v1.LoadBalancerStatus, exists bool, err error) {
-	lbName := defaultLoadBalancerName(service)
+	if !yc.managesLoadBalancer(service) {
+		return &v1.LoadBalancerStatus{}, false, nil
+	}
 
-	log.Printf("Retrieving LB by name %q", lbName)
-	lb, err := yc.yandexService.LbSvc.GetLbByName(ctx, lbName)
+	lbName := yc.GetLoadBalancerName(ctx, "", service)
+	_, shared := getSharedLoadBalancerName(service)
+
+	var lb *loadbalancer.NetworkLoadBalancer
+	if shared {
+		klog.InfoS("Retrieving LB by name", "service", klog.KObj(service), "lbName", lbName)
+		lb, err = yc.yandexService.LbSvc.GetLbByName(ctx, yc.getLoadBalancerFolderID(service), lbName)
+	} else {
+		lb, err = yc.findServiceLB(ctx, service, lbName)
+	}
 	if err != nil {
 		return &v1.LoadBalancerStatus{}, false, err
 	}
-	if lb == nil {
+	if lb == nil || !yc.ownsResource(lb.Labels) {
 		return &v1.LoadBalancerStatus{}, false, nil
 	}
 
+	// the status is reported the same way ensureLB does, Listeners of other Services on a shared NLB are skipped
+	var prefix string
+	if shared {
+		prefix = sharedListenerPrefix(service)
+	}
 	var lbIngresses []v1.LoadBalancerIngress
-	for _, listener := range lb.Listeners {
-		lbIngresses = append(lbIngresses, v1.LoadBalancerIngress{
-			IP: fmt.Sprintf("%s://%s:%v", strings.ToLower(loadbalancer.Listener_Protocol_name[int32(listener.Protocol)]), listener.Address, listener.Port),
-		})
+	for _, address := range yapi.ListenerAddresses(lb.Listeners, prefix) {
+		lbIngresses = append(lbIngresses, v1.LoadBalancerIngress{IP: address})
+	}
+
+	if len(lbIngresses) == 0 {
+		return &v1.LoadBalancerStatus{}, false, nil
 	}
 
 	return &v1.LoadBalancerStatus{Ingress: lbIngresses}, true, nil
 }
 
+// findServiceLB returns the NLB dedicated to the Service: the one named nlbName, unless it's labeled with another
+// Service's UID, or otherwise the one labeled with the Service's UID, e.g. if the name annotation was changed
+func (yc *Cloud) findServiceLB(ctx context.Context, service *v1.Service, nlbName string) (*loadbalancer.NetworkLoadBalancer, error) {
+	folderID := yc.getLoadBalancerFolderID(service)
+
+	klog.InfoS("Retrieving LB by name", "service", klog.KObj(service), "lbName", nlbName)
+	lb, err := yc.yandexService.LbSvc.GetLbByName(ctx, folderID, nlbName)
+	if err != nil {
+		return nil, err
+	}
+	if lb != nil {
+		uid, ok := lb.Labels[serviceUIDLabel]
+		if !ok || uid == string(service.UID) {
+			return lb, nil
+		}
+		klog.InfoS("LB belongs to another Service, looking the Service's LB up by its UID", "service", klog.KObj(service), "lbName", nlbName, "serviceUid", uid)
+	}
+
+	return yc.yandexService.LbSvc.FindLbByLabel(ctx, folderID, serviceUIDLabel, string(service.UID))
+}
+
 // GetLoadBalancerName is an implementation of LoadBalancer.GetLoadBalancerName.
 func (yc *Cloud) GetLoadBalancerName(_ context.Context, _ string, service *v1.Service) string {
+	if sharedName, ok := getSharedLoadBalancerName(service); ok {
+		return sharedName
+	}
+
+	if name, ok := service.ObjectMeta.Annotations[nameAnnotation]; ok {
+		if regExpLoadBalancerName.MatchString(name) {
+			return name
+		}
+		klog.InfoS("Invalid annotation value, using the default name", "service", klog.KObj(service), "annotation", nameAnnotation, "value", name)
+	}
+
 	return defaultLoadBalancerName(service)
 }
 
+// serviceSpanAttributes identify the Service in LB operation spans
+func serviceSpanAttributes(service *v1.Service) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("service", klog.KObj(service).String()),
+	}
+}
+
 // EnsureLoadBalancer is an implementation of LoadBalancer.EnsureLoadBalancer.
-func (yc *Cloud) EnsureLoadBalancer(ctx context.Context, _ string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
-	err := yc.nodeTargetGroupSyncer.SyncTGs(ctx, nodes)
+func (yc *Cloud) EnsureLoadBalancer(ctx context.Context, _ string, service *v1.Service, nodes []*v1.Node) (_ *v1.LoadBalancerStatus, err error) {
+	if !yc.managesLoadBalancer(service) {
+		klog.V(2).InfoS("LB of the Service is not managed by the CCM, skipping it", "service", klog.KObj(service))
+		return nil, cloudprovider.ImplementedElsewhere
+	}
+
+	ctx, span := tracing.Start(ctx, "EnsureLoadBalancer", serviceSpanAttributes(service)...)
+	defer func() { tracing.End(span, err) }()
+
+	ctx, done, err := yc.drainer.begin(ctx)
 	if err != nil {
 		return nil, err
 	}
+	defer done()
+
+	nodes = yc.filterLoadBalancerNodes(nodes)
+	err = yc.nodeTargetGroupSyncer.SyncTGs(ctx, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := yc.lbWorkers.acquire(ctx, yc.GetLoadBalancerName(ctx, "", service))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
 	return yc.ensureLB(ctx, service, nodes)
 }
 
-// UpdateLoadBalancer is an implementation of LoadBalancer.UpdateLoadBalancer.
-func (yc *Cloud) UpdateLoadBalancer(ctx context.Context, _ string, service *v1.Service, nodes []*v1.Node) error {
-	err := yc.nodeTargetGroupSyncer.SyncTGs(ctx, nodes)
+// UpdateLoadBalancer is an implementation of LoadBalancer.UpdateLoadBalancer. The service controller calls it
+// on Node set changes only, so just TargetGroup Targets and security groups of the Nodes are reconciled,
+// leaving Listeners intact. Falls back to a full reconciliation if the NLB is missing, the TargetGroup is not attached
+// or its health checks are outdated.
+func (yc *Cloud) UpdateLoadBalancer(ctx context.Context, _ string, service *v1.Service, nodes []*v1.Node) (err error) {
+	if !yc.managesLoadBalancer(service) {
+		return cloudprovider.ImplementedElsewhere
+	}
+
+	ctx, span := tracing.Start(ctx, "UpdateLoadBalancer", serviceSpanAttributes(service)...)
+	defer func() { tracing.End(span, err) }()
+
+	ctx, done, err := yc.drainer.begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer done()
+
+	nodes = yc.filterLoadBalancerNodes(nodes)
+	err = yc.nodeTargetGroupSyncer.SyncTGs(ctx, nodes)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("no Nodes provided")
+	}
+
+	lbName := defaultLoadBalancerName(service)
+	nlbName := yc.GetLoadBalancerName(ctx, "", service)
+	release, err := yc.lbWorkers.acquire(ctx, nlbName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	lbParams, err := yc.getLoadBalancerParameters(service)
+	if err != nil {
+		return err
+	}
+
+	var lb *loadbalancer.NetworkLoadBalancer
+	if len(lbParams.sharedName) > 0 {
+		lb, err = yc.yandexService.LbSvc.GetLbByName(ctx, lbParams.folderID, nlbName)
+	} else {
+		lb, err = yc.findServiceLB(ctx, service, nlbName)
+	}
+	if err != nil {
+		return err
+	}
+	// Targets are only touched once the NLB is known to be the Service's, ensureLB validates a missing one first
+	if lb == nil {
+		klog.InfoS("LB is missing, reconciling it fully", "service", klog.KObj(service), "lbName", nlbName)
+		_, err = yc.ensureLB(ctx, service, nodes)
+		return err
+	}
+	if !yc.ownsResource(lb.Labels) {
+		return fmt.Errorf("LB %q is not owned by cluster %q, its labels are %v", nlbName, yc.config.ClusterName, lb.Labels)
+	}
+	if uid, ok := lb.Labels[serviceUIDLabel]; ok && len(lbParams.sharedName) == 0 && uid != string(service.UID) {
+		return fmt.Errorf("LB %q belongs to another Service with UID %q, choose another name with %q annotation", nlbName, uid, nameAnnotation)
+	}
+
+	healthChecks, hcPort, err := newHealthChecks(service, yc.healthCheckDefaults())
+	if err != nil {
+		return err
+	}
+	tgID, err := yc.ensureLBTargets(ctx, service, lbName, lbParams, hcPort, nodes)
+	if err != nil {
+		return err
+	}
+
+	attachedTG := getAttachedTargetGroup(lb, tgID)
+	if attachedTG == nil {
+		klog.InfoS("LB TargetGroup is not attached, reconciling it fully", "service", klog.KObj(service), "lbName", nlbName, "targetGroupId", tgID)
+		_, err = yc.ensureLB(ctx, service, nodes)
+		return err
+	}
+	if !yapi.NLBHealthChecksAreEqual(attachedTG.HealthChecks, healthChecks) {
+		klog.InfoS("LB health checks are outdated, reconciling it fully", "service", klog.KObj(service), "lbName", nlbName, "targetGroupId", tgID)
+		_, err = yc.ensureLB(ctx, service, nodes)
+		return err
+	}
+	if len(lbParams.sharedName) == 0 && !labelsContain(lb.Labels, yc.serviceLBLabels(service, lbParams)) {
+		klog.InfoS("LB labels are outdated, reconciling it fully", "service", klog.KObj(service), "lbName", nlbName)
+		_, err = yc.ensureLB(ctx, service, nodes)
+		return err
+	}
+
+	return nil
+}
+
+// serviceLBLabels returns labels of the NLB and the TargetGroup dedicated to the Service
+func (yc *Cloud) serviceLBLabels(service *v1.Service, lbParams loadBalancerParameters) map[string]string {
+	labels := map[string]string{
+		serviceUIDLabel:       string(service.UID),
+		serviceNamespaceLabel: service.Namespace,
+		serviceNameLabel:      service.Name,
+	}
+	for key, value := range lbParams.labels {
+		labels[key] = value
+	}
+
+	return yc.clusterLabels(labels)
+}
+
+// labelsContain reports whether all the expected labels are set to the same values
+func labelsContain(labels, expected map[string]string) bool {
+	for key, value := range expected {
+		if existing, ok := labels[key]; !ok || existing != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getAttachedTargetGroup returns the TargetGroup with tgID attached to the LB, if the LB exists and has one
+func getAttachedTargetGroup(lb *loadbalancer.NetworkLoadBalancer, tgID string) *loadbalancer.AttachedTargetGroup {
+	if lb == nil {
+		return nil
+	}
+	for _, attachedTG := range lb.AttachedTargetGroups {
+		if attachedTG.TargetGroupId == tgID {
+			return attachedTG
+		}
+	}
 
-	_, err = yc.ensureLB(ctx, service, nodes)
-	return err
+	return nil
 }
 
 // EnsureLoadBalancerDeleted is an implementation of LoadBalancer.EnsureLoadBalancerDeleted.
-func (yc *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, _ string, service *v1.Service) error {
+// It is safe to call repeatedly: resources that are already gone are skipped, so an interrupted deletion is finished on retry.
+func (yc *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, _ string, service *v1.Service) (err error) {
+	if !yc.managesLoadBalancer(service) {
+		return cloudprovider.ImplementedElsewhere
+	}
+
+	ctx, span := tracing.Start(ctx, "EnsureLoadBalancerDeleted", serviceSpanAttributes(service)...)
+	defer func() { tracing.End(span, err) }()
+
+	ctx, done, err := yc.drainer.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+
 	lbName := defaultLoadBalancerName(service)
+	folderID := yc.getLoadBalancerFolderID(service)
+
+	nlbName := yc.GetLoadBalancerName(ctx, "", service)
+	release, err := yc.lbWorkers.acquire(ctx, nlbName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	sharedName, shared := getSharedLoadBalancerName(service)
+	var lb *loadbalancer.NetworkLoadBalancer
+	if shared {
+		lb, err = yc.yandexService.LbSvc.GetLbByName(ctx, folderID, nlbName)
+	} else {
+		// the NLB may have been renamed or the name annotation removed, it is still labeled with the Service UID
+		lb, err = yc.findServiceLB(ctx, service, nlbName)
+	}
+	if err != nil {
+		return err
+	}
+
+	uid, labeled := lb.GetLabels()[serviceUIDLabel]
+	switch {
+	case lb != nil && !yc.ownsResource(lb.Labels):
+		klog.InfoS("LB is not owned by the cluster, skipping deletion", "service", klog.KObj(service), "lbName", nlbName, "labels", lb.Labels)
+	case shared:
+		if err := yc.yandexService.LbSvc.RemoveSharedLBListeners(ctx, folderID, sharedName, sharedListenerPrefix(service)); err != nil {
+			return err
+		}
+	case lb == nil:
+		klog.InfoS("LB does not exist, skipping deletion", "service", klog.KObj(service), "lbName", nlbName)
+	case labeled && uid != string(service.UID):
+		// the name annotation of another Service may point to the same NLB
+		klog.InfoS("LB belongs to another Service, skipping deletion", "service", klog.KObj(service), "lbName", nlbName, "serviceUid", uid)
+	default:
+		if err := yc.yandexService.LbSvc.RemoveLB(ctx, lb); err != nil {
+			return err
+		}
+	}
 
-	err := yc.yandexService.LbSvc.RemoveLBByName(ctx, lbName)
+	// only TargetGroups created by the CCM are removed, an external one from the annotation is left to its owner
+	err = yc.nodeTargetGroupSyncer.RemoveServiceTGs(ctx, folderID, lbName)
+	if err != nil {
+		return err
+	}
+
+	err = yc.removeLBSecurityGroups(ctx, service, lbName)
 	if err != nil {
 		return err
 	}
@@ -92,6 +428,21 @@ func (yc *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, _ string, servic
 	return yc.nodeTargetGroupSyncer.SyncTGs(ctx, []*v1.Node{})
 }
 
+// getSharedLoadBalancerName returns the name of the NLB shared by multiple Services, if the Service requests one
+func getSharedLoadBalancerName(service *v1.Service) (string, bool) {
+	value, ok := service.ObjectMeta.Annotations[sharedNameAnnotation]
+	if !ok || len(value) == 0 {
+		return "", false
+	}
+
+	return value, true
+}
+
+// sharedListenerPrefix prefixes names of the Service's Listeners on a shared NLB, so that they can be told apart after restarts
+func sharedListenerPrefix(service *v1.Service) string {
+	return defaultLoadBalancerName(service) + "-"
+}
+
 func defaultLoadBalancerName(service *v1.Service) string {
 	ret := "a" + string(service.UID)
 	ret = strings.Replace(ret, "-", "", -1)
@@ -101,6 +452,11 @@ func defaultLoadBalancerName(service *v1.Service) string {
 	return ret
 }
 
+// listenerName returns a name unique within the NLB, so that TCP and UDP listeners can share a port number
+func listenerName(svcPort v1.ServicePort) string {
+	return strings.ToLower(string(svcPort.Protocol)) + "-" + strconv.Itoa(int(svcPort.Port))
+}
+
 func (yc *Cloud) ensureLB(ctx context.Context, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
 	// sanity checks
 	// current API restrictions
@@ -111,121 +467,828 @@ func (yc *Cloud) ensureLB(ctx context.Context, service *v1.Service, nodes []*v1.
 		return nil, fmt.Errorf("no Nodes provided")
 	}
 
+	if err := validateServicePorts(service); err != nil {
+		return nil, err
+	}
+	if err := validateSessionAffinity(service); err != nil {
+		return nil, err
+	}
+
+	// lbName identifies auxiliary resources dedicated to the Service, nlbName may be overridden by the user
 	lbName := defaultLoadBalancerName(service)
-	lbParams := yc.getLoadBalancerParameters(service)
+	nlbName := yc.GetLoadBalancerName(ctx, "", service)
+	lbParams, err := yc.getLoadBalancerParameters(service)
+	if err != nil {
+		return nil, err
+	}
 
-	var listenerSpecs []*loadbalancer.ListenerSpec
-	for index, svcPort := range service.Spec.Ports {
-		listenerName := svcPort.Name
-		if len(listenerName) == 0 {
-			listenerName = "listener-" + strconv.Itoa(index)
+	// fails early if the service account can't manage NLBs in the requested Folder
+	existingLB, err := yc.yandexService.LbSvc.GetLbByName(ctx, lbParams.folderID, nlbName)
+	if err != nil {
+		if lbParams.folderID != yc.config.FolderID && status.Code(err) == codes.PermissionDenied {
+			return nil, fmt.Errorf("no access to Folder %q from %q annotation: %s", lbParams.folderID, folderIDAnnotation, err)
 		}
+		return nil, err
+	}
+	if existingLB != nil && !yc.ownsResource(existingLB.Labels) {
+		return nil, fmt.Errorf("LB %q is not owned by cluster %q, its labels are %v", nlbName, yc.config.ClusterName, existingLB.Labels)
+	}
+	// the name annotation of another Service may point to the same NLB
+	if uid, ok := existingLB.GetLabels()[serviceUIDLabel]; ok && len(lbParams.sharedName) == 0 && uid != string(service.UID) {
+		return nil, fmt.Errorf("LB %q belongs to another Service with UID %q, choose another name with %q annotation", nlbName, uid, nameAnnotation)
+	}
 
-		listenerSpec := &loadbalancer.ListenerSpec{
-			Name:       listenerName,
-			Port:       int64(svcPort.Port),
-			Protocol:   kubeToYandexServiceProtoMapping[svcPort.Protocol],
-			TargetPort: int64(svcPort.NodePort),
+	if len(lbParams.sharedName) == 0 {
+		if err := yc.checkLoadBalancerRename(ctx, service, lbParams.folderID, nlbName); err != nil {
+			return nil, err
 		}
+	}
+	if err := yc.validateListenerSubnets(ctx, lbParams); err != nil {
+		return nil, err
+	}
 
-		if lbParams.internal {
-			internalAddressSpec := &loadbalancer.InternalAddressSpec{
-				SubnetId: lbParams.listenerSubnetID,
-			}
+	ipFamilies := getServiceIPFamilies(service)
 
-			if len(lbParams.listenerAddressIPv4) > 0 {
-				internalAddressSpec.Address = lbParams.listenerAddressIPv4
-				internalAddressSpec.IpVersion = loadbalancer.IpVersion_IPV4
-			}
+	var listenerSpecs []*loadbalancer.ListenerSpec
+	for _, svcPort := range service.Spec.Ports {
+		for _, ipFamily := range ipFamilies {
+			listenerSpecs = append(listenerSpecs, newListenerSpecs(service, svcPort, ipFamily, lbParams)...)
+		}
+	}
 
-			listenerSpec.Address = &loadbalancer.ListenerSpec_InternalAddressSpec{
-				InternalAddressSpec: internalAddressSpec,
-			}
-		} else {
-			externalAddressSpec := &loadbalancer.ExternalAddressSpec{}
+	healthChecks, hcPort, err := newHealthChecks(service, yc.healthCheckDefaults())
+	if err != nil {
+		return nil, err
+	}
 
-			if len(lbParams.listenerAddressIPv4) > 0 {
-				externalAddressSpec.Address = lbParams.listenerAddressIPv4
-				externalAddressSpec.IpVersion = loadbalancer.IpVersion_IPV4
-			}
+	dedicatedTG := yc.usesDedicatedTargetGroup(service, lbParams)
 
-			listenerSpec.Address = &loadbalancer.ListenerSpec_ExternalAddressSpec{
-				ExternalAddressSpec: externalAddressSpec,
-			}
+	tgID, err := yc.ensureLBTargets(ctx, service, lbName, lbParams, hcPort, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	attachedTGs := []*loadbalancer.AttachedTargetGroup{
+		{
+			TargetGroupId: tgID,
+			HealthChecks:  healthChecks,
+		},
+	}
+
+	var addresses []string
+	if len(lbParams.sharedName) > 0 {
+		addresses, err = yc.yandexService.LbSvc.EnsureSharedLBListeners(ctx, lbParams.folderID, lbParams.sharedName, sharedListenerPrefix(service), yc.clusterLabels(nil), listenerSpecs, attachedTGs)
+	} else {
+		addresses, err = yc.yandexService.LbSvc.CreateOrUpdateLB(ctx, lbParams.folderID, nlbName, yc.serviceLBLabels(service, lbParams), listenerSpecs, attachedTGs)
+	}
+	if err != nil {
+		if len(lbParams.listenerAddressIPv4) > 0 {
+			return nil, errors.Wrapf(err, "failed to bind NLB %q to address %q, make sure it is reserved and not used by another resource",
+				nlbName, lbParams.listenerAddressIPv4)
+		}
+		if containsIPFamily(ipFamilies, v1.IPv6Protocol) {
+			return nil, errors.Wrapf(err, "failed to ensure IPv6 Listeners of NLB %q, make sure IPv6 is available in the Folder "+
+				"and, for internal NLBs, the listener Subnet has an IPv6 CIDR", nlbName)
 		}
+		return nil, err
+	}
 
-		listenerSpecs = append(listenerSpecs, listenerSpec)
+	if !dedicatedTG {
+		// the Service might have been switched from the Local policy, its TargetGroup is detached by now
+		if err := yc.nodeTargetGroupSyncer.RemoveServiceTGs(ctx, lbParams.folderID, lbName); err != nil {
+			return nil, err
+		}
+	}
+
+	lbStatus := &v1.LoadBalancerStatus{}
+	for _, address := range addresses {
+		lbStatus.Ingress = append(lbStatus.Ingress, v1.LoadBalancerIngress{IP: address})
+	}
+
+	return lbStatus, nil
+}
+
+// serviceHealthCheckPathPort returns the path and port Nodes are health checked on, Services with the Local
+// traffic policy are checked on kube-proxy's HealthCheckNodePort, which fails on Nodes without ready local Pods.
+// Other Services, and Local ones whose HealthCheckNodePort isn't allocated yet, are checked on the default
+// path and port, kube-proxy's healthz unless configured otherwise.
+func serviceHealthCheckPathPort(service *v1.Service, defaults healthCheckParameters) (string, int32) {
+	if hcPath, hcPort := svchelpers.GetServiceHealthCheckPathPort(service); hcPort != 0 {
+		return hcPath, hcPort
 	}
 
 	hcPath, hcPort := nodesHealthCheckPath, int32(lbNodesHealthCheckPort)
-	if svchelpers.RequestsOnlyLocalTraffic(service) {
-		// Service requires a special health check, retrieve the OnlyLocal port & path
-		hcPath, hcPort = svchelpers.GetServiceHealthCheckPathPort(service)
+	if len(defaults.path) > 0 {
+		hcPath = defaults.path
+	}
+	if defaults.port != 0 {
+		hcPort = defaults.port
 	}
 
-	log.Printf("Health checking on path %q and port %v", hcPath, hcPort)
-	healthChecks := []*loadbalancer.HealthCheck{
-		{
-			Name:               "kube-health-check",
-			UnhealthyThreshold: 2,
-			HealthyThreshold:   2,
-			Options: &loadbalancer.HealthCheck_HttpOptions_{
-				HttpOptions: &loadbalancer.HealthCheck_HttpOptions{
-					Port: int64(hcPort),
-					Path: hcPath,
-				},
+	return hcPath, hcPort
+}
+
+// newHealthChecks returns health checks of the Service's TargetGroup along with the port Nodes are checked on
+func newHealthChecks(service *v1.Service, defaults healthCheckParameters) ([]*loadbalancer.HealthCheck, int32, error) {
+	hcPath, hcPort := serviceHealthCheckPathPort(service, defaults)
+	localTraffic := svchelpers.RequestsOnlyLocalTraffic(service)
+	if localTraffic {
+		// kube-proxy accepts connections on the HealthCheckNodePort regardless of local Pods, only its HTTP status
+		// reflects them, so the configured default protocol is ignored
+		defaults.protocol = healthCheckProtocolHTTP
+	}
+
+	hcParams, err := getHealthCheckParameters(service, defaults)
+	if err != nil {
+		return nil, 0, err
+	}
+	if localTraffic && hcParams.protocol == healthCheckProtocolTCP && hcParams.port == 0 {
+		return nil, 0, fmt.Errorf("%q annotation set to TCP would mark Nodes without local endpoints healthy, "+
+			"externalTrafficPolicy Local requires HTTP health checks unless %q annotation is set", healthCheckProtocolAnnotation, healthCheckPortAnnotation)
+	}
+	if len(hcParams.path) > 0 {
+		hcPath = hcParams.path
+	}
+	if hcParams.port != 0 {
+		hcPort = hcParams.port
+	}
+
+	healthCheck := &loadbalancer.HealthCheck{
+		Name:               "kube-health-check",
+		Interval:           ptypes.DurationProto(hcParams.interval),
+		Timeout:            ptypes.DurationProto(hcParams.timeout),
+		UnhealthyThreshold: hcParams.unhealthyThreshold,
+		HealthyThreshold:   hcParams.healthyThreshold,
+	}
+	if hcParams.protocol == healthCheckProtocolTCP {
+		klog.InfoS("Health checking on TCP port", "service", klog.KObj(service), "port", hcPort)
+		healthCheck.Options = &loadbalancer.HealthCheck_TcpOptions_{
+			TcpOptions: &loadbalancer.HealthCheck_TcpOptions{
+				Port: int64(hcPort),
 			},
-		},
+		}
+	} else {
+		klog.InfoS("Health checking on path and port", "service", klog.KObj(service), "path", hcPath, "port", hcPort)
+		healthCheck.Options = &loadbalancer.HealthCheck_HttpOptions_{
+			HttpOptions: &loadbalancer.HealthCheck_HttpOptions{
+				Port: int64(hcPort),
+				Path: hcPath,
+			},
+		}
+	}
+
+	return []*loadbalancer.HealthCheck{healthCheck}, hcPort, nil
+}
+
+// usesDedicatedTargetGroup reports whether the Service gets its own TargetGroup,
+// shared TargetGroups live in the default Folder, so NLBs in other Folders get dedicated ones.
+// Services attached to an external TargetGroup get none.
+func (yc *Cloud) usesDedicatedTargetGroup(service *v1.Service, lbParams loadBalancerParameters) bool {
+	if len(lbParams.targetGroupID) > 0 {
+		return false
+	}
+
+	return svchelpers.RequestsOnlyLocalTraffic(service) || lbParams.folderID != yc.config.FolderID
+}
+
+// ensureLBTargets reconciles Targets of the Service's TargetGroup and security groups of the Nodes,
+// returning the ID of the TargetGroup to attach to the NLB. External TargetGroups are only validated,
+// their Targets are managed by their owners.
+func (yc *Cloud) ensureLBTargets(ctx context.Context, service *v1.Service, lbName string, lbParams loadBalancerParameters, hcPort int32, nodes []*v1.Node) (string, error) {
+	var tgID string
+	if len(lbParams.targetGroupID) > 0 {
+		if err := yc.validateExternalTargetGroup(ctx, lbParams); err != nil {
+			return "", err
+		}
+		tgID = lbParams.targetGroupID
+	} else if yc.usesDedicatedTargetGroup(service, lbParams) {
+		// all Nodes are targeted even with the Local traffic policy, the HealthCheckNodePort check drops the ones
+		// without ready local Pods as Endpoints move, which the Node-triggered updates of Targets wouldn't keep up with
+		tgName := yc.nodeTargetGroupSyncer.serviceTargetGroupName(lbParams.targetGroupNetworkID, lbName)
+		var err error
+		tgID, err = yc.nodeTargetGroupSyncer.SyncServiceTG(ctx, lbParams.folderID, tgName, lbParams.targetGroupNetworkID, yc.serviceLBLabels(service, lbParams), nodes)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		tgName := yc.config.ClusterName + lbParams.targetGroupNetworkID
+		tg, err := yc.yandexService.LbSvc.GetTgByName(ctx, yc.config.FolderID, tgName)
+		if err != nil {
+			return "", err
+		}
+		if tg == nil {
+			// the shared TargetGroup is created by the Node TargetGroup syncer, so it's worth trying again soon
+			return "", yapi.NewError(yapi.ErrTransient, fmt.Errorf("TG %q does not exist yet", tgName))
+		}
+		tgID = tg.Id
 	}
 
-	tgName := yc.config.ClusterName + lbParams.targetGroupNetworkID
-	tg, err := yc.yandexService.LbSvc.GetTgByName(ctx, tgName)
+	if err := yc.ensureLBSecurityGroups(ctx, service, lbName, lbParams.targetGroupNetworkID, hcPort, nodes); err != nil {
+		return "", err
+	}
+
+	return tgID, nil
+}
+
+// validateExternalTargetGroup checks that the TargetGroup from the annotation exists in the NLB's Folder, isn't one
+// the CCM manages and may remove, and only targets addresses in the TargetGroup Network
+func (yc *Cloud) validateExternalTargetGroup(ctx context.Context, lbParams loadBalancerParameters) error {
+	tg, err := yc.yandexService.LbSvc.GetTgByID(ctx, lbParams.targetGroupID)
 	if err != nil {
-		return nil, err
+		return errors.Wrapf(err, "failed to get TargetGroup %q from %q annotation", lbParams.targetGroupID, targetGroupIDAnnotation)
 	}
 	if tg == nil {
-		return nil, fmt.Errorf("TG %q does not exist yet", tgName)
+		return fmt.Errorf("TargetGroup %q from %q annotation does not exist", lbParams.targetGroupID, targetGroupIDAnnotation)
+	}
+	if tg.FolderId != lbParams.folderID {
+		return fmt.Errorf("TargetGroup %q from %q annotation is in Folder %q, expected the NLB's Folder %q",
+			tg.Id, targetGroupIDAnnotation, tg.FolderId, lbParams.folderID)
+	}
+	// TargetGroups named after the cluster are cleaned up along with the cluster's ones
+	if _, ok := tg.Labels[clusterNameLabel]; ok || strings.HasPrefix(tg.Name, yc.config.ClusterName) {
+		return fmt.Errorf("TargetGroup %q (%q) from %q annotation is managed by a CCM, only TargetGroups managed elsewhere can be attached",
+			tg.Id, tg.Name, targetGroupIDAnnotation)
+	}
+	if len(lbParams.targetGroupNetworkID) == 0 {
+		return nil
 	}
 
-	externalIP, err := yc.yandexService.LbSvc.CreateOrUpdateLB(ctx, lbName, listenerSpecs, []*loadbalancer.AttachedTargetGroup{
-		{
-			TargetGroupId: tg.Id,
-			HealthChecks:  healthChecks,
-		},
-	})
+	checkedSubnets := make(map[string]struct{})
+	for _, target := range tg.Targets {
+		if _, ok := checkedSubnets[target.SubnetId]; ok {
+			continue
+		}
+		checkedSubnets[target.SubnetId] = struct{}{}
+
+		subnet, err := yc.yandexService.VPCSvc.SubnetSvc.Get(ctx, &vpc.GetSubnetRequest{SubnetId: target.SubnetId})
+		if err != nil {
+			return errors.Wrapf(err, "failed to get Subnet %q of TargetGroup %q", target.SubnetId, tg.Id)
+		}
+		if subnet.NetworkId != lbParams.targetGroupNetworkID {
+			return fmt.Errorf("TargetGroup %q from %q annotation targets Subnet %q in Network %q, expected %q",
+				tg.Id, targetGroupIDAnnotation, target.SubnetId, subnet.NetworkId, lbParams.targetGroupNetworkID)
+		}
+	}
+
+	return nil
+}
+
+// getServiceIPFamilies returns IP families the Service's Listeners are created for.
+// Services created before dual-stack support was enabled in the cluster have no IPFamilies set.
+func getServiceIPFamilies(service *v1.Service) []v1.IPFamily {
+	if len(service.Spec.IPFamilies) == 0 {
+		return []v1.IPFamily{v1.IPv4Protocol}
+	}
+
+	return service.Spec.IPFamilies
+}
+
+func containsIPFamily(ipFamilies []v1.IPFamily, ipFamily v1.IPFamily) bool {
+	for _, family := range ipFamilies {
+		if family == ipFamily {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newListenerSpec returns the spec of the Listener exposing the Service port in the IP family.
+// IPv4 Listeners keep their names, so that NLBs created before dual-stack support are not changed.
+func newListenerSpec(service *v1.Service, svcPort v1.ServicePort, ipFamily v1.IPFamily, lbParams loadBalancerParameters) *loadbalancer.ListenerSpec {
+	name := listenerName(svcPort)
+	if ipFamily == v1.IPv6Protocol {
+		name += "-ipv6"
+	}
+	if len(lbParams.sharedName) > 0 {
+		name = sharedListenerPrefix(service) + name
+	}
+
+	listenerSpec := &loadbalancer.ListenerSpec{
+		Name:       name,
+		Port:       int64(svcPort.Port),
+		Protocol:   kubeToYandexServiceProtoMapping[svcPort.Protocol],
+		TargetPort: int64(svcPort.NodePort),
+	}
+
+	var address string
+	var ipVersion loadbalancer.IpVersion
+	switch {
+	case ipFamily == v1.IPv6Protocol:
+		ipVersion = loadbalancer.IpVersion_IPV6
+	case len(lbParams.listenerAddressIPv4) > 0:
+		address, ipVersion = lbParams.listenerAddressIPv4, loadbalancer.IpVersion_IPV4
+	}
+
+	if lbParams.internal {
+		listenerSpec.Address = &loadbalancer.ListenerSpec_InternalAddressSpec{
+			InternalAddressSpec: &loadbalancer.InternalAddressSpec{
+				SubnetId:  lbParams.listenerSubnetIDs[0],
+				Address:   address,
+				IpVersion: ipVersion,
+			},
+		}
+	} else {
+		listenerSpec.Address = &loadbalancer.ListenerSpec_ExternalAddressSpec{
+			ExternalAddressSpec: &loadbalancer.ExternalAddressSpec{
+				Address:   address,
+				IpVersion: ipVersion,
+			},
+		}
+	}
+
+	return listenerSpec
+}
+
+// newListenerSpecs returns Listeners of the port and family, internal NLBs get one in each of the listener Subnets.
+// Listeners in the first Subnet keep plain names, so that adding Subnets doesn't rebuild them.
+func newListenerSpecs(service *v1.Service, svcPort v1.ServicePort, ipFamily v1.IPFamily, lbParams loadBalancerParameters) []*loadbalancer.ListenerSpec {
+	listenerSpecs := []*loadbalancer.ListenerSpec{newListenerSpec(service, svcPort, ipFamily, lbParams)}
+	if !lbParams.internal {
+		return listenerSpecs
+	}
+
+	for _, subnetID := range lbParams.listenerSubnetIDs[1:] {
+		listenerSpec := newListenerSpec(service, svcPort, ipFamily, lbParams)
+		listenerSpec.Name += "-" + subnetID
+		listenerSpec.GetInternalAddressSpec().SubnetId = subnetID
+		listenerSpecs = append(listenerSpecs, listenerSpec)
+	}
+
+	return listenerSpecs
+}
+
+// validateListenerSubnets checks that Subnets pinned with the annotation belong to the TargetGroup Network
+func (yc *Cloud) validateListenerSubnets(ctx context.Context, lbParams loadBalancerParameters) error {
+	if !lbParams.pinnedListenerSubnets {
+		return nil
+	}
+
+	for _, subnetID := range lbParams.listenerSubnetIDs {
+		subnet, err := yc.yandexService.VPCSvc.SubnetSvc.Get(ctx, &vpc.GetSubnetRequest{SubnetId: subnetID})
+		if err != nil {
+			return errors.Wrapf(err, "failed to get Subnet %q from %q annotation", subnetID, listenerSubnetIDsAnnotation)
+		}
+		if subnet.NetworkId != lbParams.targetGroupNetworkID {
+			return fmt.Errorf("Subnet %q from %q annotation is in Network %q, expected %q",
+				subnetID, listenerSubnetIDsAnnotation, subnet.NetworkId, lbParams.targetGroupNetworkID)
+		}
+	}
+
+	return nil
+}
+
+// checkLoadBalancerRename fails if the Service's NLB already exists under a different name, since NLBs can't be renamed in place
+func (yc *Cloud) checkLoadBalancerRename(ctx context.Context, service *v1.Service, folderID, nlbName string) error {
+	lb, err := yc.yandexService.LbSvc.GetLbByName(ctx, folderID, nlbName)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if lb != nil {
+		return nil
+	}
+
+	lb, err = yc.yandexService.LbSvc.FindLbByLabel(ctx, folderID, serviceUIDLabel, string(service.UID))
+	if err != nil {
+		return err
+	}
+	// NLBs created before labeling was introduced always have the default name
+	if lb == nil && nlbName != defaultLoadBalancerName(service) {
+		lb, err = yc.yandexService.LbSvc.GetLbByName(ctx, folderID, defaultLoadBalancerName(service))
+		if err != nil {
+			return err
+		}
+	}
+	if lb != nil {
+		return fmt.Errorf("NLB of the Service already exists as %q, renaming it to %q via %q annotation is not supported",
+			lb.Name, nlbName, nameAnnotation)
+	}
+
+	return nil
+}
+
+// managesLoadBalancer reports whether the CCM reconciles the Service's NLB: the Service must be of a handled
+// LoadBalancerClass and not annotated to be ignored. Unmanaged NLBs are neither reported, updated nor deleted.
+func (yc *Cloud) managesLoadBalancer(service *v1.Service) bool {
+	return service.Annotations[ignoreAnnotation] != "true" && yc.handlesLoadBalancerClass(service)
+}
+
+// handlesLoadBalancerClass reports whether the Service's NLB is managed by the CCM: Services of the configured
+// LoadBalancerClass are, as are Services without a class unless the CCM is told it isn't the default implementation.
+// Services of other classes are left to their controllers.
+func (yc *Cloud) handlesLoadBalancerClass(service *v1.Service) bool {
+	if service.Spec.LoadBalancerClass == nil || len(*service.Spec.LoadBalancerClass) == 0 {
+		return !yc.config.LbClassNotDefault
+	}
+
+	return len(yc.config.LbClass) != 0 && *service.Spec.LoadBalancerClass == yc.config.LbClass
+}
+
+// filterLoadBalancerNodes drops Nodes excluded from load balancing by the standard label
+// or not matching the configured selector. The service controller already skips the labeled ones,
+// this makes the CCM independent of its version.
+func (yc *Cloud) filterLoadBalancerNodes(nodes []*v1.Node) []*v1.Node {
+	var ret []*v1.Node
+	for _, node := range nodes {
+		if _, ok := node.Labels[v1.LabelNodeExcludeBalancers]; ok {
+			continue
+		}
+		if yc.config.LbNodeSelector != nil && !yc.config.LbNodeSelector.Matches(labels.Set(node.Labels)) {
+			continue
+		}
+
+		ret = append(ret, node)
 	}
 
-	return &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: externalIP}}}, nil
+	return ret
 }
 
 type loadBalancerParameters struct {
+	folderID             string
+	sharedName           string
 	targetGroupNetworkID string
-	listenerSubnetID     string
-	listenerAddressIPv4  string
-	internal             bool
+	// listenerSubnetIDs are Subnets internal Listeners are put into, each gets its own set of Listeners
+	listenerSubnetIDs   []string
+	listenerAddressIPv4 string
+	internal            bool
+	// pinnedListenerSubnets is set if Subnets are requested with the listenerSubnetIDsAnnotation and must be validated
+	pinnedListenerSubnets bool
+	// labels are put on the NLB and its dedicated TargetGroup along with the cluster ones
+	labels map[string]string
+	// targetGroupID is the TargetGroup managed outside the CCM to attach instead of a cluster one
+	targetGroupID string
+}
+
+// validateServicePorts fails before any changes are made if some of the Service ports can't be exposed by an NLB
+func validateServicePorts(service *v1.Service) error {
+	for _, svcPort := range service.Spec.Ports {
+		if _, ok := kubeToYandexServiceProtoMapping[svcPort.Protocol]; ok {
+			continue
+		}
+
+		if svcPort.Protocol == v1.ProtocolSCTP {
+			return fmt.Errorf("port %d: SCTP is not supported by Yandex.Cloud NLB, which only balances TCP and UDP; "+
+				"expose it via a NodePort Service or a Service with externalIPs instead", svcPort.Port)
+		}
+		return fmt.Errorf("protocol %q of port %d is not supported by Yandex.Cloud NLB", svcPort.Protocol, svcPort.Port)
+	}
+
+	return nil
+}
+
+// validateSessionAffinity fails if the Service requests session affinity NLBs can't provide.
+// NLBs only support 5-tuple affinity, which is what they always do, so ClientIP affinity can't be honored.
+// TODO: map ClientIP affinity and its timeout to the NLB once the API gains a client-IP-only affinity mode.
+func validateSessionAffinity(service *v1.Service) error {
+	if service.Spec.SessionAffinity != v1.ServiceAffinityClientIP {
+		return nil
+	}
+
+	return fmt.Errorf("sessionAffinity %q is not supported by Yandex.Cloud NLB, which only provides 5-tuple (client IP and port) affinity; "+
+		"set sessionAffinity to %q or use an Ingress controller with sticky sessions", v1.ServiceAffinityClientIP, v1.ServiceAffinityNone)
 }
 
-func (yc *Cloud) getLoadBalancerParameters(svc *v1.Service) (lbParams loadBalancerParameters) {
-	if value, ok := svc.ObjectMeta.Annotations[listenerSubnetIdAnnotation]; ok {
+func (yc *Cloud) getLoadBalancerParameters(svc *v1.Service) (lbParams loadBalancerParameters, err error) {
+	lbParams.folderID = yc.getLoadBalancerFolderID(svc)
+
+	if err := yc.validateLoadBalancerAnnotations(svc); err != nil {
+		return lbParams, err
+	}
+
+	if value, ok := svc.ObjectMeta.Annotations[loadBalancerClassAnnotation]; ok {
+		switch value {
+		case loadBalancerClassNLB:
+		case loadBalancerClassALB:
+			return lbParams, fmt.Errorf("%q annotation value %q is not supported yet, only %q is", loadBalancerClassAnnotation, value, loadBalancerClassNLB)
+		default:
+			return lbParams, fmt.Errorf("unsupported %q annotation value %q, expected %q", loadBalancerClassAnnotation, value, loadBalancerClassNLB)
+		}
+	}
+
+	if _, ok := svc.ObjectMeta.Annotations[logGroupIDAnnotation]; ok {
+		return lbParams, fmt.Errorf("%q annotation is not supported: NLBs have no access logs and %q class is not supported yet", logGroupIDAnnotation, loadBalancerClassALB)
+	}
+
+	if _, ok := svc.ObjectMeta.Annotations[idleTimeoutAnnotation]; ok {
+		return lbParams, fmt.Errorf("%q annotation is not supported: the NLB API does not allow changing the connection idle timeout", idleTimeoutAnnotation)
+	}
+
+	if value, ok := svc.ObjectMeta.Annotations[proxyProtocolAnnotation]; ok {
+		proxyProtocol, err := strconv.ParseBool(value)
+		if err != nil {
+			return lbParams, errors.Wrapf(err, "failed to parse %q annotation", proxyProtocolAnnotation)
+		}
+		if proxyProtocol {
+			return lbParams, fmt.Errorf("%q annotation is not supported: NLB Listeners have no PROXY protocol setting; "+
+				"NLBs don't terminate connections, so set externalTrafficPolicy to %q to preserve client IPs instead", proxyProtocolAnnotation, v1.ServiceExternalTrafficPolicyTypeLocal)
+		}
+	}
+
+	if _, ok := svc.ObjectMeta.Annotations[targetWeightsAnnotation]; ok {
+		return lbParams, fmt.Errorf("%q annotation is not supported: NLB Targets have no weights", targetWeightsAnnotation)
+	}
+
+	if sharedName, ok := getSharedLoadBalancerName(svc); ok {
+		if !regExpLoadBalancerName.MatchString(sharedName) {
+			return lbParams, fmt.Errorf("invalid %q annotation value %q", sharedNameAnnotation, sharedName)
+		}
+		// TargetGroups are attached to the whole NLB, so all Services sharing it must target the same one
+		if svchelpers.RequestsOnlyLocalTraffic(svc) {
+			return lbParams, fmt.Errorf("%q annotation can't be used with externalTrafficPolicy Local", sharedNameAnnotation)
+		}
+		if lbParams.folderID != yc.config.FolderID {
+			return lbParams, fmt.Errorf("%q annotation can't be used together with %q annotation", sharedNameAnnotation, folderIDAnnotation)
+		}
+		lbParams.sharedName = sharedName
+	}
+
+	if value, ok := svc.ObjectMeta.Annotations[targetGroupIDAnnotation]; ok {
+		if len(value) == 0 {
+			return lbParams, fmt.Errorf("%q annotation must not be empty", targetGroupIDAnnotation)
+		}
+		lbParams.targetGroupID = value
+	}
+
+	if value, ok := svc.ObjectMeta.Annotations[labelsAnnotation]; ok {
+		if lbParams.labels, err = parseLabelsAnnotation(value); err != nil {
+			return lbParams, err
+		}
+	}
+
+	if value, ok := svc.ObjectMeta.Annotations[listenerSubnetIDsAnnotation]; ok {
+		for _, subnetID := range strings.Split(value, ",") {
+			if subnetID = strings.TrimSpace(subnetID); len(subnetID) > 0 {
+				lbParams.listenerSubnetIDs = append(lbParams.listenerSubnetIDs, subnetID)
+			}
+		}
+		if len(lbParams.listenerSubnetIDs) == 0 {
+			return lbParams, fmt.Errorf("%q annotation must list at least one SubnetID", listenerSubnetIDsAnnotation)
+		}
+		// names of additional Listeners wouldn't fit into the limit with the shared Listener prefix
+		if len(lbParams.listenerSubnetIDs) > 1 && len(lbParams.sharedName) > 0 {
+			return lbParams, fmt.Errorf("%q annotation with multiple Subnets can't be used together with %q annotation", listenerSubnetIDsAnnotation, sharedNameAnnotation)
+		}
 		lbParams.internal = true
-		lbParams.listenerSubnetID = value
+		lbParams.pinnedListenerSubnets = true
+	} else if value, ok := svc.ObjectMeta.Annotations[listenerSubnetIdAnnotation]; ok {
+		lbParams.internal = true
+		lbParams.listenerSubnetIDs = []string{value}
 	} else if len(yc.config.lbListenerSubnetID) != 0 {
-		lbParams.listenerSubnetID = yc.config.lbListenerSubnetID
+		lbParams.listenerSubnetIDs = []string{yc.config.lbListenerSubnetID}
 		_, isExternal := svc.ObjectMeta.Annotations[externalLoadBalancerAnnotation]
 		lbParams.internal = !isExternal
 	}
 
-	if value, ok := svc.ObjectMeta.Annotations[targetGroupNetworkIdAnnotation]; ok {
-		lbParams.targetGroupNetworkID = value
-	} else if len(yc.config.lbTgNetworkID) != 0 {
-		lbParams.targetGroupNetworkID = yc.config.lbTgNetworkID
+	// explicit NLB type overrides the one derived from the listener subnet annotations above
+	if value, ok := svc.ObjectMeta.Annotations[loadBalancerTypeAnnotation]; ok {
+		// compared case-insensitively, like values of conflicting annotations are
+		switch strings.ToLower(value) {
+		case loadBalancerTypeInternal:
+			if len(lbParams.listenerSubnetIDs) == 0 {
+				return lbParams, fmt.Errorf("%q annotation is %q, but neither %q annotation nor %q env is set",
+					loadBalancerTypeAnnotation, value, listenerSubnetIdAnnotation, envLbListenerSubnetID)
+			}
+			lbParams.internal = true
+		case loadBalancerTypeExternal:
+			lbParams.internal = false
+		default:
+			return lbParams, fmt.Errorf("unsupported %q annotation value %q, expected %q or %q",
+				loadBalancerTypeAnnotation, value, loadBalancerTypeInternal, loadBalancerTypeExternal)
+		}
 	}
 
+	lbParams.targetGroupNetworkID = yc.getTargetGroupNetworkID(svc)
+
 	if value, ok := svc.ObjectMeta.Annotations[listenerAddressIPv4]; ok {
 		lbParams.listenerAddressIPv4 = value
+		if lbParams.internal && len(lbParams.listenerSubnetIDs) > 1 {
+			return lbParams, fmt.Errorf("%q annotation can't be used with multiple Subnets in %q annotation", listenerAddressIPv4, listenerSubnetIDsAnnotation)
+		}
+	}
+
+	if _, ok := svc.ObjectMeta.Annotations[zonesAnnotation]; ok {
+		return lbParams, fmt.Errorf("%q annotation is not supported: the NLB API does not allow choosing zones of external Listener addresses", zonesAnnotation)
+	}
+
+	// fail loudly instead of silently allocating an ephemeral address
+	if value, ok := svc.ObjectMeta.Annotations[externalIPIDAnnotation]; ok {
+		return lbParams, fmt.Errorf("%q annotation (%q) is not supported yet, set the reserved address via %q annotation instead",
+			externalIPIDAnnotation, value, listenerAddressIPv4)
 	}
 
 	return
 }
+
+// parseLabelsAnnotation parses labels given either as a JSON object or as comma-separated key=value pairs
+// and validates them against Yandex.Cloud constraints. Labels identifying the cluster's resources can't be overridden.
+func parseLabelsAnnotation(value string) (map[string]string, error) {
+	labels := make(map[string]string)
+	if value = strings.TrimSpace(value); strings.HasPrefix(value, "{") {
+		if err := json.Unmarshal([]byte(value), &labels); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q annotation as JSON", labelsAnnotation)
+		}
+	} else {
+		for _, pair := range strings.Split(value, ",") {
+			if pair = strings.TrimSpace(pair); len(pair) == 0 {
+				continue
+			}
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("%q annotation must consist of key=value pairs, got %q", labelsAnnotation, pair)
+			}
+			labels[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	// the cluster and Service labels are added to every NLB
+	reservedLabels := []string{clusterNameLabel, serviceUIDLabel, serviceNamespaceLabel, serviceNameLabel}
+	if len(labels) > maxResourceLabels-len(reservedLabels) {
+		return nil, fmt.Errorf("%q annotation has %d labels, at most %d are allowed", labelsAnnotation, len(labels), maxResourceLabels-len(reservedLabels))
+	}
+	for key, value := range labels {
+		if containsString(reservedLabels, key) {
+			return nil, fmt.Errorf("%q annotation can't override the %q label", labelsAnnotation, key)
+		}
+		if !regExpLabelKey.MatchString(key) {
+			return nil, fmt.Errorf("%q annotation has invalid label key %q, it must start with a lowercase letter "+
+				"and consist of up to 63 lowercase letters, digits and -_./\\@ characters", labelsAnnotation, key)
+		}
+		if !regExpLabelValue.MatchString(value) {
+			return nil, fmt.Errorf("%q annotation has invalid value %q of the %q label, it must consist of up to 63 "+
+				"lowercase letters, digits and -_./\\@ characters", labelsAnnotation, value, key)
+		}
+	}
+
+	return labels, nil
+}
+
+// getTargetGroupNetworkID returns the Network the Service's Nodes are targeted and their SecurityGroups managed in
+func (yc *Cloud) getTargetGroupNetworkID(svc *v1.Service) string {
+	if value, ok := svc.ObjectMeta.Annotations[targetGroupNetworkIdAnnotation]; ok {
+		return value
+	}
+
+	return yc.config.lbTgNetworkID
+}
+
+// getLoadBalancerFolderID returns the Folder the Service's NLB and its dedicated TargetGroup reside in
+func (yc *Cloud) getLoadBalancerFolderID(svc *v1.Service) string {
+	if value, ok := svc.ObjectMeta.Annotations[folderIDAnnotation]; ok && len(value) > 0 {
+		return value
+	}
+
+	return yc.config.FolderID
+}
+
+type healthCheckParameters struct {
+	interval           time.Duration
+	timeout            time.Duration
+	healthyThreshold   int64
+	unhealthyThreshold int64
+	path               string
+	// port overrides the default health check port, it must be one of the Service's node ports
+	port     int32
+	protocol string
+}
+
+// withFallbacks fills parameters left unset with the hardcoded defaults, path and port are left to serviceHealthCheckPathPort
+func (hcParams healthCheckParameters) withFallbacks() healthCheckParameters {
+	if hcParams.interval == 0 {
+		hcParams.interval = defaultHealthCheckInterval
+	}
+	if hcParams.timeout == 0 {
+		hcParams.timeout = defaultHealthCheckTimeout
+	}
+	if hcParams.healthyThreshold == 0 {
+		hcParams.healthyThreshold = defaultHealthCheckThreshold
+	}
+	if hcParams.unhealthyThreshold == 0 {
+		hcParams.unhealthyThreshold = defaultHealthCheckThreshold
+	}
+	if len(hcParams.protocol) == 0 {
+		hcParams.protocol = healthCheckProtocolHTTP
+	}
+
+	return hcParams
+}
+
+// healthCheckDefaults returns health check parameters of Services not overriding them with annotations
+func (yc *Cloud) healthCheckDefaults() healthCheckParameters {
+	return yc.config.lbHealthCheckDefaults.withFallbacks()
+}
+
+// getHealthCheckParameters applies the Service's annotations to the defaults. The returned path and port are only set
+// by annotations, the default ones are applied by serviceHealthCheckPathPort.
+func getHealthCheckParameters(svc *v1.Service, defaults healthCheckParameters) (hcParams healthCheckParameters, err error) {
+	hcParams = healthCheckParameters{
+		interval:           defaults.interval,
+		timeout:            defaults.timeout,
+		healthyThreshold:   defaults.healthyThreshold,
+		unhealthyThreshold: defaults.unhealthyThreshold,
+		protocol:           defaults.protocol,
+	}
+
+	if hcParams.interval, err = getDurationAnnotation(svc, healthCheckIntervalAnnotation, hcParams.interval, minHealthCheckInterval, maxHealthCheckInterval); err != nil {
+		return
+	}
+	if hcParams.timeout, err = getDurationAnnotation(svc, healthCheckTimeoutAnnotation, hcParams.timeout, minHealthCheckTimeout, maxHealthCheckTimeout); err != nil {
+		return
+	}
+	if hcParams.timeout >= hcParams.interval {
+		return hcParams, fmt.Errorf("health check timeout %s must be less than interval %s", hcParams.timeout, hcParams.interval)
+	}
+
+	if hcParams.healthyThreshold, err = getThresholdAnnotation(svc, healthCheckHealthyThresholdAnnotation, hcParams.healthyThreshold); err != nil {
+		return
+	}
+	if hcParams.unhealthyThreshold, err = getThresholdAnnotation(svc, healthCheckUnhealthyThresholdAnnotation, hcParams.unhealthyThreshold); err != nil {
+		return
+	}
+
+	if value, ok := svc.ObjectMeta.Annotations[healthCheckPathAnnotation]; ok {
+		if !strings.HasPrefix(value, "/") {
+			return hcParams, fmt.Errorf("%q annotation must be an absolute path, got %q", healthCheckPathAnnotation, value)
+		}
+		hcParams.path = value
+	}
+
+	if value, ok := svc.ObjectMeta.Annotations[healthCheckPortAnnotation]; ok {
+		port, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return hcParams, errors.Wrapf(err, "failed to parse %q annotation", healthCheckPortAnnotation)
+		}
+		if !isServiceNodePort(svc, int32(port)) {
+			return hcParams, fmt.Errorf("%q annotation must be one of the Service's node ports, got %d", healthCheckPortAnnotation, port)
+		}
+		hcParams.port = int32(port)
+	}
+
+	if value, ok := svc.ObjectMeta.Annotations[healthCheckProtocolAnnotation]; ok {
+		switch strings.ToUpper(value) {
+		case healthCheckProtocolHTTP:
+			hcParams.protocol = healthCheckProtocolHTTP
+		case healthCheckProtocolTCP:
+			hcParams.protocol = healthCheckProtocolTCP
+		default:
+			return hcParams, fmt.Errorf("unsupported %q annotation value %q, expected %q or %q",
+				healthCheckProtocolAnnotation, value, healthCheckProtocolHTTP, healthCheckProtocolTCP)
+		}
+	}
+	// the protocol may come from the defaults too
+	if hcParams.protocol == healthCheckProtocolTCP && len(hcParams.path) > 0 {
+		return hcParams, fmt.Errorf("%q annotation can't be used with %q protocol", healthCheckPathAnnotation, healthCheckProtocolTCP)
+	}
+
+	return
+}
+
+// isServiceNodePort reports whether the port is allocated to the Service as a node port or as its HealthCheckNodePort
+func isServiceNodePort(svc *v1.Service, port int32) bool {
+	if port <= 0 {
+		return false
+	}
+	if port == svc.Spec.HealthCheckNodePort {
+		return true
+	}
+	for _, svcPort := range svc.Spec.Ports {
+		if svcPort.NodePort == port {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getDurationAnnotation(svc *v1.Service, annotation string, defaultValue, min, max time.Duration) (time.Duration, error) {
+	value, ok := svc.ObjectMeta.Annotations[annotation]
+	if !ok {
+		return defaultValue, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %q annotation", annotation)
+	}
+	if duration < min || duration > max {
+		return 0, fmt.Errorf("%q annotation must be between %s and %s, got %s", annotation, min, max, duration)
+	}
+
+	return duration, nil
+}
+
+func getThresholdAnnotation(svc *v1.Service, annotation string, defaultValue int64) (int64, error) {
+	value, ok := svc.ObjectMeta.Annotations[annotation]
+	if !ok {
+		return defaultValue, nil
+	}
+
+	threshold, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %q annotation", annotation)
+	}
+	if threshold < minHealthCheckThreshold || threshold > maxHealthCheckThreshold {
+		return 0, fmt.Errorf("%q annotation must be between %d and %d, got %d", annotation, minHealthCheckThreshold, maxHealthCheckThreshold, threshold)
+	}
+
+	return threshold, nil
+}
@@ -0,0 +1,81 @@
+package yandex
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const conflictingAnnotationsReason = "ConflictingAnnotations"
+
+// annotationConflict is a combination of Service annotations the CCM can't reconcile,
+// empty values match any value of the annotation
+type annotationConflict struct {
+	annotation    string
+	value         string
+	conflictsWith string
+	conflictValue string
+	reason        string
+}
+
+// annotationConflicts are the known incompatible annotation combinations, they are rejected before any cloud call
+// instead of attempting a create the cloud rejects opaquely
+var annotationConflicts = []annotationConflict{
+	{loadBalancerTypeAnnotation, loadBalancerTypeInternal, externalLoadBalancerAnnotation, "",
+		"the NLB can't be both internal and external"},
+	{loadBalancerTypeAnnotation, loadBalancerTypeExternal, listenerSubnetIDsAnnotation, "",
+		"listener Subnets are only used by internal NLBs"},
+	{listenerSubnetIDsAnnotation, "", listenerSubnetIdAnnotation, "",
+		"both select listener Subnets, list all of them in the former"},
+	{sharedNameAnnotation, "", targetGroupIDAnnotation, "",
+		"a shared NLB targets the cluster's TargetGroup of all Services sharing it"},
+	{sharedNameAnnotation, "", labelsAnnotation, "",
+		"a shared NLB would get labels of whichever Service was reconciled last"},
+	{healthCheckProtocolAnnotation, healthCheckProtocolTCP, healthCheckPathAnnotation, "",
+		"TCP health checks have no path"},
+}
+
+// hasAnnotation reports whether the annotation is set to the value, values are compared case-insensitively
+func hasAnnotation(annotations map[string]string, annotation, value string) bool {
+	actual, ok := annotations[annotation]
+	return ok && (len(value) == 0 || strings.EqualFold(actual, value))
+}
+
+func describeAnnotation(annotation, value string) string {
+	if len(value) == 0 {
+		return fmt.Sprintf("%q annotation", annotation)
+	}
+
+	return fmt.Sprintf("%q annotation set to %q", annotation, value)
+}
+
+// validateAnnotationConflicts returns an error describing the first known incompatible combination
+// of the Service's annotations
+func validateAnnotationConflicts(service *v1.Service) error {
+	for _, c := range annotationConflicts {
+		if hasAnnotation(service.Annotations, c.annotation, c.value) && hasAnnotation(service.Annotations, c.conflictsWith, c.conflictValue) {
+			return fmt.Errorf("%s can't be used together with %s: %s",
+				describeAnnotation(c.annotation, c.value), describeAnnotation(c.conflictsWith, c.conflictValue), c.reason)
+		}
+	}
+
+	return nil
+}
+
+// validateLoadBalancerAnnotations fails on conflicting annotations of the Service
+// and explains the conflict with a Warning event on it
+func (yc *Cloud) validateLoadBalancerAnnotations(service *v1.Service) error {
+	err := validateAnnotationConflicts(service)
+	if err == nil {
+		return nil
+	}
+
+	klog.ErrorS(err, "Service has conflicting annotations", "service", klog.KObj(service))
+	if yc.eventRecorder != nil {
+		yc.eventRecorder.Eventf(service, v1.EventTypeWarning, conflictingAnnotationsReason, "Conflicting LB annotations: %s", err)
+	}
+
+	return err
+}
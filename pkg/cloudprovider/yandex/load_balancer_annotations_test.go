@@ -0,0 +1,59 @@
+package yandex
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestValidateAnnotationConflicts(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		conflict    bool
+	}{
+		{"no annotations", nil, false},
+		{"internal with external flag", map[string]string{loadBalancerTypeAnnotation: loadBalancerTypeInternal, externalLoadBalancerAnnotation: ""}, true},
+		{"internal with external flag, mixed case", map[string]string{loadBalancerTypeAnnotation: "Internal", externalLoadBalancerAnnotation: ""}, true},
+		{"external with listener Subnets", map[string]string{loadBalancerTypeAnnotation: loadBalancerTypeExternal, listenerSubnetIDsAnnotation: "subnet-a"}, true},
+		{"both listener Subnet annotations", map[string]string{listenerSubnetIDsAnnotation: "subnet-a", listenerSubnetIdAnnotation: "subnet-b"}, true},
+		{"shared with labels", map[string]string{sharedNameAnnotation: "shared-lb", labelsAnnotation: "team=billing"}, true},
+		{"TCP health check with path, mixed case", map[string]string{healthCheckProtocolAnnotation: "tcp", healthCheckPathAnnotation: "/ready"}, true},
+		{"HTTP health check with path", map[string]string{healthCheckProtocolAnnotation: "http", healthCheckPathAnnotation: "/ready"}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateAnnotationConflicts(&v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}})
+			if tc.conflict != (err != nil) {
+				t.Errorf("expected conflict: %t, got %v", tc.conflict, err)
+			}
+		})
+	}
+}
+
+func TestGetLoadBalancerParametersConflictingAnnotations(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	yc := &Cloud{eventRecorder: recorder}
+
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default", Annotations: map[string]string{
+		sharedNameAnnotation: "shared-lb",
+		labelsAnnotation:     "team=billing",
+	}}}
+	_, err := yc.getLoadBalancerParameters(service)
+	if err == nil || !strings.Contains(err.Error(), labelsAnnotation) {
+		t.Fatalf("should fail naming the conflicting annotation, got %v", err)
+	}
+
+	select {
+	case event := <-recorder.Events:
+		if !strings.HasPrefix(event, v1.EventTypeWarning+" "+conflictingAnnotationsReason) {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Errorf("expected a Warning event on the Service")
+	}
+}
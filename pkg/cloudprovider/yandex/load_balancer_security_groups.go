@@ -0,0 +1,541 @@
+package yandex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/compute/v1"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	cloudprovider "k8s.io/cloud-provider"
+	svchelpers "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/klog/v2"
+	netutils "k8s.io/utils/net"
+)
+
+const (
+	securityGroupIDsAnnotation  = "yandex.cpi.flant.com/loadbalancer-security-group-ids"
+	securityGroupAutoAnnotation = "yandex.cpi.flant.com/loadbalancer-security-group-auto"
+	// attachedSecurityGroupIDsAnnotation is set by the CCM to the SecurityGroups from securityGroupIDsAnnotation
+	// it attached, so that they are detached once no longer requested
+	attachedSecurityGroupIDsAnnotation = "yandex.cpi.flant.com/loadbalancer-attached-security-group-ids"
+
+	sourceRangesNotEnforcedReason = "SourceRangesNotEnforced"
+)
+
+// protocolNumbers maps Service port protocols to the IP protocol numbers SecurityGroup rules may refer to
+var protocolNumbers = map[v1.Protocol]int64{v1.ProtocolTCP: 6, v1.ProtocolUDP: 17, v1.ProtocolSCTP: 132}
+
+// maxInterfaceSecurityGroups is how many SecurityGroups may be attached to a network interface
+const maxInterfaceSecurityGroups = 5
+
+// healthCheckCIDRs are the ranges NLB health checks originate from
+var healthCheckCIDRs = []string{"198.18.235.0/24", "198.18.248.0/24"}
+
+// ensureLBSecurityGroups validates SecurityGroups requested for the Service and attaches them
+// to the network interfaces of the Nodes' Instances in the TargetGroup's Network.
+func (yc *Cloud) ensureLBSecurityGroups(ctx context.Context, service *v1.Service, lbName, networkID string, hcPort int32, nodes []*v1.Node) error {
+	sgIDs := securityGroupIDsFromAnnotation(service, securityGroupIDsAnnotation)
+	for _, sgID := range sgIDs {
+		sg, err := yc.yandexService.VPCSvc.SecurityGroupSvc.Get(ctx, &vpc.GetSecurityGroupRequest{SecurityGroupId: sgID})
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return fmt.Errorf("SecurityGroup %q from %q annotation does not exist", sgID, securityGroupIDsAnnotation)
+			}
+			return err
+		}
+		if sg.NetworkId != networkID {
+			return fmt.Errorf("SecurityGroup %q belongs to Network %q instead of TargetGroup's Network %q", sgID, sg.NetworkId, networkID)
+		}
+	}
+
+	// SecurityGroups removed from the annotation are detached before the requested ones are attached
+	if err := yc.detachAttachedSecurityGroups(ctx, service, sgIDs); err != nil {
+		return err
+	}
+	// they are recorded up front, so that the ones attached are detached even if attaching fails halfway
+	if err := yc.recordAttachedSecurityGroups(ctx, service, sgIDs); err != nil {
+		return err
+	}
+
+	// SecurityGroups managed by the CCM for the Service
+	var managedSGIDs []string
+	if service.ObjectMeta.Annotations[securityGroupAutoAnnotation] == "true" {
+		autoSGID, err := yc.yandexService.VPCSvc.CreateOrUpdateSecurityGroup(ctx, autoSecurityGroupName(lbName), networkID, healthCheckRuleSpecs(service, hcPort))
+		if err != nil {
+			return err
+		}
+		managedSGIDs = append(managedSGIDs, autoSGID)
+	} else if err := yc.removeManagedSecurityGroup(ctx, autoSecurityGroupName(lbName)); err != nil {
+		return err
+	}
+
+	sourceRanges, err := svchelpers.GetLoadBalancerSourceRanges(service)
+	if err != nil {
+		return err
+	}
+	// the SecurityGroup of the Service is replaced by the cluster's one, it's detached before the latter is attached
+	if err := yc.removeManagedSecurityGroup(ctx, sourceRangesSecurityGroupName(lbName)); err != nil {
+		return err
+	}
+	clusterSourceRangesSGID, err := yc.ensureSourceRangesSecurityGroup(ctx, networkID, service, false)
+	if err != nil {
+		return err
+	}
+	var sourceRangesSGID string
+	if !svchelpers.IsAllowAll(sourceRanges) {
+		sourceRangesSGID = clusterSourceRangesSGID
+		managedSGIDs = append(managedSGIDs, sourceRangesSGID)
+	}
+
+	if len(sgIDs) == 0 && len(managedSGIDs) == 0 {
+		return nil
+	}
+
+	// Nodes the source ranges can't be enforced on, other SecurityGroups are cached to look them up once
+	var unenforcedNodes []string
+	otherSGs := make(map[string]*vpc.SecurityGroup)
+	for _, node := range nodes {
+		interfaces, err := yc.getNodeInterfaces(ctx, node)
+		if err != nil {
+			return err
+		}
+
+		for _, nodeIface := range interfaces {
+			if nodeIface.networkID != networkID {
+				continue
+			}
+
+			expectedSGIDs := append([]string{}, sgIDs...)
+			// interfaces without SecurityGroups are governed by the Network's default SecurityGroup,
+			// attaching a managed one there would drop all the other traffic
+			if len(nodeIface.iface.SecurityGroupIds) > 0 || len(sgIDs) > 0 {
+				expectedSGIDs = append(expectedSGIDs, managedSGIDs...)
+			}
+
+			if err := yc.attachSecurityGroups(ctx, nodeIface.instance, nodeIface.iface, expectedSGIDs); err != nil {
+				return err
+			}
+
+			if len(sourceRangesSGID) == 0 || containsString(unenforcedNodes, node.Name) {
+				continue
+			}
+			enforced, err := yc.sourceRangesEnforced(ctx, service, sourceRanges, sourceRangesSGID, managedSGIDs, append(expectedSGIDs, nodeIface.iface.SecurityGroupIds...), otherSGs)
+			if err != nil {
+				return err
+			}
+			if !enforced {
+				unenforcedNodes = append(unenforcedNodes, node.Name)
+			}
+		}
+	}
+
+	if len(unenforcedNodes) > 0 {
+		klog.InfoS("loadBalancerSourceRanges are not enforced on some Nodes", "service", klog.KObj(service), "nodes", unenforcedNodes)
+		if yc.eventRecorder != nil {
+			yc.eventRecorder.Eventf(service, v1.EventTypeWarning, sourceRangesNotEnforcedReason,
+				"loadBalancerSourceRanges are not enforced on Nodes %s: their network interfaces have no SecurityGroups or other SecurityGroups allow the NodePorts", strings.Join(unenforcedNodes, ", "))
+		}
+	}
+
+	return nil
+}
+
+// sourceRangesEnforced reports whether the source ranges SecurityGroup is attached to the network interface
+// and none of the other attached SecurityGroups allows the Service's NodePorts from outside of the ranges,
+// since SecurityGroup rules are unioned
+func (yc *Cloud) sourceRangesEnforced(ctx context.Context, service *v1.Service, sourceRanges netutils.IPNetSet, sourceRangesSGID string,
+	managedSGIDs, attachedSGIDs []string, otherSGs map[string]*vpc.SecurityGroup) (bool, error) {
+	if !containsString(attachedSGIDs, sourceRangesSGID) {
+		return false, nil
+	}
+
+	for _, sgID := range attachedSGIDs {
+		if containsString(managedSGIDs, sgID) {
+			continue
+		}
+
+		sg, ok := otherSGs[sgID]
+		if !ok {
+			var err error
+			sg, err = yc.yandexService.VPCSvc.SecurityGroupSvc.Get(ctx, &vpc.GetSecurityGroupRequest{SecurityGroupId: sgID})
+			if err != nil {
+				return false, err
+			}
+			otherSGs[sgID] = sg
+		}
+
+		if allowsNodePortsBeyond(sg, service, sourceRanges) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// allowsNodePortsBeyond reports whether the SecurityGroup has an ingress rule allowing any of the Service's NodePorts
+// from CIDRs outside of the source ranges. Rules targeting SecurityGroups only allow traffic from inside the cloud.
+func allowsNodePortsBeyond(sg *vpc.SecurityGroup, service *v1.Service, sourceRanges netutils.IPNetSet) bool {
+	for _, rule := range sg.Rules {
+		if rule.Direction != vpc.SecurityGroupRule_INGRESS || rule.GetCidrBlocks() == nil {
+			continue
+		}
+
+		var cidrs []string
+		cidrs = append(cidrs, rule.GetCidrBlocks().V4CidrBlocks...)
+		cidrs = append(cidrs, rule.GetCidrBlocks().V6CidrBlocks...)
+		beyond := false
+		for _, cidr := range cidrs {
+			if !cidrWithin(cidr, sourceRanges) {
+				beyond = true
+				break
+			}
+		}
+		if !beyond {
+			continue
+		}
+
+		for _, svcPort := range service.Spec.Ports {
+			if ruleMatchesPort(rule, svcPort.Protocol, int64(svcPort.NodePort)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func ruleMatchesPort(rule *vpc.SecurityGroupRule, protocol v1.Protocol, port int64) bool {
+	if ports := rule.GetPorts(); ports != nil && (port < ports.FromPort || port > ports.ToPort) {
+		return false
+	}
+
+	switch {
+	case strings.EqualFold(rule.ProtocolName, "ANY"):
+		return true
+	case len(rule.ProtocolName) > 0:
+		return strings.EqualFold(rule.ProtocolName, string(protocol))
+	default:
+		return rule.ProtocolNumber == 0 || rule.ProtocolNumber == protocolNumbers[protocol]
+	}
+}
+
+// cidrWithin reports whether the CIDR is contained in one of the ranges, unparsable CIDRs are not
+func cidrWithin(cidr string, ranges netutils.IPNetSet) bool {
+	_, ipNet, err := netutils.ParseCIDRSloppy(cidr)
+	if err != nil {
+		return false
+	}
+
+	ones, _ := ipNet.Mask.Size()
+	for _, r := range ranges {
+		rangeOnes, _ := r.Mask.Size()
+		if r.Contains(ipNet.IP) && rangeOnes <= ones {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (yc *Cloud) attachSecurityGroups(ctx context.Context, instance *compute.Instance, iface *compute.NetworkInterface, sgIDs []string) error {
+	newSGIDs := append([]string{}, iface.SecurityGroupIds...)
+	for _, sgID := range sgIDs {
+		if !containsString(newSGIDs, sgID) {
+			newSGIDs = append(newSGIDs, sgID)
+		}
+	}
+	if len(newSGIDs) == len(iface.SecurityGroupIds) {
+		return nil
+	}
+	if len(newSGIDs) > maxInterfaceSecurityGroups {
+		return fmt.Errorf("can't attach SecurityGroups %s to network interface %s of Instance %q: it would have %d SecurityGroups, at most %d are allowed",
+			strings.Join(sgIDs, ", "), iface.Index, instance.Name, len(newSGIDs), maxInterfaceSecurityGroups)
+	}
+
+	klog.InfoS("Attaching SecurityGroups to Instance network interface", "sgIds", sgIDs, "instanceName", instance.Name, "interfaceIndex", iface.Index)
+	return yc.yandexService.ComputeSvc.UpdateNetworkInterfaceSecurityGroups(ctx, instance.Id, iface.Index, newSGIDs)
+}
+
+// removeLBSecurityGroups removes all SecurityGroups managed by the CCM for the NLB, the Service's rules
+// from the cluster's source ranges SecurityGroup and detaches the SecurityGroups attached for the Service
+func (yc *Cloud) removeLBSecurityGroups(ctx context.Context, service *v1.Service, lbName string) error {
+	// SecurityGroups requested by the Service are detached too in case the CCM failed to record them
+	if err := yc.detachAttachedSecurityGroups(ctx, service, nil, securityGroupIDsFromAnnotation(service, securityGroupIDsAnnotation)...); err != nil {
+		return err
+	}
+
+	for _, name := range []string{autoSecurityGroupName(lbName), sourceRangesSecurityGroupName(lbName)} {
+		if err := yc.removeManagedSecurityGroup(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	if networkID := yc.getTargetGroupNetworkID(service); len(networkID) > 0 {
+		if _, err := yc.ensureSourceRangesSecurityGroup(ctx, networkID, service, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureSourceRangesSecurityGroup rebuilds the cluster's SecurityGroup enforcing loadBalancerSourceRanges in the Network
+// from the ranges of all LoadBalancer Services targeting it, so that Services don't use up the SecurityGroups a network
+// interface may have. The service replaces its cached version, or is left out if deleted. The SecurityGroup is removed
+// once no Service restricts its sources, its ID is returned otherwise.
+func (yc *Cloud) ensureSourceRangesSecurityGroup(ctx context.Context, networkID string, service *v1.Service, deleted bool) (string, error) {
+	yc.sourceRangesSGLock.Lock()
+	defer yc.sourceRangesSGLock.Unlock()
+
+	cached, err := yc.nodeTargetGroupSyncer.serviceLister.List(labels.Everything())
+	if err != nil {
+		return "", fmt.Errorf("failed to list Services from an internal Indexer: %s", err)
+	}
+	var services []*v1.Service
+	for _, svc := range cached {
+		if svc.UID != service.UID {
+			services = append(services, svc)
+		}
+	}
+	if !deleted {
+		services = append(services, service)
+	}
+	// rules are created in a stable order
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Namespace+"/"+services[i].Name < services[j].Namespace+"/"+services[j].Name
+	})
+
+	var ruleSpecs []*vpc.SecurityGroupRuleSpec
+	for _, svc := range services {
+		if svc.Spec.Type != v1.ServiceTypeLoadBalancer || svc.DeletionTimestamp != nil || !yc.managesLoadBalancer(svc) || yc.getTargetGroupNetworkID(svc) != networkID {
+			continue
+		}
+		// Services with invalid ranges fail to reconcile on their own
+		sourceRanges, err := svchelpers.GetLoadBalancerSourceRanges(svc)
+		if err != nil || svchelpers.IsAllowAll(sourceRanges) {
+			continue
+		}
+
+		ruleSpecs = append(ruleSpecs, sourceRangesRuleSpecs(svc, sourceRanges.StringSlice())...)
+	}
+
+	name := yc.clusterSourceRangesSecurityGroupName(networkID)
+	if len(ruleSpecs) == 0 {
+		return "", yc.removeManagedSecurityGroup(ctx, name)
+	}
+
+	return yc.yandexService.VPCSvc.CreateOrUpdateSecurityGroup(ctx, name, networkID, ruleSpecs)
+}
+
+// detachAttachedSecurityGroups detaches the SecurityGroups recorded as attached for the Service, and the extra ones,
+// from Nodes' Instances unless they are kept or requested by other LoadBalancer Services. They aren't removed
+// since they are owned by users.
+func (yc *Cloud) detachAttachedSecurityGroups(ctx context.Context, service *v1.Service, keep []string, extra ...string) error {
+	var detached []string
+	for _, sgID := range append(securityGroupIDsFromAnnotation(service, attachedSecurityGroupIDsAnnotation), extra...) {
+		if !containsString(keep, sgID) && !containsString(detached, sgID) {
+			detached = append(detached, sgID)
+		}
+	}
+	if len(detached) == 0 {
+		return nil
+	}
+
+	services, err := yc.nodeTargetGroupSyncer.serviceLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list Services from an internal Indexer: %s", err)
+	}
+	requested := make(map[string]*v1.Service)
+	for _, svc := range services {
+		if svc.UID == service.UID || svc.Spec.Type != v1.ServiceTypeLoadBalancer || svc.DeletionTimestamp != nil || !yc.managesLoadBalancer(svc) {
+			continue
+		}
+		for _, sgID := range securityGroupIDsFromAnnotation(svc, securityGroupIDsAnnotation) {
+			requested[sgID] = svc
+		}
+	}
+
+	for _, sgID := range detached {
+		if svc, ok := requested[sgID]; ok {
+			klog.InfoS("SecurityGroup is still requested by another Service, not detaching it", "sgId", sgID, "service", klog.KObj(service), "otherService", klog.KObj(svc))
+			continue
+		}
+		if err := yc.detachSecurityGroup(ctx, sgID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordAttachedSecurityGroups sets the attachedSecurityGroupIDsAnnotation of the Service to the SecurityGroups,
+// or removes it if there are none. The Service isn't patched if the annotation is up to date already.
+func (yc *Cloud) recordAttachedSecurityGroups(ctx context.Context, service *v1.Service, sgIDs []string) error {
+	value := strings.Join(sgIDs, ",")
+	if yc.kubeClient == nil || service.Annotations[attachedSecurityGroupIDsAnnotation] == value {
+		return nil
+	}
+
+	var annotationValue interface{}
+	if len(value) > 0 {
+		annotationValue = value
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{attachedSecurityGroupIDsAnnotation: annotationValue},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = yc.kubeClient.CoreV1().Services(service.Namespace).Patch(ctx, service.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to record SecurityGroups attached for the Service: %s", err)
+	}
+
+	return nil
+}
+
+// removeManagedSecurityGroup detaches the SecurityGroup created for the NLB from Nodes' Instances and removes it
+func (yc *Cloud) removeManagedSecurityGroup(ctx context.Context, name string) error {
+	sg, err := yc.yandexService.VPCSvc.GetSecurityGroupByName(ctx, name)
+	if err != nil {
+		return err
+	}
+	if sg == nil {
+		return nil
+	}
+
+	if err := yc.detachSecurityGroup(ctx, sg.Id); err != nil {
+		return err
+	}
+
+	return yc.yandexService.VPCSvc.RemoveSecurityGroupByID(ctx, sg.Id)
+}
+
+// detachSecurityGroup detaches the SecurityGroup from network interfaces of Nodes' Instances
+func (yc *Cloud) detachSecurityGroup(ctx context.Context, sgID string) error {
+	nodes, err := yc.nodeLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list Nodes from an internal Indexer: %s", err)
+	}
+
+	for _, node := range nodes {
+		instance, err := yc.getInstanceByNodeName(ctx, types.NodeName(node.Name))
+		if err != nil {
+			if err == cloudprovider.InstanceNotFound {
+				continue
+			}
+			return err
+		}
+
+		for _, iface := range instance.NetworkInterfaces {
+			if !containsString(iface.SecurityGroupIds, sgID) {
+				continue
+			}
+
+			var newSGIDs []string
+			for _, id := range iface.SecurityGroupIds {
+				if id != sgID {
+					newSGIDs = append(newSGIDs, id)
+				}
+			}
+
+			klog.InfoS("Detaching SecurityGroup from Instance network interface", "sgId", sgID, "instanceName", instance.Name, "interfaceIndex", iface.Index)
+			if err := yc.yandexService.ComputeSvc.UpdateNetworkInterfaceSecurityGroups(ctx, instance.Id, iface.Index, newSGIDs); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// securityGroupIDsFromAnnotation parses the comma-separated SecurityGroup IDs of the Service's annotation
+func securityGroupIDsFromAnnotation(service *v1.Service, annotation string) []string {
+	var sgIDs []string
+	for _, sgID := range strings.Split(service.Annotations[annotation], ",") {
+		sgID = strings.TrimSpace(sgID)
+		if len(sgID) > 0 && !containsString(sgIDs, sgID) {
+			sgIDs = append(sgIDs, sgID)
+		}
+	}
+
+	return sgIDs
+}
+
+func autoSecurityGroupName(lbName string) string {
+	return lbName + "-health-check"
+}
+
+// sourceRangesSecurityGroupName is the name of the SecurityGroup enforcing source ranges of a single Service,
+// which the cluster's one replaced
+func sourceRangesSecurityGroupName(lbName string) string {
+	return lbName + "-source-ranges"
+}
+
+// clusterSourceRangesSecurityGroupName is named like the cluster's TargetGroup in the Network
+func (yc *Cloud) clusterSourceRangesSecurityGroupName(networkID string) string {
+	return yc.config.ClusterName + networkID + "-source-ranges"
+}
+
+// healthCheckRuleSpecs allows NLB health checks and traffic to the Service's NodePorts
+func healthCheckRuleSpecs(service *v1.Service, hcPort int32) []*vpc.SecurityGroupRuleSpec {
+	ruleSpecs := []*vpc.SecurityGroupRuleSpec{
+		newIngressRuleSpec("TCP", int64(hcPort), healthCheckCIDRs),
+	}
+	for _, svcPort := range service.Spec.Ports {
+		ruleSpecs = append(ruleSpecs, newIngressRuleSpec(string(svcPort.Protocol), int64(svcPort.NodePort), healthCheckCIDRs))
+	}
+
+	return ruleSpecs
+}
+
+// sourceRangesRuleSpecs allows traffic from the Service's loadBalancerSourceRanges to its NodePorts.
+// NLBs preserve client addresses, so the ranges are matched against the original source.
+func sourceRangesRuleSpecs(service *v1.Service, sourceRanges []string) []*vpc.SecurityGroupRuleSpec {
+	var ruleSpecs []*vpc.SecurityGroupRuleSpec
+	for _, svcPort := range service.Spec.Ports {
+		ruleSpecs = append(ruleSpecs, newIngressRuleSpec(string(svcPort.Protocol), int64(svcPort.NodePort), sourceRanges))
+	}
+
+	return ruleSpecs
+}
+
+func newIngressRuleSpec(protocol string, port int64, cidrs []string) *vpc.SecurityGroupRuleSpec {
+	cidrBlocks := &vpc.CidrBlocks{}
+	for _, cidr := range cidrs {
+		if netutils.IsIPv6CIDRString(cidr) {
+			cidrBlocks.V6CidrBlocks = append(cidrBlocks.V6CidrBlocks, cidr)
+		} else {
+			cidrBlocks.V4CidrBlocks = append(cidrBlocks.V4CidrBlocks, cidr)
+		}
+	}
+
+	return &vpc.SecurityGroupRuleSpec{
+		Direction: vpc.SecurityGroupRule_INGRESS,
+		Ports:     &vpc.PortRange{FromPort: port, ToPort: port},
+		Protocol:  &vpc.SecurityGroupRuleSpec_ProtocolName{ProtocolName: protocol},
+		Target:    &vpc.SecurityGroupRuleSpec_CidrBlocks{CidrBlocks: cidrBlocks},
+	}
+}
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,193 @@
+package yandex
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/compute/v1"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	netutils "k8s.io/utils/net"
+
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/yapi"
+)
+
+func TestAllowsNodePortsBeyond(t *testing.T) {
+	service := &v1.Service{Spec: v1.ServiceSpec{Ports: []v1.ServicePort{{Protocol: v1.ProtocolTCP, NodePort: 30080}}}}
+	sourceRanges, err := netutils.ParseIPNets("203.0.113.0/24", "2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := func(protocol string, ports *vpc.PortRange, cidrs ...string) *vpc.SecurityGroupRule {
+		cidrBlocks := &vpc.CidrBlocks{}
+		for _, cidr := range cidrs {
+			if netutils.IsIPv6CIDRString(cidr) {
+				cidrBlocks.V6CidrBlocks = append(cidrBlocks.V6CidrBlocks, cidr)
+			} else {
+				cidrBlocks.V4CidrBlocks = append(cidrBlocks.V4CidrBlocks, cidr)
+			}
+		}
+		return &vpc.SecurityGroupRule{
+			Direction:    vpc.SecurityGroupRule_INGRESS,
+			ProtocolName: protocol,
+			Ports:        ports,
+			Target:       &vpc.SecurityGroupRule_CidrBlocks{CidrBlocks: cidrBlocks},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		rule     *vpc.SecurityGroupRule
+		expected bool
+	}{
+		{"any port from anywhere", rule("ANY", nil, "0.0.0.0/0"), true},
+		{"NodePort range from anywhere", rule("TCP", &vpc.PortRange{FromPort: 30000, ToPort: 32767}, "0.0.0.0/0"), true},
+		{"NodePort from anywhere over IPv6", rule("TCP", &vpc.PortRange{FromPort: 30080, ToPort: 30080}, "::/0"), true},
+		{"NodePort from within the ranges", rule("TCP", &vpc.PortRange{FromPort: 30080, ToPort: 30080}, "203.0.113.128/25", "2001:db8:1::/48"), false},
+		{"other ports", rule("TCP", &vpc.PortRange{FromPort: 22, ToPort: 22}, "0.0.0.0/0"), false},
+		{"other protocol", rule("UDP", nil, "0.0.0.0/0"), false},
+		{"SecurityGroup target", &vpc.SecurityGroupRule{
+			Direction: vpc.SecurityGroupRule_INGRESS,
+			Target:    &vpc.SecurityGroupRule_SecurityGroupId{SecurityGroupId: "sg"},
+		}, false},
+		{"egress", &vpc.SecurityGroupRule{
+			Direction: vpc.SecurityGroupRule_EGRESS,
+			Target:    &vpc.SecurityGroupRule_CidrBlocks{CidrBlocks: &vpc.CidrBlocks{V4CidrBlocks: []string{"0.0.0.0/0"}}},
+		}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sg := &vpc.SecurityGroup{Rules: []*vpc.SecurityGroupRule{tc.rule}}
+			if actual := allowsNodePortsBeyond(sg, service, sourceRanges); actual != tc.expected {
+				t.Errorf("expected %t, got %t", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestEnsureSourceRangesSecurityGroup(t *testing.T) {
+	newService := func(name string, nodePort int32, annotations map[string]string, sourceRanges ...string) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(name), Annotations: annotations},
+			Spec: v1.ServiceSpec{
+				Type:                     v1.ServiceTypeLoadBalancer,
+				Ports:                    []v1.ServicePort{{Protocol: v1.ProtocolTCP, NodePort: nodePort}},
+				LoadBalancerSourceRanges: sourceRanges,
+			},
+		}
+	}
+	restricted := newService("restricted", 30080, nil, "203.0.113.0/24")
+	services := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, service := range []*v1.Service{
+		restricted,
+		newService("open", 30081, nil),
+		newService("other-network", 30082, map[string]string{targetGroupNetworkIdAnnotation: "other"}, "198.51.100.0/24"),
+	} {
+		_ = services.Add(service)
+	}
+
+	sgClient := &fakeSecurityGroupClient{securityGroups: []*vpc.SecurityGroup{{Id: "sg", Name: "clusternetwork-source-ranges", NetworkId: "network"}}}
+	yc := &Cloud{
+		yandexService: &yapi.YandexCloudAPI{
+			VPCSvc: yapi.NewVPCService(nil, nil, nil, sgClient, &yapi.CloudContext{OperationWaiter: fakeOperationWaiter}),
+		},
+		nodeLister: corev1listers.NewNodeLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+		config:     CloudConfig{ClusterName: "cluster", lbTgNetworkID: "network"},
+	}
+	yc.nodeTargetGroupSyncer = &NodeTargetGroupSyncer{cloud: yc, serviceLister: corev1listers.NewServiceLister(services)}
+
+	sgID, err := yc.ensureSourceRangesSecurityGroup(context.Background(), "network", newService("new", 30083, nil, "198.51.100.0/24"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sgID != "sg" || len(sgClient.ruleUpdates) != 1 {
+		t.Fatalf("the cluster's SecurityGroup should be updated, got %q and %d updates", sgID, len(sgClient.ruleUpdates))
+	}
+	ruleSpecs := sgClient.ruleUpdates[0].AdditionRuleSpecs
+	if len(ruleSpecs) != 2 || ruleSpecs[0].Ports.FromPort != 30083 || ruleSpecs[1].Ports.FromPort != 30080 {
+		t.Errorf("rules of the Services restricting their sources in the Network should be combined, got %v", ruleSpecs)
+	}
+
+	sgID, err = yc.ensureSourceRangesSecurityGroup(context.Background(), "network", restricted, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sgID) != 0 || len(sgClient.securityGroups) != 0 {
+		t.Error("the cluster's SecurityGroup should be removed once no Service in the Network restricts its sources")
+	}
+}
+
+func TestAttachSecurityGroupsLimit(t *testing.T) {
+	yc := &Cloud{}
+	instance := &compute.Instance{Id: "fhm1", Name: "node-a"}
+	iface := &compute.NetworkInterface{Index: "0", SecurityGroupIds: []string{"sg1", "sg2", "sg3", "sg4", "sg5"}}
+
+	if err := yc.attachSecurityGroups(context.Background(), instance, iface, []string{"sg1"}); err != nil {
+		t.Errorf("attached SecurityGroups should not count against the limit, got %v", err)
+	}
+	if err := yc.attachSecurityGroups(context.Background(), instance, iface, []string{"sg6"}); err == nil {
+		t.Error("attaching more SecurityGroups than a network interface may have should fail")
+	}
+}
+
+func TestDetachAttachedSecurityGroups(t *testing.T) {
+	ctx := context.Background()
+	web := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "web", Annotations: map[string]string{
+			attachedSecurityGroupIDsAnnotation: "sg-removed,sg-shared",
+		}},
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+	}
+	api := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "api", UID: "api", Annotations: map[string]string{
+			securityGroupIDsAnnotation:         "sg-shared",
+			attachedSecurityGroupIDsAnnotation: "sg-shared",
+		}},
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+	}
+	iface := &compute.NetworkInterface{Index: "0", SecurityGroupIds: []string{"sg-removed", "sg-shared", "sg-user"}}
+	computeClient := &fakeComputeClient{instances: map[string]*compute.Instance{
+		"fhm1": {Id: "fhm1", Name: "node-a", NetworkInterfaces: []*compute.NetworkInterface{iface}},
+	}}
+
+	yc := newFakeRouteCloud("", nil, computeClient, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}})
+	yc.yandexService.VPCSvc = yapi.NewVPCService(nil, nil, nil, &fakeSecurityGroupClient{}, &yapi.CloudContext{OperationWaiter: fakeOperationWaiter})
+	yc.config.lbTgNetworkID = "network"
+	kubeClient := fake.NewSimpleClientset(web, api)
+	yc.kubeClient = kubeClient
+	services := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	_ = services.Add(web)
+	_ = services.Add(api)
+	yc.nodeTargetGroupSyncer = &NodeTargetGroupSyncer{cloud: yc, serviceLister: corev1listers.NewServiceLister(services)}
+
+	// the annotation of web no longer requests any SecurityGroup
+	if err := yc.ensureLBSecurityGroups(ctx, web, "web-lb", "network", 10256, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(iface.SecurityGroupIds, []string{"sg-shared", "sg-user"}) {
+		t.Errorf("only the SecurityGroup no other Service requests should be detached, got %v", iface.SecurityGroupIds)
+	}
+	patched, err := kubeClient.CoreV1().Services("default").Get(ctx, "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := patched.Annotations[attachedSecurityGroupIDsAnnotation]; ok {
+		t.Errorf("no SecurityGroups should be recorded as attached, got %q", patched.Annotations[attachedSecurityGroupIDsAnnotation])
+	}
+
+	_ = services.Delete(web)
+	if err := yc.removeLBSecurityGroups(ctx, api, "api-lb"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(iface.SecurityGroupIds, []string{"sg-user"}) {
+		t.Errorf("SecurityGroups attached for a deleted Service should be detached, got %v", iface.SecurityGroupIds)
+	}
+}
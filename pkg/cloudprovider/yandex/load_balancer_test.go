@@ -0,0 +1,800 @@
+package yandex
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	mapset "github.com/deckarep/golang-set"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/loadbalancer/v1"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	cloudprovider "k8s.io/cloud-provider"
+
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/yapi"
+)
+
+func TestGetHealthCheckParameters(t *testing.T) {
+	defaults := healthCheckParameters{}.withFallbacks()
+	hcParams, err := getHealthCheckParameters(&v1.Service{}, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hcParams.interval != defaultHealthCheckInterval || hcParams.timeout != defaultHealthCheckTimeout ||
+		hcParams.healthyThreshold != defaultHealthCheckThreshold || hcParams.unhealthyThreshold != defaultHealthCheckThreshold {
+		t.Errorf("defaults should be used when annotations are absent, got %+v", hcParams)
+	}
+
+	hcParams, err = getHealthCheckParameters(&v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		healthCheckIntervalAnnotation:           "10s",
+		healthCheckTimeoutAnnotation:            "5s",
+		healthCheckHealthyThresholdAnnotation:   "3",
+		healthCheckUnhealthyThresholdAnnotation: "4",
+		healthCheckPathAnnotation:               "/ready",
+	}}}, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hcParams.interval != 10*time.Second || hcParams.timeout != 5*time.Second ||
+		hcParams.healthyThreshold != 3 || hcParams.unhealthyThreshold != 4 || hcParams.path != "/ready" {
+		t.Errorf("annotations should be applied, got %+v", hcParams)
+	}
+
+	for _, annotations := range []map[string]string{
+		{healthCheckIntervalAnnotation: "1s"},
+		{healthCheckIntervalAnnotation: "301s"},
+		{healthCheckIntervalAnnotation: "5s", healthCheckTimeoutAnnotation: "5s"},
+		{healthCheckHealthyThresholdAnnotation: "11"},
+		{healthCheckUnhealthyThresholdAnnotation: "two"},
+		{healthCheckPathAnnotation: "ready"},
+	} {
+		if _, err := getHealthCheckParameters(&v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}, defaults); err == nil {
+			t.Errorf("should return non-nil err on invalid annotations %v", annotations)
+		}
+	}
+}
+
+func TestNewHealthChecksConfigDefaults(t *testing.T) {
+	yc := &Cloud{config: CloudConfig{lbHealthCheckDefaults: healthCheckParameters{
+		interval:         10 * time.Second,
+		healthyThreshold: 5,
+		port:             10254,
+		path:             "/ready",
+	}}}
+	service := &v1.Service{Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer, Ports: []v1.ServicePort{{Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080}}}}
+
+	healthChecks, hcPort, err := newHealthChecks(service, yc.healthCheckDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	healthCheck := healthChecks[0]
+	if hcPort != 10254 || healthCheck.GetHttpOptions().GetPath() != "/ready" || healthCheck.Interval.Seconds != 10 ||
+		healthCheck.HealthyThreshold != 5 || healthCheck.UnhealthyThreshold != defaultHealthCheckThreshold {
+		t.Errorf("configured defaults should be used, falling back to the hardcoded ones, got port %d and %+v", hcPort, healthCheck)
+	}
+
+	service.Annotations = map[string]string{healthCheckIntervalAnnotation: "20s", healthCheckPathAnnotation: "/live"}
+	if healthChecks, _, err = newHealthChecks(service, yc.healthCheckDefaults()); err != nil {
+		t.Fatal(err)
+	}
+	if healthChecks[0].Interval.Seconds != 20 || healthChecks[0].GetHttpOptions().GetPath() != "/live" || healthChecks[0].HealthyThreshold != 5 {
+		t.Errorf("annotations should take precedence over configured defaults, got %+v", healthChecks[0])
+	}
+
+	service.Annotations = nil
+	service.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	service.Spec.HealthCheckNodePort = 31000
+	if _, hcPort, err = newHealthChecks(service, yc.healthCheckDefaults()); err != nil {
+		t.Fatal(err)
+	}
+	if hcPort != 31000 {
+		t.Errorf("Services with the Local traffic policy should be checked on their HealthCheckNodePort, got %d", hcPort)
+	}
+}
+
+func TestNewHealthChecksTrafficPolicy(t *testing.T) {
+	tcpDefaults := healthCheckParameters{protocol: healthCheckProtocolTCP, port: 10254}.withFallbacks()
+	httpDefaults := healthCheckParameters{path: "/ready"}.withFallbacks()
+
+	tests := []struct {
+		name         string
+		policy       v1.ServiceExternalTrafficPolicyType
+		hcNodePort   int32
+		annotations  map[string]string
+		defaults     healthCheckParameters
+		expectedPort int32
+		expectedPath string
+		expectError  bool
+	}{
+		{"Cluster", v1.ServiceExternalTrafficPolicyTypeCluster, 0, nil, healthCheckParameters{}.withFallbacks(), lbNodesHealthCheckPort, nodesHealthCheckPath, false},
+		{"Cluster with configured path", v1.ServiceExternalTrafficPolicyTypeCluster, 0, nil, httpDefaults, lbNodesHealthCheckPort, "/ready", false},
+		{"Cluster with TCP default", v1.ServiceExternalTrafficPolicyTypeCluster, 0, nil, tcpDefaults, 10254, "", false},
+		{"Local", v1.ServiceExternalTrafficPolicyTypeLocal, 31000, nil, healthCheckParameters{}.withFallbacks(), 31000, nodesHealthCheckPath, false},
+		{"Local ignores configured path", v1.ServiceExternalTrafficPolicyTypeLocal, 31000, nil, httpDefaults, 31000, nodesHealthCheckPath, false},
+		{"Local ignores TCP default", v1.ServiceExternalTrafficPolicyTypeLocal, 31000, nil, tcpDefaults, 31000, nodesHealthCheckPath, false},
+		{"Local with TCP annotation", v1.ServiceExternalTrafficPolicyTypeLocal, 31000, map[string]string{healthCheckProtocolAnnotation: "tcp"}, httpDefaults, 0, "", true},
+		{"Local with TCP annotation on a custom port", v1.ServiceExternalTrafficPolicyTypeLocal, 31000,
+			map[string]string{healthCheckProtocolAnnotation: "tcp", healthCheckPortAnnotation: "30080"}, httpDefaults, 30080, "", false},
+		{"Local without HealthCheckNodePort", v1.ServiceExternalTrafficPolicyTypeLocal, 0, nil, healthCheckParameters{}.withFallbacks(), lbNodesHealthCheckPort, nodesHealthCheckPath, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			service := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations},
+				Spec: v1.ServiceSpec{
+					Type:                  v1.ServiceTypeLoadBalancer,
+					ExternalTrafficPolicy: tc.policy,
+					HealthCheckNodePort:   tc.hcNodePort,
+					Ports:                 []v1.ServicePort{{Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080}},
+				},
+			}
+
+			healthChecks, hcPort, err := newHealthChecks(service, tc.defaults)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got health checks %+v", healthChecks)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hcPort != tc.expectedPort {
+				t.Errorf("expected port %d, got %d", tc.expectedPort, hcPort)
+			}
+			if len(tc.expectedPath) == 0 {
+				if tcpOptions := healthChecks[0].GetTcpOptions(); tcpOptions == nil || tcpOptions.Port != int64(tc.expectedPort) {
+					t.Errorf("expected a TCP health check on port %d, got %+v", tc.expectedPort, healthChecks[0])
+				}
+				return
+			}
+			if httpOptions := healthChecks[0].GetHttpOptions(); httpOptions == nil || httpOptions.Port != int64(tc.expectedPort) || httpOptions.Path != tc.expectedPath {
+				t.Errorf("expected an HTTP health check on %d%s, got %+v", tc.expectedPort, tc.expectedPath, healthChecks[0])
+			}
+		})
+	}
+}
+
+func TestListenerName(t *testing.T) {
+	tcpName := listenerName(v1.ServicePort{Name: "dns-tcp", Protocol: v1.ProtocolTCP, Port: 53})
+	udpName := listenerName(v1.ServicePort{Name: "dns-udp", Protocol: v1.ProtocolUDP, Port: 53})
+
+	if tcpName != "tcp-53" || udpName != "udp-53" {
+		t.Errorf("unexpected listener names %q and %q", tcpName, udpName)
+	}
+}
+
+func TestValidateServicePorts(t *testing.T) {
+	mixed := &v1.Service{Spec: v1.ServiceSpec{Ports: []v1.ServicePort{
+		{Protocol: v1.ProtocolTCP, Port: 53},
+		{Protocol: v1.ProtocolUDP, Port: 53},
+	}}}
+	if err := validateServicePorts(mixed); err != nil {
+		t.Errorf("TCP and UDP ports should be accepted, got %s", err)
+	}
+
+	sctp := mixed.DeepCopy()
+	sctp.Spec.Ports = append(sctp.Spec.Ports, v1.ServicePort{Protocol: v1.ProtocolSCTP, Port: 3868})
+	if err := validateServicePorts(sctp); err == nil || !strings.Contains(err.Error(), "SCTP") {
+		t.Errorf("SCTP port should be rejected with an explicit error, got %v", err)
+	}
+}
+
+func TestValidateSessionAffinity(t *testing.T) {
+	if err := validateSessionAffinity(&v1.Service{Spec: v1.ServiceSpec{SessionAffinity: v1.ServiceAffinityNone}}); err != nil {
+		t.Errorf("Services without session affinity should be accepted, got %s", err)
+	}
+	if err := validateSessionAffinity(&v1.Service{Spec: v1.ServiceSpec{SessionAffinity: v1.ServiceAffinityClientIP}}); err == nil {
+		t.Error("ClientIP session affinity should be rejected")
+	}
+}
+
+func TestFilterLoadBalancerNodes(t *testing.T) {
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "ingress", Labels: map[string]string{"role": "ingress"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "excluded", Labels: map[string]string{"role": "ingress", v1.LabelNodeExcludeBalancers: ""}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "gpu", Labels: map[string]string{"role": "gpu"}}},
+	}
+
+	yc := &Cloud{}
+	if ret := yc.filterLoadBalancerNodes(nodes); len(ret) != 2 {
+		t.Errorf("only the labeled Node should be excluded without a selector, got %d Nodes", len(ret))
+	}
+
+	yc.config.LbNodeSelector = labels.SelectorFromSet(labels.Set{"role": "ingress"})
+	if ret := yc.filterLoadBalancerNodes(nodes); len(ret) != 1 || ret[0].Name != "ingress" {
+		t.Errorf("only the matching Node without the exclusion label should be kept, got %d Nodes", len(ret))
+	}
+}
+
+func TestHandlesLoadBalancerClass(t *testing.T) {
+	class, otherClass := "yandex.cpi.flant.com/nlb", "example.com/lb"
+	for _, tc := range []struct {
+		config       CloudConfig
+		serviceClass *string
+		expected     bool
+	}{
+		{config: CloudConfig{}, serviceClass: nil, expected: true},
+		{config: CloudConfig{}, serviceClass: &class, expected: false},
+		{config: CloudConfig{LbClass: class}, serviceClass: nil, expected: true},
+		{config: CloudConfig{LbClass: class}, serviceClass: &class, expected: true},
+		{config: CloudConfig{LbClass: class}, serviceClass: &otherClass, expected: false},
+		{config: CloudConfig{LbClass: class, LbClassNotDefault: true}, serviceClass: nil, expected: false},
+		{config: CloudConfig{LbClass: class, LbClassNotDefault: true}, serviceClass: &class, expected: true},
+	} {
+		yc := &Cloud{config: tc.config}
+		service := &v1.Service{Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer, LoadBalancerClass: tc.serviceClass}}
+		if handled := yc.handlesLoadBalancerClass(service); handled != tc.expected {
+			t.Errorf("expected %v for class %v with config %+v, got %v", tc.expected, tc.serviceClass, tc.config, handled)
+		}
+	}
+
+	yc := &Cloud{config: CloudConfig{LbClass: class}}
+	service := &v1.Service{Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer, LoadBalancerClass: &otherClass}}
+	if _, err := yc.EnsureLoadBalancer(context.Background(), "", service, nil); err != cloudprovider.ImplementedElsewhere {
+		t.Errorf("Services of other classes should be left to other controllers, got %v", err)
+	}
+	if err := yc.EnsureLoadBalancerDeleted(context.Background(), "", service); err != cloudprovider.ImplementedElsewhere {
+		t.Errorf("Services of other classes should be left to other controllers, got %v", err)
+	}
+	if _, exists, err := yc.GetLoadBalancer(context.Background(), "", service); exists || err != nil {
+		t.Errorf("NLBs of Services of other classes should not be reported, got exists=%v, err=%v", exists, err)
+	}
+}
+
+func TestIgnoreAnnotation(t *testing.T) {
+	yc := &Cloud{}
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{ignoreAnnotation: "true"}},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+	}
+
+	if _, err := yc.EnsureLoadBalancer(context.Background(), "", service, nil); err != cloudprovider.ImplementedElsewhere {
+		t.Errorf("ignored Services should be left alone, got %v", err)
+	}
+	if err := yc.UpdateLoadBalancer(context.Background(), "", service, nil); err != cloudprovider.ImplementedElsewhere {
+		t.Errorf("ignored Services should be left alone, got %v", err)
+	}
+	if err := yc.EnsureLoadBalancerDeleted(context.Background(), "", service); err != cloudprovider.ImplementedElsewhere {
+		t.Errorf("NLBs of ignored Services should not be deleted, got %v", err)
+	}
+	if _, exists, err := yc.GetLoadBalancer(context.Background(), "", service); exists || err != nil {
+		t.Errorf("NLBs of ignored Services should not be reported, got exists=%v, err=%v", exists, err)
+	}
+
+	service.Annotations[ignoreAnnotation] = "false"
+	if !yc.managesLoadBalancer(service) {
+		t.Error("Services annotated with a value other than \"true\" should be managed")
+	}
+}
+
+func TestGetLoadBalancerParametersSharedName(t *testing.T) {
+	yc := &Cloud{config: CloudConfig{FolderID: "folder", lbTgNetworkID: "network"}}
+
+	lbParams, err := yc.getLoadBalancerParameters(&v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		sharedNameAnnotation: "shared-lb",
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lbParams.sharedName != "shared-lb" {
+		t.Errorf("unexpected shared name %q", lbParams.sharedName)
+	}
+
+	for _, service := range []*v1.Service{
+		{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{sharedNameAnnotation: "Shared_LB"}}},
+		{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{sharedNameAnnotation: "shared-lb"}},
+			Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer, ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyTypeLocal},
+		},
+		{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{sharedNameAnnotation: "shared-lb", folderIDAnnotation: "other"}}},
+	} {
+		if _, err := yc.getLoadBalancerParameters(service); err == nil {
+			t.Errorf("should return non-nil err on annotations %v", service.Annotations)
+		}
+	}
+}
+
+func TestGetLoadBalancerName(t *testing.T) {
+	yc := &Cloud{}
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{UID: "0f2f5b2a-5c6e-4a3b-9d7e-2a1b3c4d5e6f"}}
+
+	if name := yc.GetLoadBalancerName(context.Background(), "", service); name != defaultLoadBalancerName(service) {
+		t.Errorf("default name expected, got %q", name)
+	}
+
+	service.Annotations = map[string]string{nameAnnotation: "ingress-nginx"}
+	if name := yc.GetLoadBalancerName(context.Background(), "", service); name != "ingress-nginx" {
+		t.Errorf("name from the annotation expected, got %q", name)
+	}
+
+	service.Annotations = map[string]string{nameAnnotation: "Ingress_Nginx"}
+	if name := yc.GetLoadBalancerName(context.Background(), "", service); name != defaultLoadBalancerName(service) {
+		t.Errorf("default name expected for an invalid annotation, got %q", name)
+	}
+}
+
+func TestSourceRangesRuleSpecs(t *testing.T) {
+	service := &v1.Service{Spec: v1.ServiceSpec{Ports: []v1.ServicePort{
+		{Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080},
+		{Protocol: v1.ProtocolUDP, Port: 53, NodePort: 30053},
+	}}}
+
+	ruleSpecs := sourceRangesRuleSpecs(service, []string{"10.0.0.0/8", "2001:db8::/32"})
+	if len(ruleSpecs) != 2 {
+		t.Fatalf("expected a rule per Service port, got %d", len(ruleSpecs))
+	}
+	for i, ruleSpec := range ruleSpecs {
+		nodePort := int64(service.Spec.Ports[i].NodePort)
+		if ruleSpec.Ports.FromPort != nodePort || ruleSpec.Ports.ToPort != nodePort {
+			t.Errorf("rule %d should allow NodePort %d, got %+v", i, nodePort, ruleSpec.Ports)
+		}
+		if ruleSpec.GetProtocolName() != string(service.Spec.Ports[i].Protocol) {
+			t.Errorf("rule %d has unexpected protocol %q", i, ruleSpec.GetProtocolName())
+		}
+		cidrBlocks := ruleSpec.GetCidrBlocks()
+		if len(cidrBlocks.V4CidrBlocks) != 1 || cidrBlocks.V4CidrBlocks[0] != "10.0.0.0/8" ||
+			len(cidrBlocks.V6CidrBlocks) != 1 || cidrBlocks.V6CidrBlocks[0] != "2001:db8::/32" {
+			t.Errorf("rule %d has unexpected CIDR blocks %+v", i, cidrBlocks)
+		}
+	}
+}
+
+func TestNewListenerSpecIPFamilies(t *testing.T) {
+	service := &v1.Service{Spec: v1.ServiceSpec{IPFamilies: []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}}}
+	svcPort := v1.ServicePort{Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080}
+	lbParams := loadBalancerParameters{listenerAddressIPv4: "203.0.113.10"}
+
+	ipv4Spec := newListenerSpec(service, svcPort, v1.IPv4Protocol, lbParams)
+	if ipv4Spec.Name != "tcp-80" || ipv4Spec.GetExternalAddressSpec().Address != "203.0.113.10" ||
+		ipv4Spec.GetExternalAddressSpec().IpVersion != loadbalancer.IpVersion_IPV4 {
+		t.Errorf("IPv4 Listener should keep its name and requested address, got %+v", ipv4Spec)
+	}
+
+	ipv6Spec := newListenerSpec(service, svcPort, v1.IPv6Protocol, lbParams)
+	if ipv6Spec.Name != "tcp-80-ipv6" || ipv6Spec.GetExternalAddressSpec().Address != "" ||
+		ipv6Spec.GetExternalAddressSpec().IpVersion != loadbalancer.IpVersion_IPV6 {
+		t.Errorf("IPv6 Listener should be named after its family and not use the IPv4 address, got %+v", ipv6Spec)
+	}
+
+	if families := getServiceIPFamilies(&v1.Service{}); len(families) != 1 || families[0] != v1.IPv4Protocol {
+		t.Errorf("Services without IPFamilies should get IPv4 Listeners, got %v", families)
+	}
+}
+
+func TestGetLoadBalancerParametersProxyProtocol(t *testing.T) {
+	yc := &Cloud{config: CloudConfig{FolderID: "folder", lbTgNetworkID: "network"}}
+
+	for _, value := range []string{"true", "yes"} {
+		_, err := yc.getLoadBalancerParameters(&v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+			proxyProtocolAnnotation: value,
+		}}})
+		if err == nil || !strings.Contains(err.Error(), proxyProtocolAnnotation) {
+			t.Errorf("should return an error naming the annotation on value %q, got %v", value, err)
+		}
+	}
+
+	if _, err := yc.getLoadBalancerParameters(&v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		proxyProtocolAnnotation: "false",
+	}}}); err != nil {
+		t.Errorf("disabled PROXY protocol should be accepted, got %v", err)
+	}
+}
+
+func TestGetLoadBalancerParametersTargetGroupID(t *testing.T) {
+	yc := &Cloud{config: CloudConfig{FolderID: "folder", lbTgNetworkID: "network"}}
+
+	lbParams, err := yc.getLoadBalancerParameters(&v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		targetGroupIDAnnotation: "tg1",
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lbParams.targetGroupID != "tg1" {
+		t.Errorf("unexpected TargetGroup ID %q", lbParams.targetGroupID)
+	}
+	if yc.usesDedicatedTargetGroup(&v1.Service{}, lbParams) {
+		t.Error("Services attached to an external TargetGroup should not get a dedicated one")
+	}
+
+	for _, annotations := range []map[string]string{
+		{targetGroupIDAnnotation: ""},
+		{targetGroupIDAnnotation: "tg1", sharedNameAnnotation: "shared-lb"},
+	} {
+		if _, err := yc.getLoadBalancerParameters(&v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}); err == nil {
+			t.Errorf("should return non-nil err on annotations %v", annotations)
+		}
+	}
+}
+
+func TestValidateExternalTargetGroup(t *testing.T) {
+	tgClient := &fakeTargetGroupClient{targetGroups: map[string]*loadbalancer.TargetGroup{
+		"external":      {Id: "external", FolderId: "folder", Name: "ingress", Targets: []*loadbalancer.Target{{SubnetId: "subnet-a"}, {SubnetId: "subnet-a"}}},
+		"other-folder":  {Id: "other-folder", FolderId: "other", Name: "ingress"},
+		"other-network": {Id: "other-network", FolderId: "folder", Name: "ingress", Targets: []*loadbalancer.Target{{SubnetId: "subnet-b"}}},
+		"cluster-named": {Id: "cluster-named", FolderId: "folder", Name: "clusternetwork"},
+		"cluster-owned": {Id: "cluster-owned", FolderId: "folder", Name: "ingress", Labels: map[string]string{clusterNameLabel: "another"}},
+	}}
+	subnetClient := &fakeSubnetClient{subnets: map[string]*vpc.Subnet{
+		"subnet-a": {Id: "subnet-a", NetworkId: "network"},
+		"subnet-b": {Id: "subnet-b", NetworkId: "other"},
+	}}
+	yc := &Cloud{
+		yandexService: &yapi.YandexCloudAPI{
+			LbSvc:  yapi.NewLoadBalancerService(nil, tgClient, &yapi.CloudContext{}),
+			VPCSvc: yapi.NewVPCService(nil, subnetClient, nil, nil, &yapi.CloudContext{}),
+		},
+		config: CloudConfig{FolderID: "folder", ClusterName: "cluster"},
+	}
+
+	lbParams := loadBalancerParameters{folderID: "folder", targetGroupNetworkID: "network", targetGroupID: "external"}
+	if err := yc.validateExternalTargetGroup(context.Background(), lbParams); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tgID := range []string{"missing", "other-folder", "other-network", "cluster-named", "cluster-owned"} {
+		lbParams.targetGroupID = tgID
+		if err := yc.validateExternalTargetGroup(context.Background(), lbParams); err == nil {
+			t.Errorf("should return non-nil err on TargetGroup %q", tgID)
+		}
+	}
+}
+
+func TestGetLoadBalancerParametersSubnetIDs(t *testing.T) {
+	yc := &Cloud{config: CloudConfig{FolderID: "folder", lbTgNetworkID: "network", lbListenerSubnetID: "default-subnet"}}
+
+	lbParams, err := yc.getLoadBalancerParameters(&v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		listenerSubnetIDsAnnotation: "subnet-a, subnet-b",
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lbParams.internal || !lbParams.pinnedListenerSubnets ||
+		len(lbParams.listenerSubnetIDs) != 2 || lbParams.listenerSubnetIDs[0] != "subnet-a" || lbParams.listenerSubnetIDs[1] != "subnet-b" {
+		t.Errorf("unexpected listener Subnets %v, internal %v", lbParams.listenerSubnetIDs, lbParams.internal)
+	}
+
+	service := &v1.Service{Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer, Ports: []v1.ServicePort{{Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080}}}}
+	listenerSpecs := newListenerSpecs(service, service.Spec.Ports[0], v1.IPv4Protocol, lbParams)
+	if len(listenerSpecs) != 2 ||
+		listenerSpecs[0].Name != "tcp-80" || listenerSpecs[0].GetInternalAddressSpec().SubnetId != "subnet-a" ||
+		listenerSpecs[1].Name != "tcp-80-subnet-b" || listenerSpecs[1].GetInternalAddressSpec().SubnetId != "subnet-b" {
+		t.Errorf("a Listener per Subnet should be created, got %+v", listenerSpecs)
+	}
+
+	for _, annotations := range []map[string]string{
+		{listenerSubnetIDsAnnotation: " , "},
+		{listenerSubnetIDsAnnotation: "subnet-a", listenerSubnetIdAnnotation: "subnet-b"},
+		{listenerSubnetIDsAnnotation: "subnet-a,subnet-b", sharedNameAnnotation: "shared-lb"},
+		{listenerSubnetIDsAnnotation: "subnet-a,subnet-b", listenerAddressIPv4: "10.0.0.10"},
+		{listenerSubnetIDsAnnotation: "subnet-a", loadBalancerTypeAnnotation: loadBalancerTypeExternal},
+	} {
+		if _, err := yc.getLoadBalancerParameters(&v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}); err == nil {
+			t.Errorf("should return non-nil err on annotations %v", annotations)
+		}
+	}
+}
+
+func TestNewHealthChecksPortProtocol(t *testing.T) {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+			healthCheckPortAnnotation:     "30081",
+			healthCheckProtocolAnnotation: "tcp",
+		}},
+		Spec: v1.ServiceSpec{Ports: []v1.ServicePort{
+			{Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080},
+			{Protocol: v1.ProtocolTCP, Port: 8081, NodePort: 30081},
+		}},
+	}
+
+	healthChecks, hcPort, err := newHealthChecks(service, healthCheckParameters{}.withFallbacks())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hcPort != 30081 || healthChecks[0].GetTcpOptions() == nil || healthChecks[0].GetTcpOptions().Port != 30081 {
+		t.Errorf("TCP health check on the annotated port is expected, got port %d and %+v", hcPort, healthChecks[0])
+	}
+
+	service.Annotations = map[string]string{healthCheckPortAnnotation: "30080"}
+	if healthChecks, hcPort, err = newHealthChecks(service, healthCheckParameters{}.withFallbacks()); err != nil {
+		t.Fatal(err)
+	}
+	if httpOptions := healthChecks[0].GetHttpOptions(); hcPort != 30080 || httpOptions == nil || httpOptions.Port != 30080 || httpOptions.Path != nodesHealthCheckPath {
+		t.Errorf("HTTP health check on the annotated port is expected, got port %d and %+v", hcPort, healthChecks[0])
+	}
+
+	for _, annotations := range []map[string]string{
+		{healthCheckPortAnnotation: "30082"},
+		{healthCheckPortAnnotation: "http"},
+		{healthCheckProtocolAnnotation: "UDP"},
+		{healthCheckProtocolAnnotation: "TCP", healthCheckPathAnnotation: "/ready"},
+	} {
+		service.Annotations = annotations
+		if _, err := getHealthCheckParameters(service, healthCheckParameters{}.withFallbacks()); err == nil {
+			t.Errorf("should return non-nil err on invalid annotations %v", annotations)
+		}
+	}
+}
+
+func TestParseLabelsAnnotation(t *testing.T) {
+	for _, value := range []string{"team=billing, env=prod", `{"team": "billing", "env": "prod"}`} {
+		labels, err := parseLabelsAnnotation(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(labels) != 2 || labels["team"] != "billing" || labels["env"] != "prod" {
+			t.Errorf("unexpected labels %v parsed from %q", labels, value)
+		}
+	}
+
+	for _, value := range []string{"team", "Team=billing", "team=Billing", `{"team": 1}`, clusterNameLabel + "=other", serviceUIDLabel + "=uid", serviceNameLabel + "=name"} {
+		if _, err := parseLabelsAnnotation(value); err == nil {
+			t.Errorf("should return non-nil err on %q", value)
+		}
+	}
+
+	yc := &Cloud{config: CloudConfig{FolderID: "folder", lbTgNetworkID: "network", ClusterName: "cluster"}}
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{UID: "uid", Namespace: "default", Name: "web", Annotations: map[string]string{labelsAnnotation: "team=billing"}}}
+	lbParams, err := yc.getLoadBalancerParameters(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{clusterNameLabel: "cluster", serviceUIDLabel: "uid", serviceNamespaceLabel: "default", serviceNameLabel: "web", "team": "billing"}
+	if labels := yc.serviceLBLabels(service, lbParams); !reflect.DeepEqual(labels, expected) {
+		t.Errorf("custom labels should be merged with the identity ones, got %v", labels)
+	}
+	if labelsContain(map[string]string{clusterNameLabel: "cluster", serviceUIDLabel: "uid"}, expected) {
+		t.Errorf("labels missing the custom one should be reported outdated")
+	}
+
+	service.Annotations[sharedNameAnnotation] = "shared-lb"
+	if _, err := yc.getLoadBalancerParameters(service); err == nil {
+		t.Errorf("should return non-nil err on labels of a shared NLB")
+	}
+}
+
+func TestGetLoadBalancerAfterRename(t *testing.T) {
+	nlbClient := &fakeNLBClient{loadBalancers: []*loadbalancer.NetworkLoadBalancer{
+		{
+			Name:      "old-name",
+			Labels:    map[string]string{clusterNameLabel: "cluster", serviceUIDLabel: "uid"},
+			Listeners: []*loadbalancer.Listener{{Name: "tcp-80", Address: "203.0.113.10", Port: 80, Protocol: loadbalancer.Listener_TCP}},
+		},
+		{
+			Name:      "taken",
+			Labels:    map[string]string{clusterNameLabel: "cluster", serviceUIDLabel: "other-uid"},
+			Listeners: []*loadbalancer.Listener{{Name: "tcp-80", Address: "203.0.113.20", Port: 80, Protocol: loadbalancer.Listener_TCP}},
+		},
+	}}
+	yc := &Cloud{
+		yandexService: &yapi.YandexCloudAPI{LbSvc: yapi.NewLoadBalancerService(nlbClient, nil, &yapi.CloudContext{})},
+		config:        CloudConfig{FolderID: "folder", ClusterName: "cluster"},
+	}
+
+	for _, name := range []string{"new-name", "taken"} {
+		service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "uid", Annotations: map[string]string{nameAnnotation: name}}}
+		lbStatus, exists, err := yc.GetLoadBalancer(context.Background(), "", service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists || len(lbStatus.Ingress) != 1 || lbStatus.Ingress[0].IP != "203.0.113.10" {
+			t.Errorf("expected the NLB labeled with the Service UID to be found with name annotation %q, got %v", name, lbStatus)
+		}
+	}
+
+	_, exists, err := yc.GetLoadBalancer(context.Background(), "", &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "other", UID: "missing-uid"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Error("Services without an NLB should not have one reported")
+	}
+}
+
+func TestGetLoadBalancerDualStack(t *testing.T) {
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "uid"}}
+	sharingService := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "api", UID: "api-uid", Annotations: map[string]string{sharedNameAnnotation: "shared"}}}
+	prefix := sharedListenerPrefix(sharingService)
+	nlbClient := &fakeNLBClient{loadBalancers: []*loadbalancer.NetworkLoadBalancer{
+		{
+			Name:   defaultLoadBalancerName(service),
+			Labels: map[string]string{clusterNameLabel: "cluster", serviceUIDLabel: "uid"},
+			Listeners: []*loadbalancer.Listener{
+				{Name: "tcp-80-ipv6", Address: "2001:db8::1", Port: 80},
+				{Name: "tcp-80", Address: "203.0.113.10", Port: 80},
+				{Name: "tcp-443", Address: "203.0.113.10", Port: 443},
+				{Name: "tcp-443-ipv6", Address: "2001:db8::1", Port: 443},
+			},
+		},
+		{
+			Name:   "shared",
+			Labels: map[string]string{clusterNameLabel: "cluster"},
+			Listeners: []*loadbalancer.Listener{
+				{Name: "other-tcp-80", Address: "203.0.113.20", Port: 80},
+				{Name: prefix + "tcp-8080", Address: "203.0.113.30", Port: 8080},
+			},
+		},
+	}}
+	yc := &Cloud{
+		yandexService: &yapi.YandexCloudAPI{LbSvc: yapi.NewLoadBalancerService(nlbClient, nil, &yapi.CloudContext{})},
+		config:        CloudConfig{FolderID: "folder", ClusterName: "cluster"},
+	}
+
+	tests := []struct {
+		service  *v1.Service
+		expected []v1.LoadBalancerIngress
+	}{
+		{service, []v1.LoadBalancerIngress{{IP: "203.0.113.10"}, {IP: "2001:db8::1"}}},
+		{sharingService, []v1.LoadBalancerIngress{{IP: "203.0.113.30"}}},
+	}
+
+	for _, tc := range tests {
+		lbStatus, exists, err := yc.GetLoadBalancer(context.Background(), "", tc.service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists || !reflect.DeepEqual(lbStatus.Ingress, tc.expected) {
+			t.Errorf("expected ingress %v of Service %q, got %v", tc.expected, tc.service.Name, lbStatus.Ingress)
+		}
+	}
+}
+
+func TestUpdateLoadBalancer(t *testing.T) {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "uid"},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080}},
+		},
+	}
+	nodes := []*v1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}}}
+
+	newCloud := func(lb *loadbalancer.NetworkLoadBalancer) (*Cloud, *fakeNLBClient) {
+		nlbClient := &fakeNLBClient{loadBalancers: []*loadbalancer.NetworkLoadBalancer{lb}}
+		tgClient := &fakeTargetGroupClient{targetGroups: map[string]*loadbalancer.TargetGroup{
+			"tg-shared": {Id: "tg-shared", Name: "clusternetwork"},
+		}}
+		cloudCtx := &yapi.CloudContext{OperationWaiter: fakeOperationWaiter}
+		yc := &Cloud{
+			yandexService: &yapi.YandexCloudAPI{
+				LbSvc:  yapi.NewLoadBalancerService(nlbClient, tgClient, cloudCtx),
+				VPCSvc: yapi.NewVPCService(nil, nil, nil, &fakeSecurityGroupClient{}, cloudCtx),
+			},
+			lbWorkers: newLBWorkers(0),
+			config:    CloudConfig{FolderID: "folder", ClusterName: "cluster", lbTgNetworkID: "network"},
+		}
+		yc.nodeTargetGroupSyncer = &NodeTargetGroupSyncer{
+			cloud:         yc,
+			serviceLister: corev1listers.NewServiceLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+			// the shared TargetGroup is up to date with the Nodes
+			lastVisitedNodes: mapset.NewSetFromSlice(fromNodeToInterfaceSlice(nodes)),
+		}
+
+		return yc, nlbClient
+	}
+
+	// convergedLB returns the NLB as EnsureLoadBalancer leaves it
+	convergedLB := func() *loadbalancer.NetworkLoadBalancer {
+		yc, _ := newCloud(nil)
+		lbParams, err := yc.getLoadBalancerParameters(service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		healthChecks, _, err := newHealthChecks(service, yc.healthCheckDefaults())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return &loadbalancer.NetworkLoadBalancer{
+			Id:                   "nlb",
+			Name:                 yc.GetLoadBalancerName(context.Background(), "", service),
+			Type:                 loadbalancer.NetworkLoadBalancer_EXTERNAL,
+			Labels:               yc.serviceLBLabels(service, lbParams),
+			Listeners:            []*loadbalancer.Listener{{Name: "tcp-80", Address: "203.0.113.10", Port: 80, TargetPort: 30080, Protocol: loadbalancer.Listener_TCP}},
+			AttachedTargetGroups: []*loadbalancer.AttachedTargetGroup{{TargetGroupId: "tg-shared", HealthChecks: healthChecks}},
+		}
+	}
+
+	tests := []struct {
+		name              string
+		modify            func(lb *loadbalancer.NetworkLoadBalancer)
+		expectedMutations []string
+	}{
+		{"up to date", func(*loadbalancer.NetworkLoadBalancer) {}, nil},
+		{"TargetGroup detached", func(lb *loadbalancer.NetworkLoadBalancer) {
+			lb.AttachedTargetGroups = nil
+		}, []string{"AttachTargetGroup"}},
+		{"outdated health checks", func(lb *loadbalancer.NetworkLoadBalancer) {
+			lb.AttachedTargetGroups[0].HealthChecks[0].HealthyThreshold++
+		}, []string{"Update"}},
+		{"outdated labels", func(lb *loadbalancer.NetworkLoadBalancer) {
+			delete(lb.Labels, serviceNameLabel)
+		}, []string{"Update"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			lb := convergedLB()
+			tc.modify(lb)
+			yc, nlbClient := newCloud(lb)
+
+			if err := yc.UpdateLoadBalancer(context.Background(), "", service, nodes); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(nlbClient.mutations, tc.expectedMutations) {
+				t.Errorf("expected NLB mutations %v, got %v", tc.expectedMutations, nlbClient.mutations)
+			}
+
+			// the full reconciliation converges, so the next update takes the targeted path
+			nlbClient.mutations = nil
+			if err := yc.UpdateLoadBalancer(context.Background(), "", service, nodes); err != nil {
+				t.Fatal(err)
+			}
+			if len(nlbClient.mutations) != 0 {
+				t.Errorf("converged NLB should not be mutated, got %v", nlbClient.mutations)
+			}
+		})
+	}
+
+	t.Run("NLB of another Service", func(t *testing.T) {
+		lb := convergedLB()
+		lb.Labels[serviceUIDLabel] = "other-uid"
+		yc, nlbClient := newCloud(lb)
+
+		if err := yc.UpdateLoadBalancer(context.Background(), "", service, nodes); err == nil || !strings.Contains(err.Error(), "another Service") {
+			t.Errorf("should refuse to update the NLB of another Service, got %v", err)
+		}
+		if len(nlbClient.mutations) != 0 {
+			t.Errorf("NLB of another Service should not be mutated, got %v", nlbClient.mutations)
+		}
+		if sgClient := yc.yandexService.VPCSvc.SecurityGroupSvc.(*fakeSecurityGroupClient); sgClient.lists != 0 {
+			t.Error("SecurityGroups of the Nodes should not be reconciled for the NLB of another Service")
+		}
+	})
+}
+
+func TestEnsureLoadBalancerDeletedNameCollision(t *testing.T) {
+	nlbClient := &fakeNLBClient{loadBalancers: []*loadbalancer.NetworkLoadBalancer{{
+		Id:     "nlb",
+		Name:   "web",
+		Labels: map[string]string{clusterNameLabel: "cluster", serviceUIDLabel: "uid"},
+	}}}
+	cloudCtx := &yapi.CloudContext{OperationWaiter: fakeOperationWaiter}
+	yc := &Cloud{
+		yandexService: &yapi.YandexCloudAPI{
+			LbSvc:  yapi.NewLoadBalancerService(nlbClient, &fakeTargetGroupClient{}, cloudCtx),
+			VPCSvc: yapi.NewVPCService(nil, nil, nil, &fakeSecurityGroupClient{}, cloudCtx),
+		},
+		lbWorkers: newLBWorkers(0),
+		config:    CloudConfig{FolderID: "folder", ClusterName: "cluster"},
+	}
+	yc.nodeTargetGroupSyncer = &NodeTargetGroupSyncer{
+		cloud:            yc,
+		serviceLister:    corev1listers.NewServiceLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+		lastVisitedNodes: mapset.NewSet(),
+	}
+
+	owner := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "uid", Annotations: map[string]string{nameAnnotation: "web"}}}
+	other := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "other", UID: "other-uid", Annotations: map[string]string{nameAnnotation: "web"}}}
+
+	if err := yc.EnsureLoadBalancerDeleted(context.Background(), "", other); err != nil {
+		t.Fatal(err)
+	}
+	if len(nlbClient.mutations) != 0 || len(nlbClient.loadBalancers) != 1 {
+		t.Fatalf("NLB of another Service should be left in place, got mutations %v", nlbClient.mutations)
+	}
+
+	if err := yc.EnsureLoadBalancerDeleted(context.Background(), "", owner); err != nil {
+		t.Fatal(err)
+	}
+	if len(nlbClient.loadBalancers) != 0 {
+		t.Error("NLB should be deleted along with its Service")
+	}
+}
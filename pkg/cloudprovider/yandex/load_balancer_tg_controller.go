@@ -3,7 +3,7 @@ package yandex
 import (
 	"context"
 	"fmt"
-	"log"
+	"strings"
 	"sync"
 
 	"k8s.io/klog/v2"
@@ -11,11 +11,8 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/pkg/errors"
-	"github.com/yandex-cloud/go-genproto/yandex/cloud/compute/v1"
 	"github.com/yandex-cloud/go-genproto/yandex/cloud/loadbalancer/v1"
-	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/types"
 
 	corev1listers "k8s.io/client-go/listers/core/v1"
 
@@ -45,7 +42,7 @@ func (ntgs *NodeTargetGroupSyncer) SyncTGs(ctx context.Context, nodes []*corev1.
 
 	var activeLoadBalancerServicesExist bool
 	for _, service := range services {
-		if service.Spec.Type == corev1.ServiceTypeLoadBalancer && service.ObjectMeta.DeletionTimestamp == nil {
+		if service.Spec.Type == corev1.ServiceTypeLoadBalancer && service.ObjectMeta.DeletionTimestamp == nil && ntgs.cloud.managesLoadBalancer(service) {
 			activeLoadBalancerServicesExist = true
 			break
 		}
@@ -75,7 +72,7 @@ func fromNodeToInterfaceSlice(nodes []*corev1.Node) (ret []interface{}) {
 }
 
 func (ntgs *NodeTargetGroupSyncer) cleanUpTargetGroups(ctx context.Context) error {
-	tgs, err := ntgs.cloud.yandexService.LbSvc.GetTGsByClusterName(ctx, ntgs.cloud.config.ClusterName)
+	tgs, err := ntgs.cloud.yandexService.LbSvc.GetTGsByClusterName(ctx, ntgs.cloud.config.FolderID, ntgs.cloud.config.ClusterName)
 	if err != nil {
 		return err
 	}
@@ -99,7 +96,7 @@ func (ntgs *NodeTargetGroupSyncer) cleanUpTargetGroups(ctx context.Context) erro
 
 func (ntgs *NodeTargetGroupSyncer) synchronizeNodesWithTargetGroups(ctx context.Context, nodes []*corev1.Node) error {
 	if len(nodes) == 0 {
-		klog.Info("no nodes to synchronize TGs with, skipping...")
+		klog.InfoS("No nodes to synchronize TGs with, skipping")
 		return nil
 	}
 
@@ -108,26 +105,13 @@ func (ntgs *NodeTargetGroupSyncer) synchronizeNodesWithTargetGroups(ctx context.
 		return nil
 	}
 
-	// TODO: speed up by not performing individual lookups
-	var instances []*compute.Instance
-	for _, node := range nodes {
-		nodeName := MapNodeNameToInstanceName(types.NodeName(node.Name))
-		log.Printf("Finding Instance by Folder %q and Name %q", ntgs.cloud.config.FolderID, nodeName)
-		instance, err := ntgs.cloud.yandexService.ComputeSvc.FindInstanceByName(ctx, nodeName)
-		if err != nil || instance == nil {
-			return fmt.Errorf("failed to find Instance by its name: %s", err)
-		}
-
-		instances = append(instances, instance)
-	}
-
-	mapping, err := ntgs.constructNetworkIdToTargetMap(ctx, instances)
+	mapping, err := ntgs.constructNetworkIdToTargetMap(ctx, nodes)
 	if err != nil {
 		return fmt.Errorf("failed to construct NetworkIdToTargetMap: %s", err)
 	}
 
 	for networkID, targets := range mapping {
-		_, err := ntgs.cloud.yandexService.LbSvc.CreateOrUpdateTG(ctx, ntgs.cloud.config.ClusterName+networkID, targets)
+		_, err := ntgs.cloud.yandexService.LbSvc.CreateOrUpdateTG(ctx, ntgs.cloud.config.FolderID, ntgs.cloud.config.ClusterName+networkID, ntgs.cloud.clusterLabels(nil), targets)
 		if err != nil {
 			return err
 		}
@@ -138,20 +122,68 @@ func (ntgs *NodeTargetGroupSyncer) synchronizeNodesWithTargetGroups(ctx context.
 	return nil
 }
 
-func (ntgs *NodeTargetGroupSyncer) constructNetworkIdToTargetMap(ctx context.Context, instances []*compute.Instance) (networkIdToTargetMap, error) {
+// SyncServiceTG creates or updates a TargetGroup dedicated to a single Service from the Nodes' interfaces in the networkID
+func (ntgs *NodeTargetGroupSyncer) SyncServiceTG(ctx context.Context, folderID, tgName, networkID string, labels map[string]string, nodes []*corev1.Node) (string, error) {
+	mapping, err := ntgs.constructNetworkIdToTargetMap(ctx, nodes)
+	if err != nil {
+		return "", fmt.Errorf("failed to construct NetworkIdToTargetMap: %s", err)
+	}
+	if len(mapping[networkID]) == 0 {
+		return "", fmt.Errorf("no Targets found in Network %q", networkID)
+	}
+
+	return ntgs.cloud.yandexService.LbSvc.CreateOrUpdateTG(ctx, folderID, tgName, labels, mapping[networkID])
+}
+
+// RemoveServiceTGs removes TargetGroups dedicated to the Service with the lbName from the Folder
+func (ntgs *NodeTargetGroupSyncer) RemoveServiceTGs(ctx context.Context, folderID, lbName string) error {
+	tgs, err := ntgs.cloud.yandexService.LbSvc.GetTGsByClusterName(ctx, folderID, ntgs.cloud.config.ClusterName)
+	if err != nil {
+		return err
+	}
+
+	for _, tg := range tgs {
+		if !strings.HasSuffix(tg.Name, serviceTargetGroupSuffix(lbName)) {
+			continue
+		}
+
+		if err := ntgs.cloud.yandexService.LbSvc.RemoveTGByID(ctx, tg.Id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// serviceTargetGroupName returns the name of a TargetGroup dedicated to a single Service,
+// so that it's matched by the ClusterName prefix when cleaning up TargetGroups
+func (ntgs *NodeTargetGroupSyncer) serviceTargetGroupName(networkID, lbName string) string {
+	return ntgs.cloud.config.ClusterName + networkID + serviceTargetGroupSuffix(lbName)
+}
+
+func serviceTargetGroupSuffix(lbName string) string {
+	return "-" + lbName
+}
+
+// constructNetworkIdToTargetMap groups primary IPv4 addresses of the Nodes' interfaces into Targets by Network,
+// Instances and Subnet Networks are resolved via the caches shared with route next hop resolution
+func (ntgs *NodeTargetGroupSyncer) constructNetworkIdToTargetMap(ctx context.Context, nodes []*corev1.Node) (networkIdToTargetMap, error) {
 	mapping := make(networkIdToTargetMap)
 
-	// TODO: Implement simple caching mechanism for subnet-VPC membership lookups
-	for _, instance := range instances {
-		for _, iface := range instance.NetworkInterfaces {
-			subnetInfo, err := ntgs.cloud.yandexService.VPCSvc.SubnetSvc.Get(ctx, &vpc.GetSubnetRequest{SubnetId: iface.SubnetId})
-			if err != nil {
-				return nil, errors.WithStack(err)
+	for _, node := range nodes {
+		interfaces, err := ntgs.cloud.getNodeInterfaces(ctx, node)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, nodeIface := range interfaces {
+			if len(nodeIface.ipv4()) == 0 {
+				continue
 			}
 
-			mapping[subnetInfo.NetworkId] = append(mapping[subnetInfo.NetworkId], &loadbalancer.Target{
-				SubnetId: iface.SubnetId,
-				Address:  iface.PrimaryV4Address.Address,
+			mapping[nodeIface.networkID] = append(mapping[nodeIface.networkID], &loadbalancer.Target{
+				SubnetId: nodeIface.iface.SubnetId,
+				Address:  nodeIface.ipv4(),
 			})
 		}
 	}
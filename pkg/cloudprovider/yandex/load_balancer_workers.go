@@ -0,0 +1,82 @@
+package yandex
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/yapi"
+)
+
+// defaultLbConcurrency is how many NLBs are reconciled at once
+const defaultLbConcurrency = 10
+
+// lbWorkers bounds the number of NLBs reconciled concurrently by the service controller workers
+// and serializes reconciles of the same NLB, like RouteTable locks do for route operations
+type lbWorkers struct {
+	slots chan struct{}
+
+	mu    sync.Mutex
+	locks map[string]*lbLock
+}
+
+// lbLock is dropped once no reconcile holds or waits for it, so that locks of deleted NLBs don't pile up
+type lbLock struct {
+	lock contextLock
+	refs int
+}
+
+func newLBWorkers(concurrency int) *lbWorkers {
+	if concurrency <= 0 {
+		concurrency = defaultLbConcurrency
+	}
+
+	return &lbWorkers{
+		slots: make(chan struct{}, concurrency),
+		locks: make(map[string]*lbLock),
+	}
+}
+
+// acquire blocks until the NLB is not reconciled by anyone else and a worker slot is free.
+// The NLB lock is taken first, so that reconciles waiting for the same NLB don't occupy worker slots.
+func (w *lbWorkers) acquire(ctx context.Context, nlbName string) (release func(), err error) {
+	w.mu.Lock()
+	l, ok := w.locks[nlbName]
+	if !ok {
+		l = &lbLock{lock: newContextLock()}
+		w.locks[nlbName] = l
+	}
+	l.refs++
+	w.mu.Unlock()
+
+	unref := func() {
+		w.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(w.locks, nlbName)
+		}
+		w.mu.Unlock()
+	}
+
+	if err := l.lock.Lock(ctx); err != nil {
+		unref()
+		return nil, yapi.NewError(yapi.ErrTransient, errors.Wrapf(err, "NLB %q is being reconciled", nlbName))
+	}
+
+	select {
+	case w.slots <- struct{}{}:
+	case <-ctx.Done():
+		l.lock.Unlock()
+		unref()
+		return nil, yapi.NewError(yapi.ErrTransient, errors.Wrapf(ctx.Err(), "no free workers to reconcile NLB %q", nlbName))
+	}
+	lbReconcilesInFlight.Inc()
+
+	return func() {
+		lbReconcilesInFlight.Dec()
+		<-w.slots
+		l.lock.Unlock()
+		unref()
+	}, nil
+}
@@ -0,0 +1,37 @@
+package yandex
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLBWorkers(t *testing.T) {
+	workers := newLBWorkers(1)
+
+	release, err := workers.acquire(context.Background(), "lb-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := workers.acquire(ctx, "lb-a"); err == nil {
+		t.Errorf("reconciles of the same NLB should be serialized")
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := workers.acquire(ctx, "lb-b"); err == nil {
+		t.Errorf("reconciles beyond the concurrency should wait for a free worker")
+	}
+
+	release()
+	if len(workers.locks) != 0 {
+		t.Errorf("locks of NLBs not being reconciled should be dropped, got %v", workers.locks)
+	}
+	release, err = workers.acquire(context.Background(), "lb-b")
+	if err != nil {
+		t.Fatalf("worker should be free after release, got %v", err)
+	}
+	release()
+}
@@ -0,0 +1,86 @@
+package yandex
+
+import (
+	"sync"
+	"time"
+)
+
+// logThrottle deduplicates repeated log messages about the same object: a message is logged the first time
+// it's seen and then at most once per window, along with the number of times it was suppressed in between.
+// A nil logThrottle or a zero window logs everything.
+type logThrottle struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[logThrottleKey]*logThrottleEntry
+}
+
+type logThrottleKey struct {
+	object  string
+	message string
+}
+
+type logThrottleEntry struct {
+	loggedAt   time.Time
+	suppressed int
+}
+
+func newLogThrottle(window time.Duration) *logThrottle {
+	return &logThrottle{
+		window:  window,
+		now:     time.Now,
+		entries: make(map[logThrottleKey]*logThrottleEntry),
+	}
+}
+
+// allow reports whether the message about the object should be logged now and how many times it was suppressed
+// since it was last logged
+func (t *logThrottle) allow(object, message string) (bool, int) {
+	if t == nil || t.window <= 0 {
+		return true, 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	key := logThrottleKey{object: object, message: message}
+	entry, ok := t.entries[key]
+	if ok && now.Sub(entry.loggedAt) < t.window {
+		entry.suppressed++
+		return false, 0
+	}
+
+	// messages that stopped repeating are forgotten, so that messages of deleted objects don't pile up.
+	// Suppressed ones are kept for another window to report their count.
+	for key, entry := range t.entries {
+		if age := now.Sub(entry.loggedAt); age >= 2*t.window || age >= t.window && entry.suppressed == 0 {
+			delete(t.entries, key)
+		}
+	}
+
+	suppressed := 0
+	if ok {
+		suppressed = entry.suppressed
+	}
+	t.entries[key] = &logThrottleEntry{loggedAt: now}
+
+	return true, suppressed
+}
+
+// forget drops messages about the object, e.g. once it has recovered, so that a new failure is logged right away
+func (t *logThrottle) forget(object string) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key := range t.entries {
+		if key.object == object {
+			delete(t.entries, key)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package yandex
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLogThrottle(t *testing.T) {
+	now := time.Unix(0, 0)
+	throttle := newLogThrottle(time.Minute)
+	throttle.now = func() time.Time { return now }
+
+	expect := func(object, message string, expectedLogged bool, expectedSuppressed int) {
+		t.Helper()
+		logged, suppressed := throttle.allow(object, message)
+		if logged != expectedLogged || suppressed != expectedSuppressed {
+			t.Errorf("%s %q: expected logged %t with %d suppressed, got %t with %d", object, message, expectedLogged, expectedSuppressed, logged, suppressed)
+		}
+	}
+
+	expect("node-a", "no InternalIP", true, 0)
+	expect("node-a", "no InternalIP", false, 0)
+	expect("node-a", "no InternalIP", false, 0)
+	// other messages and objects are throttled separately
+	expect("node-a", "quota exceeded", true, 0)
+	expect("node-b", "no InternalIP", true, 0)
+
+	now = now.Add(time.Minute)
+	expect("node-a", "no InternalIP", true, 2)
+	expect("node-a", "no InternalIP", false, 0)
+
+	throttle.forget("node-a")
+	expect("node-a", "no InternalIP", true, 0)
+
+	// messages that stopped repeating are forgotten
+	now = now.Add(2 * time.Minute)
+	expect("node-c", "no InternalIP", true, 0)
+	if len(throttle.entries) != 1 {
+		t.Errorf("expected stale messages to be forgotten, got %v", throttle.entries)
+	}
+
+	var disabled *logThrottle
+	for i := 0; i < 2; i++ {
+		if logged, _ := disabled.allow("node-a", "no InternalIP"); !logged {
+			t.Error("a nil logThrottle should log everything")
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package yandex
+
+import (
+	"sync"
+	"time"
+
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/version"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const (
+	routeOperationList   = "list"
+	routeOperationCreate = "create"
+	routeOperationDelete = "delete"
+)
+
+var (
+	routeUpdateTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "yandex_route_update_total",
+			Help:           "Number of VPC route operations.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"operation"},
+	)
+
+	routeUpdateErrorsTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "yandex_route_update_errors_total",
+			Help:           "Number of failed VPC route operations.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"operation"},
+	)
+
+	routeTableUpdateDuration = metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Name:           "yandex_route_table_update_duration_seconds",
+			Help:           "Duration of RouteTable update operations, including waiting for the operation to finish.",
+			Buckets:        metrics.ExponentialBuckets(0.5, 2, 10),
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+
+	routeTableRoutes = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name:           "yandex_route_table_routes_total",
+			Help:           "Number of StaticRoutes in the RouteTable as of its last read or update, including ones not managed by the CCM.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"route_table_id"},
+	)
+
+	routeTableAggregatableRoutes = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name:           "yandex_route_table_aggregatable_routes",
+			Help:           "Number of the cluster's StaticRoutes in the RouteTable that merging sibling destination prefixes with identical next hops would save.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"route_table_id"},
+	)
+
+	instanceCacheLookupsTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "yandex_instance_cache_lookups_total",
+			Help:           "Number of Instance cache lookups by key and result.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"key", "result"},
+	)
+
+	lbReconcilesInFlight = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Name:           "yandex_lb_reconciles_in_flight",
+			Help:           "Number of NLBs being reconciled at the moment.",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+
+	buildInfo = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name:           "yandex_ccm_build_info",
+			Help:           "Build information of the running CCM, always 1.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"version", "commit", "build_date"},
+	)
+)
+
+var registerMetricsOnce sync.Once
+
+// registerMetrics registers metrics in the registry served by the controller manager's metrics endpoint
+func registerMetrics() {
+	registerMetricsOnce.Do(func() {
+		legacyregistry.MustRegister(routeUpdateTotal)
+		legacyregistry.MustRegister(routeUpdateErrorsTotal)
+		legacyregistry.MustRegister(routeTableUpdateDuration)
+		legacyregistry.MustRegister(routeTableRoutes)
+		legacyregistry.MustRegister(routeTableAggregatableRoutes)
+		legacyregistry.MustRegister(instanceCacheLookupsTotal)
+		legacyregistry.MustRegister(lbReconcilesInFlight)
+		legacyregistry.MustRegister(buildInfo)
+
+		info := version.Get()
+		buildInfo.WithLabelValues(info.Version, info.GitCommit, info.BuildDate).Set(1)
+	})
+}
+
+func observeRouteOperation(operation string, err error) {
+	routeUpdateTotal.WithLabelValues(operation).Inc()
+	if err != nil {
+		routeUpdateErrorsTotal.WithLabelValues(operation).Inc()
+	}
+}
+
+func observeRouteTableUpdate(start time.Time) {
+	routeTableUpdateDuration.Observe(time.Since(start).Seconds())
+}
+
+func observeRouteTableRoutes(routeTableID string, routes int) {
+	routeTableRoutes.WithLabelValues(routeTableID).Set(float64(routes))
+}
+
+func observeRouteTableAggregatableRoutes(routeTableID string, routes int) {
+	routeTableAggregatableRoutes.WithLabelValues(routeTableID).Set(float64(routes))
+}
+
+func observeInstanceCacheLookup(key string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	instanceCacheLookupsTotal.WithLabelValues(key, result).Inc()
+}
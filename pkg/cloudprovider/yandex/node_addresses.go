@@ -0,0 +1,100 @@
+package yandex
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/compute/v1"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// nodeAddressResolver caches the Networks of Subnets Node Instances are attached to. Together with instanceCache
+// it lets route next hop resolution and LB Target building share the lookups of each Node's addresses instead of
+// repeating them. Subnets can't be moved between Networks, so entries never expire. It is safe for concurrent use,
+// a nil resolver disables caching.
+type nodeAddressResolver struct {
+	mu             sync.RWMutex
+	subnetNetworks map[string]string
+}
+
+func newNodeAddressResolver() *nodeAddressResolver {
+	return &nodeAddressResolver{subnetNetworks: make(map[string]string)}
+}
+
+func (r *nodeAddressResolver) networkID(subnetID string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	networkID, ok := r.subnetNetworks[subnetID]
+	return networkID, ok
+}
+
+func (r *nodeAddressResolver) setNetworkID(subnetID, networkID string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.subnetNetworks[subnetID] = networkID
+}
+
+// nodeInterface is a network interface of the Node's Instance along with the Network of its Subnet
+type nodeInterface struct {
+	instance  *compute.Instance
+	iface     *compute.NetworkInterface
+	networkID string
+}
+
+// ipv4 returns the primary IPv4 address of the interface, empty if it has none
+func (i nodeInterface) ipv4() string {
+	return i.iface.GetPrimaryV4Address().GetAddress()
+}
+
+// ipv6 returns the primary IPv6 address of the interface, empty if it has none
+func (i nodeInterface) ipv6() string {
+	return i.iface.GetPrimaryV6Address().GetAddress()
+}
+
+// getSubnetNetworkID returns the Network the Subnet belongs to
+func (yc *Cloud) getSubnetNetworkID(ctx context.Context, subnetID string) (string, error) {
+	if networkID, ok := yc.nodeAddresses.networkID(subnetID); ok {
+		return networkID, nil
+	}
+
+	subnet, err := yc.yandexService.VPCSvc.SubnetSvc.Get(ctx, &vpc.GetSubnetRequest{SubnetId: subnetID})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	yc.nodeAddresses.setNetworkID(subnetID, subnet.NetworkId)
+
+	return subnet.NetworkId, nil
+}
+
+// getNodeInterfaces returns network interfaces of the Node's Instance with their Networks resolved
+func (yc *Cloud) getNodeInterfaces(ctx context.Context, node *v1.Node) ([]nodeInterface, error) {
+	instance, err := yc.getInstanceByNode(ctx, node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find Instance of Node %q: %s", node.Name, err)
+	}
+
+	interfaces := make([]nodeInterface, 0, len(instance.NetworkInterfaces))
+	for _, iface := range instance.NetworkInterfaces {
+		networkID, err := yc.getSubnetNetworkID(ctx, iface.SubnetId)
+		if err != nil {
+			return nil, err
+		}
+
+		interfaces = append(interfaces, nodeInterface{instance: instance, iface: iface, networkID: networkID})
+	}
+
+	return interfaces, nil
+}
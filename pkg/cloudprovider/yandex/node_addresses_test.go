@@ -0,0 +1,100 @@
+package yandex
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/compute/v1"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/yapi"
+)
+
+func newFakeNodeAddressCloud(subnetClient *fakeSubnetClient, instances ...*compute.Instance) *Cloud {
+	yc := &Cloud{
+		yandexService: &yapi.YandexCloudAPI{
+			VPCSvc: yapi.NewVPCService(nil, subnetClient, nil, nil, &yapi.CloudContext{}),
+		},
+		instanceCache: newInstanceCache(time.Minute),
+		nodeAddresses: newNodeAddressResolver(),
+	}
+	for _, instance := range instances {
+		yc.instanceCache.Set(instance)
+	}
+
+	return yc
+}
+
+func TestGetNodeInterfacesCachesSubnetNetworks(t *testing.T) {
+	subnetClient := &fakeSubnetClient{subnets: map[string]*vpc.Subnet{
+		"subnet-a": {Id: "subnet-a", NetworkId: "network"},
+		"subnet-b": {Id: "subnet-b", NetworkId: "other"},
+	}}
+	yc := newFakeNodeAddressCloud(subnetClient,
+		&compute.Instance{Id: "fhm1", NetworkInterfaces: []*compute.NetworkInterface{
+			{SubnetId: "subnet-a", PrimaryV4Address: &compute.PrimaryAddress{Address: "10.0.0.1"}},
+			{SubnetId: "subnet-b", PrimaryV6Address: &compute.PrimaryAddress{Address: "fd00::1"}},
+		}},
+		&compute.Instance{Id: "fhm2", NetworkInterfaces: []*compute.NetworkInterface{
+			{SubnetId: "subnet-a", PrimaryV4Address: &compute.PrimaryAddress{Address: "10.0.0.2"}},
+		}},
+	)
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{instanceIDLabel: "fhm1"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-2", Labels: map[string]string{instanceIDLabel: "fhm2"}}},
+	}
+
+	interfaces, err := yc.getNodeInterfaces(context.Background(), nodes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(interfaces) != 2 || interfaces[0].networkID != "network" || interfaces[0].ipv4() != "10.0.0.1" ||
+		interfaces[1].networkID != "other" || interfaces[1].ipv4() != "" || interfaces[1].ipv6() != "fd00::1" {
+		t.Errorf("unexpected interfaces %+v", interfaces)
+	}
+
+	// route next hops and LB Targets resolve the same Nodes concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(node *v1.Node) {
+			defer wg.Done()
+			if _, err := yc.getNodeInterfaces(context.Background(), node); err != nil {
+				t.Error(err)
+			}
+		}(nodes[i%len(nodes)])
+	}
+	wg.Wait()
+
+	if subnetClient.gets != 2 {
+		t.Errorf("each Subnet's Network should be looked up once, got %d lookups", subnetClient.gets)
+	}
+}
+
+func TestConstructNetworkIdToTargetMap(t *testing.T) {
+	subnetClient := &fakeSubnetClient{subnets: map[string]*vpc.Subnet{
+		"subnet-a": {Id: "subnet-a", NetworkId: "network"},
+		"subnet-b": {Id: "subnet-b", NetworkId: "other"},
+	}}
+	yc := newFakeNodeAddressCloud(subnetClient,
+		&compute.Instance{Id: "fhm1", NetworkInterfaces: []*compute.NetworkInterface{
+			{SubnetId: "subnet-a", PrimaryV4Address: &compute.PrimaryAddress{Address: "10.0.0.1"}},
+			{SubnetId: "subnet-b", PrimaryV6Address: &compute.PrimaryAddress{Address: "fd00::1"}},
+		}},
+	)
+	yc.nodeTargetGroupSyncer = &NodeTargetGroupSyncer{cloud: yc}
+
+	mapping, err := yc.nodeTargetGroupSyncer.constructNetworkIdToTargetMap(context.Background(), []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{instanceIDLabel: "fhm1"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mapping) != 1 || len(mapping["network"]) != 1 || mapping["network"][0].Address != "10.0.0.1" || mapping["network"][0].SubnetId != "subnet-a" {
+		t.Errorf("only interfaces with IPv4 addresses should be targeted, got %v", mapping)
+	}
+}
@@ -0,0 +1,142 @@
+package yandex
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/yapi"
+)
+
+const (
+	// preemptibleLabelName is set to "true" or "false" on every Node backed by an Instance.
+	// The same key is used for the NoSchedule taint put on preemptible Nodes when enabled.
+	preemptibleLabelName = "yandex.cpi.flant.com/preemptible"
+
+	// defaultNodeInstanceLabelPrefix keeps Instance labels mirrored onto Nodes apart from reserved and user labels
+	defaultNodeInstanceLabelPrefix = "instance.yandex.cpi.flant.com/"
+
+	// cloud-provider v0.25 has no way to return additional Node labels from InstanceMetadata,
+	// so we periodically reconcile them ourselves
+	nodeLabelsSyncInterval = 5 * time.Minute
+)
+
+// SyncNodeLabels labels (and optionally taints) Nodes according to the preemptible flag of their Instances
+// and mirrors the NodeInstanceLabels of the Instances onto them
+func (yc *Cloud) SyncNodeLabels(ctx context.Context) {
+	nodes, err := yc.nodeLister.List(labels.Everything())
+	if err != nil {
+		klog.ErrorS(err, "Failed to list Nodes from an internal Indexer")
+		return
+	}
+
+	for _, node := range nodes {
+		// Nodes are labeled only after they are initialized by the node controller
+		if len(node.Spec.ProviderID) == 0 {
+			continue
+		}
+
+		instance, err := yc.getInstanceByProviderID(ctx, node.Spec.ProviderID)
+		if err != nil {
+			klog.ErrorS(err, "Failed to get Instance of Node", "nodeName", node.Name, "errorKind", yapi.ErrorKind(err))
+			continue
+		}
+
+		preemptible := instance.SchedulingPolicy != nil && instance.SchedulingPolicy.Preemptible
+
+		newNode := node.DeepCopy()
+		preemptibleChanged := applyPreemptibleNodeState(newNode, preemptible, yc.config.TaintPreemptibleNodes)
+		instanceLabelsChanged := applyInstanceLabels(newNode, instance.Labels, yc.config.NodeInstanceLabels, yc.config.NodeInstanceLabelPrefix)
+		if !preemptibleChanged && !instanceLabelsChanged {
+			continue
+		}
+
+		if _, err := yc.kubeClient.CoreV1().Nodes().Update(ctx, newNode, metav1.UpdateOptions{}); err != nil {
+			klog.ErrorS(err, "Failed to update labels of Node", "nodeName", node.Name)
+			continue
+		}
+		if preemptibleChanged {
+			klog.InfoS("Node preemptible label set", "nodeName", node.Name, "preemptible", preemptible)
+		}
+		if instanceLabelsChanged {
+			klog.InfoS("Node labels synced with its Instance", "nodeName", node.Name, "instanceId", instance.Id)
+		}
+	}
+}
+
+// applyInstanceLabels mirrors the Instance labels with the keys onto the Node under the prefix, removing the ones
+// the Instance no longer has, and returns whether the Node has been changed. Labels with invalid values are skipped.
+func applyInstanceLabels(node *v1.Node, instanceLabels map[string]string, keys []string, prefix string) bool {
+	var changed bool
+	for _, key := range keys {
+		nodeKey := prefix + key
+		value, ok := instanceLabels[key]
+		if ok && len(validation.IsValidLabelValue(value)) > 0 {
+			klog.ErrorS(nil, "Instance label value is not a valid Node label value, skipping it", "nodeName", node.Name, "label", key, "value", value)
+			continue
+		}
+
+		current, exists := node.Labels[nodeKey]
+		switch {
+		case !ok && exists:
+			delete(node.Labels, nodeKey)
+			changed = true
+		case ok && (!exists || current != value):
+			if node.Labels == nil {
+				node.Labels = make(map[string]string)
+			}
+			node.Labels[nodeKey] = value
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// applyPreemptibleNodeState sets the preemptible label and taint on the Node, returning whether it has been changed
+func applyPreemptibleNodeState(node *v1.Node, preemptible, taint bool) bool {
+	var changed bool
+
+	labelValue := strconv.FormatBool(preemptible)
+	if node.Labels[preemptibleLabelName] != labelValue {
+		if node.Labels == nil {
+			node.Labels = make(map[string]string)
+		}
+		node.Labels[preemptibleLabelName] = labelValue
+		changed = true
+	}
+
+	wantTaint := preemptible && taint
+
+	var (
+		taints   []v1.Taint
+		hasTaint bool
+	)
+	for _, t := range node.Spec.Taints {
+		if t.Key == preemptibleLabelName {
+			if !wantTaint {
+				changed = true
+				continue
+			}
+			hasTaint = true
+		}
+		taints = append(taints, t)
+	}
+	if wantTaint && !hasTaint {
+		taints = append(taints, v1.Taint{
+			Key:    preemptibleLabelName,
+			Value:  "true",
+			Effect: v1.TaintEffectNoSchedule,
+		})
+		changed = true
+	}
+	node.Spec.Taints = taints
+
+	return changed
+}
@@ -0,0 +1,63 @@
+package yandex
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestApplyPreemptibleNodeState(t *testing.T) {
+	node := &v1.Node{}
+
+	if !applyPreemptibleNodeState(node, true, true) {
+		t.Error("Node should be changed")
+	}
+	if node.Labels[preemptibleLabelName] != "true" {
+		t.Error("preemptible label should be set")
+	}
+	if len(node.Spec.Taints) != 1 || node.Spec.Taints[0].Effect != v1.TaintEffectNoSchedule {
+		t.Error("NoSchedule taint should be added")
+	}
+
+	if applyPreemptibleNodeState(node, true, true) {
+		t.Error("Node should not be changed when already in sync")
+	}
+
+	if !applyPreemptibleNodeState(node, false, true) {
+		t.Error("Node should be changed")
+	}
+	if node.Labels[preemptibleLabelName] != "false" {
+		t.Error("preemptible label should be updated")
+	}
+	if len(node.Spec.Taints) != 0 {
+		t.Error("taint should be removed from a non-preemptible Node")
+	}
+}
+
+func TestApplyInstanceLabels(t *testing.T) {
+	const prefix = defaultNodeInstanceLabelPrefix
+	node := &v1.Node{}
+	keys := []string{"team", "env", "invalid"}
+
+	instanceLabels := map[string]string{"team": "payments", "env": "prod", "invalid": "-", "other": "skipped"}
+	if !applyInstanceLabels(node, instanceLabels, keys, prefix) {
+		t.Error("Node should be changed")
+	}
+	expected := map[string]string{prefix + "team": "payments", prefix + "env": "prod"}
+	if !reflect.DeepEqual(node.Labels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, node.Labels)
+	}
+
+	if applyInstanceLabels(node, instanceLabels, keys, prefix) {
+		t.Error("Node should not be changed when already in sync")
+	}
+
+	if !applyInstanceLabels(node, map[string]string{"team": "billing"}, keys, prefix) {
+		t.Error("Node should be changed")
+	}
+	expected = map[string]string{prefix + "team": "billing"}
+	if !reflect.DeepEqual(node.Labels, expected) {
+		t.Errorf("labels removed from the Instance should be removed from the Node, expected %v, got %v", expected, node.Labels)
+	}
+}
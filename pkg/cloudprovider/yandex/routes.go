@@ -3,158 +3,1405 @@ package yandex
 import (
 	"context"
 	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/yandex-cloud/go-genproto/yandex/cloud/operation"
 	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/grpc/codes"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
+
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/tracing"
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/yapi"
+	netutils "k8s.io/utils/net"
+)
+
+const (
+	routeCreationFailedReason = "RouteCreationFailed"
+	routeDeletionFailedReason = "RouteDeletionFailed"
+)
+
+// nextHopInstanceIDAnnotation routes PodCIDRs of the annotated Node through the Instance with this ID, e.g. an appliance VM
+const nextHopInstanceIDAnnotation = "yandex.cpi.flant.com/next-hop-instance-id"
+
+// TODO: route PodCIDRs of Nodes behind a NAT gateway through the gateway with this ID once the SDK is bumped,
+// the vendored StaticRoute only has the NextHopAddress variant. Until then routes of annotated Nodes are rejected.
+const nextHopGatewayIDAnnotation = "yandex.cpi.flant.com/next-hop-gateway-id"
+
+// errNextHopGatewayNotSupported is returned for Nodes annotated with nextHopGatewayIDAnnotation
+var errNextHopGatewayNotSupported = fmt.Errorf("%q annotation is not supported yet", nextHopGatewayIDAnnotation)
+
+// errNodeInternalIPNotReady is returned while kubelet hasn't reported Node's addresses yet.
+// It is expected right after the Node is registered, so the route is retried on the next reconciliation without a Warning event.
+var errNodeInternalIPNotReady = yapi.NewError(yapi.ErrTransient, errors.New("Node has no InternalIP reported yet"))
+
+const (
+	// nodeInternalIPWaitTimeout is how long CreateRoute waits for kubelet to report Node's InternalIP
+	nodeInternalIPWaitTimeout  = 5 * time.Second
+	nodeInternalIPPollInterval = 500 * time.Millisecond
 )
 
 const (
-	cpiRouteLabelsPrefix = "yandex.cpi.flant.com/"
-	cpiNodeRoleLabel     = cpiRouteLabelsPrefix + "node-role" // we store Node's name here. The reason for this is lost in time (like tears in rain).
+	defaultRouteLabelsPrefix = "yandex.cpi.flant.com/"
+	nodeRoleLabelName        = "node-role"      // we store Node's name here. The reason for this is lost in time (like tears in rain).
+	podCIDRIndexLabelName    = "pod-cidr-index" // index of the route's destination in Node's PodCIDRs, routes without it are treated as index 0
+	// defaultRouteLabelName marks the default route of RouteDefaultNextHop. It has no nodeRole label,
+	// so neither the route controller nor GC ever see it.
+	defaultRouteLabelName = "default-route"
 )
 
-// these may get called in parallel, but since we have to modify the whole Route Table, we'll synchronize operations
-var routeAPILock sync.Mutex
+// routeLabels holds the keys of labels put on managed StaticRoutes. Routes without the nodeRole label are never touched,
+// neither are routes labeled with another cluster's name.
+type routeLabels struct {
+	nodeRole     string
+	podCIDRIndex string
+	cluster      string
+	defaultRoute string
+
+	clusterName string
+	// strictCluster makes routes without the cluster label foreign too
+	strictCluster bool
+	// managedCIDRs makes routes to destinations outside of them foreign, empty means all destinations are managed
+	managedCIDRs []*net.IPNet
+}
+
+func newRouteLabels(prefix, clusterName string, strictCluster bool) routeLabels {
+	if len(prefix) == 0 {
+		prefix = defaultRouteLabelsPrefix
+	}
+
+	return routeLabels{
+		nodeRole:      prefix + nodeRoleLabelName,
+		podCIDRIndex:  prefix + podCIDRIndexLabelName,
+		cluster:       prefix + clusterNameLabelName,
+		defaultRoute:  prefix + defaultRouteLabelName,
+		clusterName:   clusterName,
+		strictCluster: strictCluster,
+	}
+}
+
+func (yc *Cloud) newRouteLabels() routeLabels {
+	rl := newRouteLabels(yc.config.RouteLabelPrefix, yc.config.ClusterName, yc.config.StrictClusterLabels)
+	rl.managedCIDRs = yc.config.RouteManagedCIDRs
+
+	return rl
+}
+
+// getNodeName returns the name of the Node the StaticRoute leads to, if the route is managed by this cluster
+func (rl routeLabels) getNodeName(staticRoute *vpc.StaticRoute) (string, bool) {
+	nodeName, ok := staticRoute.Labels[rl.nodeRole]
+	if !ok {
+		return "", false
+	}
+	if !cidrWithinAny(staticRoute.GetDestinationPrefix(), rl.managedCIDRs) {
+		return nodeName, false
+	}
+
+	clusterName, ok := staticRoute.Labels[rl.cluster]
+	if ok {
+		return nodeName, clusterName == rl.clusterName
+	}
+
+	return nodeName, !rl.strictCluster
+}
+
+// isDefaultRoute reports whether the StaticRoute is the default route managed by this cluster
+func (rl routeLabels) isDefaultRoute(staticRoute *vpc.StaticRoute) bool {
+	if _, ok := staticRoute.Labels[rl.defaultRoute]; !ok {
+		return false
+	}
+	if _, ok := staticRoute.Labels[rl.nodeRole]; ok {
+		return false
+	}
+
+	clusterName, ok := staticRoute.Labels[rl.cluster]
+	if ok {
+		return clusterName == rl.clusterName
+	}
+
+	return !rl.strictCluster
+}
+
+func (rl routeLabels) forDefaultRoute() map[string]string {
+	labels := map[string]string{rl.defaultRoute: "true"}
+	if len(rl.clusterName) > 0 {
+		labels[rl.cluster] = rl.clusterName
+	}
+
+	return labels
+}
+
+// routeTableUpdateBackoff is used to retry a RouteTable update when the RouteTable was modified concurrently
+var routeTableUpdateBackoff = wait.Backoff{
+	Duration: 500 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    5,
+	Cap:      10 * time.Second,
+}
+
+const (
+	// defaultRouteAPILockTimeout is how long route operations wait for a RouteTable lock before giving up
+	defaultRouteAPILockTimeout = 30 * time.Second
+	// defaultRouteGCInterval is how often StaticRoutes of deleted Nodes are garbage collected
+	defaultRouteGCInterval = 10 * time.Minute
+	// defaultRouteGCConcurrency is how many Nodes are looked up in the API server concurrently during route GC
+	defaultRouteGCConcurrency = 10
+	// default route destinations used if only RouteDefaultNextHop is configured
+	defaultRouteDestination     = "0.0.0.0/0"
+	defaultRouteDestinationIPv6 = "::/0"
+	// defaultRouteResyncInterval is how often StaticRoutes of all Nodes are recomputed to correct drift
+	defaultRouteResyncInterval = 30 * time.Minute
+	// routeResyncJitter spreads resyncs of multiple CCM instances and clusters sharing a RouteTable
+	routeResyncJitter = 0.2
+	// defaultRouteFailureLogWindow is how often the same route failure of a Node is logged
+	defaultRouteFailureLogWindow = 5 * time.Minute
+)
+
+// contextLock is a mutex that can be waited on with a context
+type contextLock chan struct{}
+
+func newContextLock() contextLock {
+	return make(contextLock, 1)
+}
+
+func (l contextLock) Lock(ctx context.Context) error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l contextLock) Unlock() {
+	<-l
+}
+
+// managedRouteTable holds the state of a single RouteTable managed by the CCM.
+// Operations on different RouteTables don't block each other.
+type managedRouteTable struct {
+	id string
+
+	// these may get called in parallel, but since we have to modify the whole Route Table, we'll synchronize operations
+	lock    contextLock
+	cache   routeTableCache
+	batcher *routeBatcher
+
+	// quotaWarned is set once the RouteTable size is warned about, until it drops below the threshold again
+	quotaWarned bool
+}
+
+// newManagedRouteTables returns the state of the default RouteTable and all per-zone RouteTables keyed by their IDs
+func (yc *Cloud) newManagedRouteTables() map[string]*managedRouteTable {
+	routeTableIDs := []string{yc.config.RouteTableID}
+	for _, routeTableID := range yc.config.RouteTablesByZone {
+		routeTableIDs = append(routeTableIDs, routeTableID)
+	}
+
+	routeTables := make(map[string]*managedRouteTable)
+	for _, routeTableID := range routeTableIDs {
+		if _, ok := routeTables[routeTableID]; ok || len(routeTableID) == 0 {
+			continue
+		}
+
+		rt := &managedRouteTable{
+			id:   routeTableID,
+			lock: newContextLock(),
+		}
+		rt.batcher = newRouteBatcher(routeBatchDelay, func(ctx context.Context, terms []routeFilterTerm) error {
+			return yc.updateRouteTable(ctx, rt, terms)
+		})
+
+		routeTables[routeTableID] = rt
+	}
+
+	return routeTables
+}
+
+// getRouteTableForNode returns the RouteTable configured for the Node's zone, falling back to the default RouteTable
+func (yc *Cloud) getRouteTableForNode(kubeNode *v1.Node) (*managedRouteTable, error) {
+	routeTableID := yc.config.RouteTableID
+	if zoneRouteTableID, ok := yc.config.RouteTablesByZone[kubeNode.Labels[v1.LabelTopologyZone]]; ok {
+		routeTableID = zoneRouteTableID
+	}
+
+	rt, ok := yc.routeTables[routeTableID]
+	if !ok {
+		return nil, fmt.Errorf("no RouteTable configured for Node %q in zone %q", kubeNode.Name, kubeNode.Labels[v1.LabelTopologyZone])
+	}
+
+	return rt, nil
+}
+
+// lockRouteTable blocks until the RouteTable lock is acquired, ctx is done or RouteAPILockTimeout expires
+func (yc *Cloud) lockRouteTable(ctx context.Context, rt *managedRouteTable) error {
+	timeout := yc.config.RouteAPILockTimeout
+	if timeout == 0 {
+		timeout = defaultRouteAPILockTimeout
+	}
+
+	lockCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := rt.lock.Lock(lockCtx); err != nil {
+		return yapi.NewError(yapi.ErrTransient, errors.Wrapf(err, "VPC route API for RouteTable %q locked", rt.id))
+	}
+
+	return nil
+}
+
+func (yc *Cloud) ListRoutes(ctx context.Context, _ string) (_ []*cloudprovider.Route, err error) {
+	klog.InfoS("ListRoutes called", "operation", routeOperationList)
+	defer func() { observeRouteOperation(routeOperationList, err) }()
+	ctx, span := tracing.Start(ctx, "ListRoutes")
+	defer func() { tracing.End(span, err) }()
+
+	var cpiRoutes []*cloudprovider.Route
+	for _, rt := range yc.routeTables {
+		routes, err := yc.listRouteTableRoutes(ctx, rt, yc.config.RouteReportForeign)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, route := range routes {
+			// the route controller deletes routes it doesn't expect, so unmanaged ones are only reported
+			if route.unmanaged {
+				klog.V(2).InfoS("Found unmanaged route, leaving it intact", "operation", routeOperationList, "nodeName", route.TargetNode, "routeTableId", rt.id, "destinationCIDR", route.DestinationCIDR)
+				continue
+			}
+
+			cpiRoutes = append(cpiRoutes, route.Route)
+		}
+	}
+
+	return cpiRoutes, nil
+}
+
+// tableRoute is a StaticRoute of a Node in a RouteTable. Unmanaged routes belong to Nodes of other clusters
+// or lead outside of RouteManagedCIDRs, they are never modified.
+type tableRoute struct {
+	*cloudprovider.Route
+	unmanaged bool
+}
+
+// listRouteTableRoutes returns StaticRoutes of Nodes managed by this cluster, and unmanaged ones if includeUnmanaged is set
+func (yc *Cloud) listRouteTableRoutes(ctx context.Context, rt *managedRouteTable, includeUnmanaged bool) ([]tableRoute, error) {
+	if err := yc.lockRouteTable(ctx, rt); err != nil {
+		return nil, err
+	}
+	defer rt.lock.Unlock()
+
+	routeTable, err := yc.getRouteTable(ctx, rt)
+	if err != nil {
+		return nil, err
+	}
+
+	routeLabels := yc.newRouteLabels()
+
+	var routes []tableRoute
+	for _, staticRoute := range routeTable.StaticRoutes {
+		nodeName, managed := routeLabels.getNodeName(staticRoute)
+		if len(nodeName) == 0 || !managed && !includeUnmanaged {
+			continue
+		}
+		destinationCIDR, ok := staticRouteDestinationPrefix(staticRoute)
+		if !ok {
+			klog.Warningf("Skipping StaticRoute of Node %q in RouteTable %q: destination is not a prefix", nodeName, rt.id)
+			continue
+		}
+		if managed && !routeFamilyEnabled(yc.config.RouteAddressFamilies, ipFamilyOfCIDR(destinationCIDR)) {
+			continue
+		}
+
+		routes = append(routes, tableRoute{
+			Route: &cloudprovider.Route{
+				Name:            routeName(nodeName, routeLabels.getPodCIDRIndex(staticRoute)),
+				TargetNode:      types.NodeName(nodeName),
+				DestinationCIDR: destinationCIDR,
+			},
+			unmanaged: !managed,
+		})
+	}
+
+	return routes, nil
+}
+
+// routeSpanAttributes identify the route in CreateRoute and DeleteRoute spans
+func routeSpanAttributes(route *cloudprovider.Route) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("nodeName", string(route.TargetNode)),
+		attribute.String("destinationCIDR", route.DestinationCIDR),
+	}
+}
+
+func (yc *Cloud) CreateRoute(ctx context.Context, _ string, _ string, route *cloudprovider.Route) (err error) {
+	klog.InfoS("CreateRoute called", "operation", routeOperationCreate, "nodeName", route.TargetNode, "destinationCIDR", route.DestinationCIDR)
+	defer func() {
+		observeRouteOperation(routeOperationCreate, err)
+		yc.recordNodeRouteFailure(route.TargetNode, routeCreationFailedReason, err)
+	}()
+	ctx, span := tracing.Start(ctx, "CreateRoute", routeSpanAttributes(route)...)
+	defer func() { tracing.End(span, err) }()
+	if len(yc.routeTables) == 0 {
+		return nil
+	}
+
+	if err := yc.waitForNodeLister(ctx); err != nil {
+		return err
+	}
+
+	kubeNode, err := yc.nodeLister.Get(string(route.TargetNode))
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "Node %q does not exist", route.TargetNode)
+		}
+		return err
+	}
+
+	rt, err := yc.getRouteTableForNode(kubeNode)
+	if err != nil {
+		return err
+	}
+
+	primaryAddresses, err := yc.getPrimaryAddresses(ctx, kubeNode)
+	if err != nil {
+		return err
+	}
+
+	var terms []routeFilterTerm
+	// kubelet reports addresses shortly after registering the Node, so give it a chance before failing
+	err = wait.PollImmediateWithContext(ctx, nodeInternalIPPollInterval, nodeInternalIPWaitTimeout, func(ctx context.Context) (bool, error) {
+		terms, err = yc.getNodeRouteFilterTerms(ctx, kubeNode, route, primaryAddresses)
+		if errors.Is(err, errNodeInternalIPNotReady) {
+			if latest, getErr := yc.nodeLister.Get(kubeNode.Name); getErr == nil {
+				kubeNode = latest
+			}
+			return false, nil
+		}
+
+		return err == nil, err
+	})
+	if err == wait.ErrWaitTimeout {
+		return errors.Wrapf(errNodeInternalIPNotReady, "failed to create route for Node %q", kubeNode.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	terms = yc.filterManagedRouteTerms(terms)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	if yc.config.RouteValidateNextHop {
+		if err := yc.validateNextHops(ctx, rt, terms); err != nil {
+			return err
+		}
+	}
+
+	if err := rt.batcher.Submit(ctx, terms...); err != nil {
+		return err
+	}
+	yc.recordNodeRouteStatus(ctx, rt.id, terms)
+
+	return nil
+}
+
+// filterManagedRouteTerms drops terms for destinations outside of RouteManagedCIDRs, they are left to other systems
+func (yc *Cloud) filterManagedRouteTerms(terms []routeFilterTerm) []routeFilterTerm {
+	var managedTerms []routeFilterTerm
+	for _, term := range terms {
+		if !cidrWithinAny(term.destinationCIDR, yc.config.RouteManagedCIDRs) {
+			klog.V(2).InfoS("Destination is outside of managed CIDRs, skipping route", "operation", routeOperationCreate, "nodeName", term.nodeName, "destinationCIDR", term.destinationCIDR)
+			continue
+		}
+		managedTerms = append(managedTerms, term)
+	}
+
+	return managedTerms
+}
+
+// validateNextHops checks that next hops of the terms belong to Subnets of the RouteTable's Network,
+// routes to addresses outside of it are accepted by the API, but blackhole traffic
+func (yc *Cloud) validateNextHops(ctx context.Context, rt *managedRouteTable, terms []routeFilterTerm) error {
+	if err := yc.lockRouteTable(ctx, rt); err != nil {
+		return err
+	}
+	routeTable, err := yc.getRouteTable(ctx, rt)
+	rt.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	subnets, err := yc.yandexService.VPCSvc.ListNetworkSubnets(ctx, routeTable.NetworkId)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list Subnets of Network %q", routeTable.NetworkId)
+	}
+
+	for _, term := range terms {
+		if !subnetsContainIP(subnets, term.nextHop) {
+			return fmt.Errorf("next hop %q of the route to %q for Node %q is outside of all Subnets of Network %q RouteTable %q belongs to",
+				term.nextHop, term.destinationCIDR, term.nodeName, routeTable.NetworkId, rt.id)
+		}
+	}
+
+	return nil
+}
+
+func subnetsContainIP(subnets []*vpc.Subnet, address string) bool {
+	ip := netutils.ParseIPSloppy(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, subnet := range subnets {
+		for _, cidrBlocks := range [][]string{subnet.V4CidrBlocks, subnet.V6CidrBlocks} {
+			for _, cidr := range cidrBlocks {
+				_, ipNet, err := netutils.ParseCIDRSloppy(cidr)
+				if err == nil && ipNet.Contains(ip) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func (yc *Cloud) DeleteRoute(ctx context.Context, _ string, route *cloudprovider.Route) (err error) {
+	klog.InfoS("DeleteRoute called", "operation", routeOperationDelete, "nodeName", route.TargetNode, "destinationCIDR", route.DestinationCIDR)
+	defer func() {
+		observeRouteOperation(routeOperationDelete, err)
+		yc.recordNodeRouteFailure(route.TargetNode, routeDeletionFailedReason, err)
+	}()
+	ctx, span := tracing.Start(ctx, "DeleteRoute", routeSpanAttributes(route)...)
+	defer func() { tracing.End(span, err) }()
+
+	// all PodCIDR routes are removed for the Node. The Node may already be gone, so we can't resolve its zone
+	// and remove routes from all RouteTables, unchanged ones are not updated.
+	term := routeFilterTerm{
+		termType: routeFilterRemove,
+		nodeName: string(route.TargetNode),
+	}
+
+	wg, wgCtx := errgroup.WithContext(ctx)
+	for _, rt := range yc.routeTables {
+		rt := rt
+		wg.Go(func() error {
+			return rt.batcher.Submit(wgCtx, term)
+		})
+	}
+	if err := wg.Wait(); err != nil {
+		return err
+	}
+	yc.clearNodeRouteStatus(ctx, route.TargetNode)
+
+	return nil
+}
+
+// recordNodeRouteFailure emits a Warning event on the Node if err is not nil
+func (yc *Cloud) recordNodeRouteFailure(nodeName types.NodeName, reason string, err error) {
+	if err == nil {
+		yc.routeFailureLogs.forget(string(nodeName))
+		return
+	}
+
+	// the route controller retries failed Nodes every reconciliation, repeated failures are only logged periodically
+	logged, suppressed := yc.routeFailureLogs.allow(string(nodeName), reason+": "+err.Error())
+	if errors.Is(err, errNodeInternalIPNotReady) {
+		if logged {
+			klog.V(2).InfoS("Node has no InternalIP yet, route will be retried on the next reconciliation", "nodeName", nodeName, "suppressed", suppressed)
+		}
+		return
+	}
+
+	if logged {
+		klog.ErrorS(err, "Failed to program routes", "nodeName", nodeName, "reason", reason, "errorKind", yapi.ErrorKind(err), "suppressed", suppressed)
+	}
+	if yc.eventRecorder == nil {
+		return
+	}
+
+	// the Node may already be deleted, so we refer to it the same way the route controller does
+	nodeRef := &v1.ObjectReference{
+		Kind: "Node",
+		Name: string(nodeName),
+		UID:  types.UID(nodeName),
+	}
+	yc.eventRecorder.Eventf(nodeRef, v1.EventTypeWarning, reason, "Failed to program routes in Yandex.Cloud: %s", err)
+}
+
+// BatchReconcileRoutes creates or updates StaticRoutes for all passed routes with a single update per RouteTable
+func (yc *Cloud) BatchReconcileRoutes(ctx context.Context, nodeRoutes []*cloudprovider.Route) error {
+	klog.InfoS("BatchReconcileRoutes called", "operation", routeOperationCreate, "routes", len(nodeRoutes))
+	if len(yc.routeTables) == 0 {
+		return nil
+	}
+
+	if err := yc.waitForNodeLister(ctx); err != nil {
+		return err
+	}
+
+	// next hops of the whole batch are resolved against the same view of Nodes
+	nodes, err := yc.snapshotRouteNodes(nodeRoutes)
+	if err != nil {
+		return err
+	}
+
+	termsByRouteTable := make(map[*managedRouteTable][]routeFilterTerm)
+	for _, route := range nodeRoutes {
+		kubeNode, err := nodes.get(string(route.TargetNode))
+		if err != nil {
+			return err
+		}
+
+		rt, err := yc.getRouteTableForNode(kubeNode)
+		if err != nil {
+			return err
+		}
+
+		primaryAddresses, err := yc.getPrimaryAddresses(ctx, kubeNode)
+		if err != nil {
+			return err
+		}
+
+		routeTerms, err := yc.getNodeRouteFilterTerms(ctx, kubeNode, route, primaryAddresses)
+		if errors.Is(err, errNodeInternalIPNotReady) {
+			klog.V(2).InfoS("Node has no InternalIP yet, skipping its routes", "operation", routeOperationCreate, "nodeName", kubeNode.Name)
+			continue
+		}
+		// a misconfigured Node must not block routes of the others
+		if errors.Is(err, errNextHopGatewayNotSupported) {
+			yc.recordNodeRouteFailure(route.TargetNode, routeCreationFailedReason, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		termsByRouteTable[rt] = append(termsByRouteTable[rt], yc.filterManagedRouteTerms(routeTerms)...)
+	}
+
+	for rt, terms := range termsByRouteTable {
+		terms = mergeRouteFilterTerms(terms)
+		if err := yc.updateRouteTable(ctx, rt, terms); err != nil {
+			return err
+		}
+		yc.recordNodeRouteStatus(ctx, rt.id, terms)
+	}
+
+	return nil
+}
+
+// nodeSnapshot is a view of Nodes taken with a single lister List. It points to the lister's cached objects
+// instead of copying them, so they must not be modified.
+type nodeSnapshot map[string]*v1.Node
+
+// waitForNodeLister blocks until nodeLister is populated, so that Nodes missing from a cold cache at startup
+// aren't reported as not found or lacking InternalIPs. A nil nodesSynced means the caller populated nodeLister.
+func (yc *Cloud) waitForNodeLister(ctx context.Context) error {
+	if yc.nodesSynced == nil {
+		return nil
+	}
+
+	select {
+	case <-yc.nodesSynced:
+		return nil
+	case <-ctx.Done():
+		return yapi.NewError(yapi.ErrTransient, errors.Wrap(ctx.Err(), "Node informer cache hasn't synced yet"))
+	}
+}
+
+// snapshotRouteNodes takes a snapshot of the Nodes targeted by the routes, other Nodes are not kept
+func (yc *Cloud) snapshotRouteNodes(nodeRoutes []*cloudprovider.Route) (nodeSnapshot, error) {
+	targetNodes := sets.NewString()
+	for _, route := range nodeRoutes {
+		targetNodes.Insert(string(route.TargetNode))
+	}
+
+	nodes, err := yc.nodeLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Nodes from an internal Indexer: %s", err)
+	}
+
+	snapshot := make(nodeSnapshot, targetNodes.Len())
+	for _, node := range nodes {
+		if targetNodes.Has(node.Name) {
+			snapshot[node.Name] = node
+		}
+	}
+
+	return snapshot, nil
+}
+
+// get returns the Node from the snapshot, failing like the lister does for missing ones
+func (s nodeSnapshot) get(nodeName string) (*v1.Node, error) {
+	node, ok := s[nodeName]
+	if !ok {
+		return nil, apierrors.NewNotFound(v1.Resource("node"), nodeName)
+	}
+
+	return node, nil
+}
+
+// validateRouteTables checks that the configured RouteTables exist and belong to the configured Folder and Network.
+// There is no Network setting for routes, the TargetGroup's default one is the cluster's Network, so the Network
+// is only checked if it is set.
+func (yc *Cloud) validateRouteTables(ctx context.Context) error {
+	for _, managedRT := range yc.routeTables {
+		rt, err := yc.yandexService.VPCSvc.RouteTableSvc.Get(ctx, &vpc.GetRouteTableRequest{RouteTableId: managedRT.id})
+		if err != nil {
+			return errors.Wrapf(err, "failed to get RouteTable %q", managedRT.id)
+		}
+
+		if rt.FolderId != yc.config.FolderID {
+			return fmt.Errorf("RouteTable %q belongs to Folder %q, but Folder %q is configured", rt.Id, rt.FolderId, yc.config.FolderID)
+		}
+		if len(yc.config.lbTgNetworkID) != 0 && rt.NetworkId != yc.config.lbTgNetworkID {
+			return fmt.Errorf("RouteTable %q belongs to Network %q, but Network %q is configured via %q env", rt.Id, rt.NetworkId, yc.config.lbTgNetworkID, envLbTgNetworkID)
+		}
+	}
+
+	return nil
+}
+
+// GarbageCollectRoutes removes managed StaticRoutes of Nodes that no longer exist in the cluster.
+// StaticRoutes without the configured label prefix are never touched.
+func (yc *Cloud) GarbageCollectRoutes(ctx context.Context) error {
+	for _, rt := range yc.routeTables {
+		// the RouteTable is locked while listing and updating, but not while Nodes are looked up
+		routes, err := yc.listRouteTableRoutes(ctx, rt, false)
+		if err != nil {
+			return err
+		}
+
+		var nodeNames []string
+		for _, route := range routes {
+			nodeNames = append(nodeNames, string(route.TargetNode))
+		}
+		deletedNodes, err := yc.findDeletedNodes(ctx, nodeNames)
+		if err != nil {
+			return err
+		}
+
+		var terms []routeFilterTerm
+		for _, route := range routes {
+			nodeName := string(route.TargetNode)
+			if _, ok := deletedNodes[nodeName]; !ok {
+				continue
+			}
+
+			klog.InfoS("Node does not exist, garbage collecting its route", "operation", "gc", "nodeName", nodeName, "routeTableId", rt.id, "destinationCIDR", route.DestinationCIDR)
+			terms = append(terms, routeFilterTerm{
+				termType: routeFilterRemove,
+				nodeName: nodeName,
+			})
+		}
+
+		if err := yc.updateRouteTable(ctx, rt, mergeRouteFilterTerms(terms)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ResyncRoutes recomputes StaticRoutes of all Nodes and corrects drift the event-driven reconciliation has missed:
+// missing routes and next hops gone stale, e.g. after a Node's NIC was replaced. Updates are made under the RouteTable
+// locks like any other route operation and are skipped if nothing has changed. Routes of deleted Nodes are left to GC.
+func (yc *Cloud) ResyncRoutes(ctx context.Context) error {
+	existingRoutes, err := yc.ListRoutes(ctx, yc.config.ClusterName)
+	if err != nil {
+		return err
+	}
+
+	nodeRoutes, err := yc.listNodeRoutes()
+	if err != nil {
+		return err
+	}
+
+	existing := sets.NewString()
+	for _, route := range existingRoutes {
+		existing.Insert(route.Name)
+	}
+	for _, route := range nodeRoutes {
+		if !existing.Has(route.Name) {
+			klog.InfoS("Route of Node is missing, it will be recreated", "operation", "resync", "nodeName", route.TargetNode, "destinationCIDR", route.DestinationCIDR)
+		}
+	}
+
+	if err := yc.BatchReconcileRoutes(ctx, nodeRoutes); err != nil {
+		return err
+	}
+
+	return yc.ensureDefaultRoute(ctx)
+}
+
+// ensureDefaultRoute programs the default route to RouteDefaultNextHop, if configured, into all managed RouteTables.
+// Disabling it leaves the route in place.
+func (yc *Cloud) ensureDefaultRoute(ctx context.Context) error {
+	if len(yc.config.RouteDefaultNextHop) == 0 {
+		return nil
+	}
+
+	term := routeFilterTerm{
+		termType:        routeFilterDefaultRoute,
+		destinationCIDR: yc.config.RouteDefaultDestination,
+		nextHop:         yc.config.RouteDefaultNextHop,
+	}
+	for _, rt := range yc.routeTables {
+		if err := yc.updateRouteTable(ctx, rt, []routeFilterTerm{term}); err != nil {
+			return errors.Wrapf(err, "failed to ensure the default route in RouteTable %q", rt.id)
+		}
+	}
+
+	return nil
+}
+
+// listNodeRoutes returns a route for every managed PodCIDR of every Node, Nodes without PodCIDRs have no routes yet
+func (yc *Cloud) listNodeRoutes() ([]*cloudprovider.Route, error) {
+	nodes, err := yc.nodeLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Nodes from an internal Indexer: %s", err)
+	}
+
+	var nodeRoutes []*cloudprovider.Route
+	for _, node := range nodes {
+		for index, podCIDR := range node.Spec.PodCIDRs {
+			if !routeFamilyEnabled(yc.config.RouteAddressFamilies, ipFamilyOfCIDR(podCIDR)) || !cidrWithinAny(podCIDR, yc.config.RouteManagedCIDRs) {
+				continue
+			}
+
+			nodeRoutes = append(nodeRoutes, &cloudprovider.Route{
+				Name:            routeName(node.Name, index),
+				TargetNode:      types.NodeName(node.Name),
+				DestinationCIDR: podCIDR,
+			})
+		}
+	}
+
+	return nodeRoutes, nil
+}
+
+// findDeletedNodes returns the names of Nodes that don't exist in the cluster. Nodes missing from the informer cache
+// are looked up in the API server concurrently, so that routes of Nodes the cache hasn't caught up with are kept.
+func (yc *Cloud) findDeletedNodes(ctx context.Context, nodeNames []string) (map[string]struct{}, error) {
+	var lock sync.Mutex
+	deletedNodes := make(map[string]struct{})
+
+	wg, ctx := errgroup.WithContext(ctx)
+	wg.SetLimit(yc.config.RouteGCConcurrency)
+	for nodeName := range sets.NewString(nodeNames...) {
+		nodeName := nodeName
+		wg.Go(func() error {
+			_, err := yc.nodeLister.Get(nodeName)
+			if err == nil {
+				return nil
+			}
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+
+			if yc.kubeClient != nil {
+				_, err = yc.kubeClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+				if err == nil {
+					return nil
+				}
+				if !apierrors.IsNotFound(err) {
+					return errors.Wrapf(err, "failed to get Node %q", nodeName)
+				}
+			}
+
+			lock.Lock()
+			deletedNodes[nodeName] = struct{}{}
+			lock.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := wg.Wait(); err != nil {
+		return nil, err
+	}
+
+	return deletedNodes, nil
+}
+
+// getRouteFilterTerms returns an AddOrUpdate term for every PodCIDR of the route's Node, falling back to
+// the route's DestinationCIDR if the Node has no PodCIDRs. Next hops are chosen from the addresses of nextHopAddressType
+// of the matching family, preferring InternalIPs in primaryAddresses, InternalIPs outside of nextHopCIDRs are never used unless nextHopCIDRs is empty.
+// PodCIDRs of families not in routeFamilies are skipped, empty routeFamilies allow all of them.
+func getRouteFilterTerms(kubeNode *v1.Node, route *cloudprovider.Route, primaryAddresses map[string]struct{}, routeFamilies []string, nextHopAddressType v1.NodeAddressType, nextHopCIDRs []*net.IPNet) ([]routeFilterTerm, error) {
+	destinationCIDRs := kubeNode.Spec.PodCIDRs
+	if len(destinationCIDRs) == 0 {
+		destinationCIDRs = []string{route.DestinationCIDR}
+	}
+
+	var terms []routeFilterTerm
+	// the index is kept for skipped PodCIDRs, so that labels of existing routes don't change
+	for index, destinationCIDR := range destinationCIDRs {
+		if !routeFamilyEnabled(routeFamilies, ipFamilyOfCIDR(destinationCIDR)) {
+			continue
+		}
+
+		nextHop, err := getNodeNextHop(kubeNode, ipFamilyOfCIDR(destinationCIDR), primaryAddresses, nextHopAddressType, nextHopCIDRs)
+		if err != nil {
+			return nil, err
+		}
+
+		terms = append(terms, routeFilterTerm{
+			termType:        routeFilterAddOrUpdate,
+			nodeName:        kubeNode.Name,
+			podCIDRIndex:    index,
+			destinationCIDR: destinationCIDR,
+			nextHop:         nextHop,
+		})
+	}
+
+	return terms, nil
+}
 
-func (yc *Cloud) ListRoutes(ctx context.Context, _ string) ([]*cloudprovider.Route, error) {
-	klog.Info("ListRoutes called")
+// getNodeRouteFilterTerms returns route terms of the Node like getRouteFilterTerms does. While kubelet hasn't reported
+// the addresses of a Node with the instanceIDLabel, next hops are taken from its Instance instead, as it may be up already.
+// Nodes with the nextHopInstanceIDAnnotation are routed through the annotated Instance regardless of their addresses.
+func (yc *Cloud) getNodeRouteFilterTerms(ctx context.Context, kubeNode *v1.Node, route *cloudprovider.Route, primaryAddresses map[string]struct{}) ([]routeFilterTerm, error) {
+	if err := checkNextHopGateway(kubeNode); err != nil {
+		return nil, err
+	}
+	if nextHopInstanceID := kubeNode.Annotations[nextHopInstanceIDAnnotation]; len(nextHopInstanceID) != 0 {
+		nextHopNode, err := yc.withNextHopInstanceAddresses(ctx, kubeNode, nextHopInstanceID)
+		if err != nil {
+			return nil, err
+		}
 
-	if routeAPILock.TryLock() {
-		defer routeAPILock.Unlock()
-	} else {
-		return nil, errors.New("VPC route API locked")
+		// the Instance is chosen explicitly, so neither primary addresses nor next hop CIDRs restrict its addresses
+		return getRouteFilterTerms(nextHopNode, route, nil, yc.config.RouteAddressFamilies, v1.NodeInternalIP, nil)
 	}
 
-	req := &vpc.GetRouteTableRequest{
-		RouteTableId: yc.config.RouteTableID,
+	terms, err := getRouteFilterTerms(kubeNode, route, primaryAddresses, yc.config.RouteAddressFamilies, yc.config.NextHopAddressType, yc.config.NextHopSubnetCIDRs)
+	instanceID := kubeNode.Labels[instanceIDLabel]
+	if !errors.Is(err, errNodeInternalIPNotReady) || len(instanceID) == 0 {
+		return terms, err
 	}
 
-	routeTable, err := yc.yandexService.VPCSvc.RouteTableSvc.Get(ctx, req)
+	instance, err := yc.getInstanceByNode(ctx, kubeNode)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get Instance %q of Node %q", instanceID, kubeNode.Name)
+	}
+	addresses, err := yc.extractNodeAddresses(ctx, instance)
 	if err != nil {
 		return nil, err
 	}
+	klog.V(2).InfoS("Node has no addresses reported yet, using addresses of its Instance", "operation", routeOperationCreate, "nodeName", kubeNode.Name, "instanceId", instance.Id)
 
-	var cpiRoutes []*cloudprovider.Route
-	for _, staticRoute := range routeTable.StaticRoutes {
-		var (
-			nodeName string
-			ok       bool
-		)
+	// Nodes are shared with the informer cache, so the addresses are put into a copy
+	nodeWithAddresses := kubeNode.DeepCopy()
+	nodeWithAddresses.Status.Addresses = addresses
 
-		if nodeName, ok = staticRoute.Labels[cpiNodeRoleLabel]; !ok {
-			continue
-		}
+	return getRouteFilterTerms(nodeWithAddresses, route, primaryAddresses, yc.config.RouteAddressFamilies, yc.config.NextHopAddressType, yc.config.NextHopSubnetCIDRs)
+}
 
-		cpiRoutes = append(cpiRoutes, &cloudprovider.Route{
-			Name:            nodeName,
-			TargetNode:      types.NodeName(nodeName),
-			DestinationCIDR: staticRoute.Destination.(*vpc.StaticRoute_DestinationPrefix).DestinationPrefix,
-		})
+// checkNextHopGateway fails for Nodes requesting a gateway next hop, so that they aren't silently routed to their addresses
+func checkNextHopGateway(kubeNode *v1.Node) error {
+	if gatewayID, ok := kubeNode.Annotations[nextHopGatewayIDAnnotation]; ok {
+		return errors.Wrapf(errNextHopGatewayNotSupported, "Node %q requests gateway %q as the next hop, StaticRoutes can only point to addresses", kubeNode.Name, gatewayID)
 	}
 
-	return cpiRoutes, nil
+	return nil
 }
 
-func (yc *Cloud) CreateRoute(ctx context.Context, _ string, _ string, route *cloudprovider.Route) error {
-	klog.Infof("CreateRoute called with %+v", *route)
+// withNextHopInstanceAddresses returns a copy of the Node with its addresses replaced by the primary addresses of
+// the first network interface of the Instance with nextHopInstanceID, as InternalIPs
+func (yc *Cloud) withNextHopInstanceAddresses(ctx context.Context, kubeNode *v1.Node, nextHopInstanceID string) (*v1.Node, error) {
+	instance, err := yc.getInstanceByID(ctx, nextHopInstanceID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get next hop Instance %q of Node %q", nextHopInstanceID, kubeNode.Name)
+	}
+	if len(instance.NetworkInterfaces) == 0 {
+		return nil, fmt.Errorf("next hop Instance %q of Node %q has no network interfaces", nextHopInstanceID, kubeNode.Name)
+	}
+
+	var addresses []v1.NodeAddress
+	iface := instance.NetworkInterfaces[0]
+	if iface.PrimaryV4Address != nil && len(iface.PrimaryV4Address.Address) != 0 {
+		addresses = append(addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: iface.PrimaryV4Address.Address})
+	}
+	if iface.PrimaryV6Address != nil && len(iface.PrimaryV6Address.Address) != 0 {
+		addresses = append(addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: iface.PrimaryV6Address.Address})
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("next hop Instance %q of Node %q has no primary addresses", nextHopInstanceID, kubeNode.Name)
+	}
+
+	nextHopNode := kubeNode.DeepCopy()
+	nextHopNode.Status.Addresses = addresses
+
+	return nextHopNode, nil
+}
 
-	if routeAPILock.TryLock() {
-		defer routeAPILock.Unlock()
-	} else {
-		return errors.New("VPC route API locked")
+// updateRouteTable applies all terms to the RouteTable in a single read-modify-write cycle.
+// If the RouteTable was modified concurrently, it is re-read and the terms are re-applied with an exponential backoff.
+func (yc *Cloud) updateRouteTable(ctx context.Context, rt *managedRouteTable, terms []routeFilterTerm) (err error) {
+	if len(terms) == 0 {
+		return nil
 	}
 
-	rt, err := yc.yandexService.VPCSvc.RouteTableSvc.Get(ctx, &vpc.GetRouteTableRequest{RouteTableId: yc.config.RouteTableID})
+	ctx, span := tracing.Start(ctx, "UpdateRouteTable", attribute.String("routeTableId", rt.id), attribute.Int("terms", len(terms)))
+	defer func() { tracing.End(span, err) }()
+
+	ctx, done, err := yc.drainer.begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer done()
 
-	kubeNodeName := string(route.TargetNode)
-	nextHop, err := yc.getInternalIpByNodeName(kubeNodeName)
-	if err != nil {
+	if err := yc.lockRouteTable(ctx, rt); err != nil {
 		return err
 	}
+	defer rt.lock.Unlock()
 
-	newStaticRoutes := filterStaticRoutes(rt.StaticRoutes, routeFilterTerm{
-		termType:        routeFilterAddOrUpdate,
-		nodeName:        kubeNodeName,
-		destinationCIDR: route.DestinationCIDR,
-		nextHop:         nextHop,
-	})
+	var lastErr error
+	err = wait.ExponentialBackoffWithContext(ctx, routeTableUpdateBackoff, func() (bool, error) {
+		routeTable, err := yc.getRouteTable(ctx, rt)
+		if err != nil {
+			return false, err
+		}
+
+		routeLabels := yc.newRouteLabels()
+		// most reconciliations change nothing, which is checked without rebuilding the whole StaticRoutes list
+		if rt.cache.index(routeLabels, routeTable).satisfies(routeLabels, terms) {
+			klog.InfoS("StaticRoutes in RouteTable are up to date, skipping update", "routeTableId", rt.id)
+			return true, nil
+		}
+
+		newStaticRoutes := filterStaticRoutes(routeLabels, routeTable.StaticRoutes, terms...)
+		if staticRoutesEqual(routeTable.StaticRoutes, newStaticRoutes) {
+			klog.InfoS("StaticRoutes in RouteTable are up to date, skipping update", "routeTableId", rt.id)
+			return true, nil
+		}
 
-	req := &vpc.UpdateRouteTableRequest{
-		RouteTableId: yc.config.RouteTableID,
-		UpdateMask: &field_mask.FieldMask{
-			Paths: []string{"static_routes"},
-		},
-		StaticRoutes: newStaticRoutes,
+		req := &vpc.UpdateRouteTableRequest{
+			RouteTableId: rt.id,
+			UpdateMask: &field_mask.FieldMask{
+				Paths: []string{"static_routes"},
+			},
+			StaticRoutes: newStaticRoutes,
+		}
+
+		start := time.Now()
+		_, op, err := yc.yandexService.OperationWaiter(ctx, func() (*operation.Operation, error) { return yc.yandexService.VPCSvc.RouteTableSvc.Update(ctx, req) })
+		observeRouteTableUpdate(start)
+		if op != nil && err == nil {
+			klog.InfoS("RouteTable updated", "routeTableId", rt.id, "operationId", op.Id(), "changes", len(terms))
+			yc.observeRouteTableSize(rt, len(newStaticRoutes))
+			yc.observeRouteAggregation(rt, newStaticRoutes)
+		}
+		// the RouteTable has changed or may be stale, either way it has to be re-read
+		rt.cache.invalidate()
+		if err != nil && isRouteTableConflict(err) {
+			klog.InfoS("RouteTable was modified concurrently, re-reading it and re-applying route changes", "routeTableId", rt.id, "changes", len(terms), "err", err)
+			lastErr = err
+			return false, nil
+		}
+		if err != nil && isRetryableOperationFailure(err) {
+			klog.InfoS("RouteTable update operation failed, re-reading RouteTable and re-applying route changes", "routeTableId", rt.id, "changes", len(terms), "err", err)
+			lastErr = err
+			return false, nil
+		}
+
+		return err == nil, err
+	})
+	if err == wait.ErrWaitTimeout {
+		return errors.Wrapf(lastErr, "failed to update RouteTable %q after %d attempts", rt.id, routeTableUpdateBackoff.Steps)
 	}
 
-	_, _, err = yc.yandexService.OperationWaiter(ctx, func() (*operation.Operation, error) { return yc.yandexService.VPCSvc.RouteTableSvc.Update(ctx, req) })
 	return err
 }
 
-func (yc *Cloud) DeleteRoute(ctx context.Context, _ string, route *cloudprovider.Route) error {
-	klog.Infof("DeleteRoute called with %+v", *route)
+// routeTableCacheTTL is how long a fetched RouteTable is reused by subsequent route operations
+const routeTableCacheTTL = 5 * time.Second
+
+// routeTableCache holds the last fetched RouteTable. It is only accessed with the RouteTable lock held.
+type routeTableCache struct {
+	routeTable *vpc.RouteTable
+	expiresAt  time.Time
 
-	if routeAPILock.TryLock() {
-		defer routeAPILock.Unlock()
-	} else {
-		return errors.New("VPC route API locked")
+	// routeIndex indexes indexedTable, it is rebuilt once the RouteTable is re-read
+	routeIndex   *staticRouteIndex
+	indexedTable *vpc.RouteTable
+}
+
+func (c *routeTableCache) get() *vpc.RouteTable {
+	if c.routeTable == nil || time.Now().After(c.expiresAt) {
+		return nil
 	}
 
-	rt, err := yc.yandexService.VPCSvc.RouteTableSvc.Get(ctx, &vpc.GetRouteTableRequest{RouteTableId: yc.config.RouteTableID})
-	if err != nil {
-		return err
+	return c.routeTable
+}
+
+func (c *routeTableCache) set(routeTable *vpc.RouteTable) {
+	c.routeTable = routeTable
+	c.expiresAt = time.Now().Add(routeTableCacheTTL)
+}
+
+func (c *routeTableCache) invalidate() {
+	c.routeTable = nil
+	c.routeIndex = nil
+	c.indexedTable = nil
+}
+
+// index returns the index of managed StaticRoutes of the RouteTable, building it once per fetched RouteTable
+func (c *routeTableCache) index(routeLabels routeLabels, routeTable *vpc.RouteTable) *staticRouteIndex {
+	if c.routeIndex == nil || c.indexedTable != routeTable {
+		c.routeIndex = newStaticRouteIndex(routeLabels, routeTable.StaticRoutes)
+		c.indexedTable = routeTable
 	}
 
-	nodeNameToDelete := string(route.TargetNode)
-	newStaticRoutes := filterStaticRoutes(rt.StaticRoutes, routeFilterTerm{
-		termType: routeFilterRemove,
-		nodeName: nodeNameToDelete,
-	})
+	return c.routeIndex
+}
+
+// staticRouteIndex maps managed StaticRoutes to their keys. It only points to the RouteTable's StaticRoutes,
+// so its size is bounded by the number of managed routes.
+type staticRouteIndex struct {
+	routes map[routeKey][]*vpc.StaticRoute
+	// nodeRoutes counts routes of every Node
+	nodeRoutes map[string]int
+	// defaultRoutes are the default routes managed by this cluster, there should be at most one
+	defaultRoutes []*vpc.StaticRoute
+}
+
+func newStaticRouteIndex(routeLabels routeLabels, staticRoutes []*vpc.StaticRoute) *staticRouteIndex {
+	index := &staticRouteIndex{
+		routes:     make(map[routeKey][]*vpc.StaticRoute),
+		nodeRoutes: make(map[string]int),
+	}
+	for _, staticRoute := range staticRoutes {
+		if routeLabels.isDefaultRoute(staticRoute) {
+			index.defaultRoutes = append(index.defaultRoutes, staticRoute)
+			continue
+		}
+		nodeName, ok := routeLabels.getNodeName(staticRoute)
+		if !ok {
+			continue
+		}
 
-	req := &vpc.UpdateRouteTableRequest{
-		RouteTableId: yc.config.RouteTableID,
-		UpdateMask: &field_mask.FieldMask{
-			Paths: []string{"static_routes"},
-		},
-		StaticRoutes: newStaticRoutes,
+		key := routeLabels.keyOf(nodeName, staticRoute)
+		index.routes[key] = append(index.routes[key], staticRoute)
+		index.nodeRoutes[nodeName]++
 	}
 
-	_, _, err = yc.yandexService.OperationWaiter(ctx, func() (*operation.Operation, error) { return yc.yandexService.VPCSvc.RouteTableSvc.Update(ctx, req) })
-	return err
+	return index
+}
+
+// satisfies reports whether applying the terms wouldn't change the indexed StaticRoutes
+func (index *staticRouteIndex) satisfies(routeLabels routeLabels, terms []routeFilterTerm) bool {
+	for _, term := range terms {
+		if term.termType == routeFilterRemove {
+			if index.nodeRoutes[term.nodeName] > 0 {
+				return false
+			}
+			continue
+		}
+
+		// duplicate routes are removed on update
+		staticRoutes := index.routes[term.key()]
+		if term.termType == routeFilterDefaultRoute {
+			staticRoutes = index.defaultRoutes
+		}
+		if len(staticRoutes) != 1 {
+			return false
+		}
+		for _, staticRoute := range staticRoutes {
+			if staticRoute.GetNextHopAddress() != term.nextHop || staticRoute.GetDestinationPrefix() != term.destinationCIDR {
+				return false
+			}
+			// routes lacking the cluster label are claimed on update
+			if len(routeLabels.clusterName) > 0 && staticRoute.Labels[routeLabels.cluster] != routeLabels.clusterName {
+				return false
+			}
+		}
+	}
+
+	return true
 }
 
-func (yc *Cloud) getInternalIpByNodeName(nodeName string) (string, error) {
-	kubeNode, err := yc.nodeLister.Get(nodeName)
+// getRouteTable returns the RouteTable from the cache or the API. Must be called with the RouteTable lock held.
+func (yc *Cloud) getRouteTable(ctx context.Context, rt *managedRouteTable) (*vpc.RouteTable, error) {
+	if routeTable := rt.cache.get(); routeTable != nil {
+		return routeTable, nil
+	}
+
+	routeTable, err := yc.yandexService.VPCSvc.RouteTableSvc.Get(ctx, &vpc.GetRouteTableRequest{RouteTableId: rt.id})
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	rt.cache.set(routeTable)
+	yc.observeRouteTableSize(rt, len(routeTable.StaticRoutes))
+	yc.observeRouteAggregation(rt, routeTable.StaticRoutes)
+
+	return routeTable, nil
+}
+
+// staticRoutesEqual compares StaticRoutes by destination, next hop and labels regardless of their order
+func staticRoutesEqual(a, b []*vpc.StaticRoute) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	counts := make(map[string]int, len(a))
+	for _, staticRoute := range a {
+		counts[staticRouteFingerprint(staticRoute)]++
+	}
+	for _, staticRoute := range b {
+		fingerprint := staticRouteFingerprint(staticRoute)
+		if counts[fingerprint] == 0 {
+			return false
+		}
+		counts[fingerprint]--
+	}
+
+	return true
+}
+
+func staticRouteFingerprint(staticRoute *vpc.StaticRoute) string {
+	labelKeys := make([]string, 0, len(staticRoute.Labels))
+	for key := range staticRoute.Labels {
+		labelKeys = append(labelKeys, key)
+	}
+	sort.Strings(labelKeys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s|%s", staticRoute.GetDestinationPrefix(), staticRoute.GetNextHopAddress())
+	for _, key := range labelKeys {
+		fmt.Fprintf(&b, "|%s=%s", key, staticRoute.Labels[key])
+	}
+
+	return b.String()
+}
+
+func isRouteTableConflict(err error) bool {
+	return errors.Is(yapi.WrapError(err), yapi.ErrConflict)
+}
+
+// isRetryableOperationFailure reports whether the update operation has completed with an error a fresh attempt
+// may not run into. Such an update hasn't been applied, so it's safe to re-apply it to the re-read RouteTable.
+func isRetryableOperationFailure(err error) bool {
+	var opErr *yapi.OperationError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+
+	switch opErr.Status.Code() {
+	case codes.Unavailable, codes.Internal:
+		return true
+	default:
+		return false
+	}
+}
+
+// getNodeNextHop returns the Node's address of the addressType and family to route its PodCIDRs to, InternalIP is the default type.
+// allowedCIDRs only restrict InternalIPs.
+func getNodeNextHop(kubeNode *v1.Node, family v1.IPFamily, primaryAddresses map[string]struct{}, addressType v1.NodeAddressType, allowedCIDRs []*net.IPNet) (string, error) {
+	if len(addressType) == 0 || addressType == v1.NodeInternalIP {
+		return getNodeInternalIP(kubeNode, family, primaryAddresses, allowedCIDRs)
+	}
+
+	for _, address := range kubeNode.Status.Addresses {
+		if address.Type == addressType && ipFamilyOfIP(address.Address) == family {
+			return address.Address, nil
+		}
+	}
+	if len(kubeNode.Status.Addresses) == 0 {
+		return "", errors.Wrapf(errNodeInternalIPNotReady, "Node %q", kubeNode.Name)
+	}
+
+	return "", fmt.Errorf("no %s %s addresses found for Node %q to use as the next hop", family, addressType, kubeNode.Name)
+}
+
+// getNodeInternalIP returns the first InternalIP of the family found in primaryAddresses,
+// or just the first InternalIP of the family if there are none. InternalIPs outside of allowedCIDRs are skipped,
+// empty allowedCIDRs allow all of them.
+func getNodeInternalIP(kubeNode *v1.Node, family v1.IPFamily, primaryAddresses map[string]struct{}, allowedCIDRs []*net.IPNet) (string, error) {
+	var internalIPs, disallowedIPs []string
+	for _, address := range kubeNode.Status.Addresses {
+		if address.Type != v1.NodeInternalIP || ipFamilyOfIP(address.Address) != family {
+			continue
+		}
+		if !ipWithinAny(address.Address, allowedCIDRs) {
+			disallowedIPs = append(disallowedIPs, address.Address)
+			continue
+		}
+		internalIPs = append(internalIPs, address.Address)
+	}
+	if len(internalIPs) == 0 {
+		if !hasInternalIP(kubeNode) {
+			return "", errors.Wrapf(errNodeInternalIPNotReady, "Node %q", kubeNode.Name)
+		}
+		if len(disallowedIPs) > 0 {
+			return "", fmt.Errorf("none of %s InternalIPs %v of Node %q are within next hop subnet CIDRs", family, disallowedIPs, kubeNode.Name)
+		}
+		return "", fmt.Errorf("no %s InternalIPs found for Node %q", family, kubeNode.Name)
 	}
 
-	var targetInternalIP string
+	for _, internalIP := range internalIPs {
+		if _, ok := primaryAddresses[internalIP]; ok {
+			return internalIP, nil
+		}
+	}
+	if len(primaryAddresses) > 0 {
+		klog.InfoS("None of Node InternalIPs are in the primary network, using the first one as the next hop", "nodeName", kubeNode.Name, "family", family, "internalIPs", internalIPs, "nextHop", internalIPs[0])
+	}
+
+	return internalIPs[0], nil
+}
+
+func hasInternalIP(kubeNode *v1.Node) bool {
 	for _, address := range kubeNode.Status.Addresses {
 		if address.Type == v1.NodeInternalIP {
-			targetInternalIP = address.Address
+			return true
+		}
+	}
+
+	return false
+}
+
+// getPrimaryAddresses returns the primary addresses of the Node Instance's network interfaces attached to
+// the configured primary Subnet or Network. It returns nil if neither is configured.
+func (yc *Cloud) getPrimaryAddresses(ctx context.Context, kubeNode *v1.Node) (map[string]struct{}, error) {
+	if len(yc.config.PrimarySubnetID) == 0 && len(yc.config.PrimaryNetworkID) == 0 {
+		return nil, nil
+	}
+
+	interfaces, err := yc.getNodeInterfaces(ctx, kubeNode)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make(map[string]struct{})
+	for _, nodeIface := range interfaces {
+		if len(yc.config.PrimarySubnetID) > 0 {
+			if nodeIface.iface.SubnetId != yc.config.PrimarySubnetID {
+				continue
+			}
+		} else if nodeIface.networkID != yc.config.PrimaryNetworkID {
+			continue
+		}
+
+		if address := nodeIface.ipv4(); len(address) != 0 {
+			addresses[address] = struct{}{}
+		}
+		if address := nodeIface.ipv6(); len(address) != 0 {
+			addresses[address] = struct{}{}
+		}
+	}
+
+	return addresses, nil
+}
+
+func ipFamilyOfIP(ip string) v1.IPFamily {
+	if netutils.IsIPv6String(ip) {
+		return v1.IPv6Protocol
+	}
+
+	return v1.IPv4Protocol
+}
+
+// cidrWithinAny reports whether the cidr is contained in one of the supernets, any cidr is for empty supernets
+func cidrWithinAny(cidr string, supernets []*net.IPNet) bool {
+	if len(supernets) == 0 {
+		return true
+	}
+
+	ip, ipNet, err := netutils.ParseCIDRSloppy(cidr)
+	if err != nil {
+		return false
+	}
+	ones, bits := ipNet.Mask.Size()
+
+	for _, supernet := range supernets {
+		supernetOnes, supernetBits := supernet.Mask.Size()
+		if supernetBits == bits && supernetOnes <= ones && supernet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ipWithinAny reports whether ip is within one of the supernets, empty supernets contain everything
+func ipWithinAny(ip string, supernets []*net.IPNet) bool {
+	if len(supernets) == 0 {
+		return true
+	}
+
+	parsed := netutils.ParseIPSloppy(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, supernet := range supernets {
+		if supernet.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// routeFamilyEnabled reports whether routes of the family are managed, routeFamilies hold "ipv4" and "ipv6" values
+func routeFamilyEnabled(routeFamilies []string, family v1.IPFamily) bool {
+	if len(routeFamilies) == 0 {
+		return true
+	}
+
+	for _, routeFamily := range routeFamilies {
+		if strings.EqualFold(routeFamily, string(family)) {
+			return true
 		}
 	}
-	if len(targetInternalIP) == 0 {
-		return "", fmt.Errorf("no InternalIPs found for Node %q", nodeName)
+
+	return false
+}
+
+// staticRouteDestinationPrefix returns the StaticRoute's destination CIDR, ok is false for destination types other than
+// a prefix, which route tables managed by other tools may contain
+func staticRouteDestinationPrefix(staticRoute *vpc.StaticRoute) (string, bool) {
+	switch destination := staticRoute.Destination.(type) {
+	case *vpc.StaticRoute_DestinationPrefix:
+		return destination.DestinationPrefix, true
+	default:
+		return "", false
+	}
+}
+
+func ipFamilyOfCIDR(cidr string) v1.IPFamily {
+	if netutils.IsIPv6CIDRString(cidr) {
+		return v1.IPv6Protocol
 	}
 
-	return targetInternalIP, nil
+	return v1.IPv4Protocol
 }
 
 type routeFilterTerm struct {
 	termType        routeFilterTermType
 	nodeName        string
+	podCIDRIndex    int
 	destinationCIDR string
 	nextHop         string
 }
@@ -164,65 +1411,242 @@ type routeFilterTermType string
 const (
 	routeFilterAddOrUpdate routeFilterTermType = "AddOrUpdate"
 	routeFilterRemove      routeFilterTermType = "Remove"
+	// routeFilterDefaultRoute terms program the default route, which belongs to no Node
+	routeFilterDefaultRoute routeFilterTermType = "DefaultRoute"
 )
 
-func filterStaticRoutes(staticRoutes []*vpc.StaticRoute, filterTerms ...routeFilterTerm) (ret []*vpc.StaticRoute) {
-	var nodeNamesUpdatedSet = make(map[string]struct{})
+// routeKey identifies a managed StaticRoute, each Node has one route per PodCIDR
+type routeKey struct {
+	nodeName        string
+	podCIDRIndex    int
+	destinationCIDR string
+}
 
-	for _, existingStaticRoute := range staticRoutes {
-		var (
-			nodeName string
-			ok       bool
-		)
+// key returns the key of the route the AddOrUpdate term programs
+func (term routeFilterTerm) key() routeKey {
+	return routeKey{nodeName: term.nodeName, podCIDRIndex: term.podCIDRIndex, destinationCIDR: term.destinationCIDR}
+}
 
-		if nodeName, ok = existingStaticRoute.Labels[cpiNodeRoleLabel]; !ok {
-			ret = append(ret, existingStaticRoute)
+// keyOf returns the key of the managed StaticRoute of the Node
+func (rl routeLabels) keyOf(nodeName string, staticRoute *vpc.StaticRoute) routeKey {
+	return routeKey{nodeName: nodeName, podCIDRIndex: rl.getPodCIDRIndex(staticRoute), destinationCIDR: staticRoute.GetDestinationPrefix()}
+}
+
+func (rl routeLabels) getPodCIDRIndex(staticRoute *vpc.StaticRoute) int {
+	index, err := strconv.Atoi(staticRoute.Labels[rl.podCIDRIndex])
+	if err != nil {
+		return 0
+	}
+
+	return index
+}
+
+func routeName(nodeName string, podCIDRIndex int) string {
+	if podCIDRIndex == 0 {
+		return nodeName
+	}
+
+	return nodeName + "-" + strconv.Itoa(podCIDRIndex)
+}
+
+func (rl routeLabels) forRoute(nodeName string, podCIDRIndex int) map[string]string {
+	labels := map[string]string{
+		rl.nodeRole:     nodeName,
+		rl.podCIDRIndex: strconv.Itoa(podCIDRIndex),
+	}
+	if len(rl.clusterName) > 0 {
+		labels[rl.cluster] = rl.clusterName
+	}
+
+	return labels
+}
+
+// withCluster returns a copy of the existing route's labels with the cluster label added, so that routes created
+// before the label was introduced are claimed by the cluster
+func (rl routeLabels) withCluster(labels map[string]string) map[string]string {
+	if len(rl.clusterName) == 0 || labels[rl.cluster] == rl.clusterName {
+		return labels
+	}
+
+	newLabels := make(map[string]string, len(labels)+1)
+	for key, value := range labels {
+		newLabels[key] = value
+	}
+	newLabels[rl.cluster] = rl.clusterName
+
+	return newLabels
+}
+
+// filterStaticRoutes applies terms to the managed StaticRoutes. AddOrUpdate terms are matched on (nodeName, podCIDRIndex,
+// destinationCIDR), so distinct destinations of a Node are all programmed, and duplicate terms are applied once with
+// the last one winning. A route whose PodCIDR index has terms, but none for its destination, is replaced by one of them
+// in place. Remove terms delete all routes of the Node, superseding its preceding AddOrUpdate terms.
+// The last DefaultRoute term replaces the default route of the cluster, unless a route to the destination exists already.
+func filterStaticRoutes(routeLabels routeLabels, staticRoutes []*vpc.StaticRoute, filterTerms ...routeFilterTerm) (ret []*vpc.StaticRoute) {
+	// AddOrUpdate terms are deduplicated keeping the order of their first occurrence and grouped by Node,
+	// so that large RouteTables are filtered in linear time
+	var addKeys []routeKey
+	addTerms := make(map[routeKey]routeFilterTerm)
+	nodeAddKeys := make(map[string][]routeKey)
+	removedNodes := make(map[string]struct{})
+	var defaultTerm *routeFilterTerm
+	for _, filter := range filterTerms {
+		if filter.termType == routeFilterDefaultRoute {
+			filter := filter
+			defaultTerm = &filter
+			continue
+		}
+		if filter.termType == routeFilterRemove {
+			for _, key := range nodeAddKeys[filter.nodeName] {
+				delete(addTerms, key)
+			}
+			delete(nodeAddKeys, filter.nodeName)
+			removedNodes[filter.nodeName] = struct{}{}
 			continue
 		}
 
-		var deleteRoute bool
-		var routeAppended bool
-		for _, filter := range filterTerms {
-			if nodeName != filter.nodeName {
+		key := filter.key()
+		previous, ok := addTerms[key]
+		switch {
+		case !ok:
+			addKeys = append(addKeys, key)
+			nodeAddKeys[filter.nodeName] = append(nodeAddKeys[filter.nodeName], key)
+		case previous.nextHop != filter.nextHop:
+			klog.InfoS("Conflicting route changes, applying the latest one", "nodeName", filter.nodeName, "destinationCIDR", filter.destinationCIDR, "nextHop", filter.nextHop, "previousNextHop", previous.nextHop)
+		}
+		addTerms[key] = filter
+	}
+
+	existingKeys := make(map[routeKey]struct{})
+	for _, existingStaticRoute := range staticRoutes {
+		if nodeName, ok := routeLabels.getNodeName(existingStaticRoute); ok {
+			existingKeys[routeLabels.keyOf(nodeName, existingStaticRoute)] = struct{}{}
+		}
+	}
+
+	// replacementFor returns a term of the route's PodCIDR index whose destination has no route yet
+	applied := make(map[routeKey]struct{})
+	replacementFor := func(key routeKey) (routeFilterTerm, bool) {
+		for _, candidate := range nodeAddKeys[key.nodeName] {
+			if candidate.podCIDRIndex != key.podCIDRIndex {
 				continue
 			}
+			_, exists := existingKeys[candidate]
+			_, done := applied[candidate]
+			if _, ok := addTerms[candidate]; ok && !exists && !done {
+				return addTerms[candidate], true
+			}
+		}
 
-			if filter.termType == routeFilterAddOrUpdate {
-				ret = append(ret, &vpc.StaticRoute{
-					Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: filter.destinationCIDR},
-					NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: filter.nextHop},
-					Labels:      existingStaticRoute.Labels,
-				})
+		return routeFilterTerm{}, false
+	}
 
-				nodeNamesUpdatedSet[nodeName] = struct{}{}
-				routeAppended = true
-				break
+	var defaultApplied bool
+	ret = make([]*vpc.StaticRoute, 0, len(staticRoutes)+len(addKeys)+1)
+	for _, existingStaticRoute := range staticRoutes {
+		if defaultTerm != nil && routeLabels.isDefaultRoute(existingStaticRoute) {
+			if defaultApplied {
+				klog.InfoS("Removing duplicate default StaticRoute from Yandex.Cloud", "destinationCIDR", existingStaticRoute.GetDestinationPrefix(), "nextHop", existingStaticRoute.GetNextHopAddress())
+				continue
 			}
+			ret = append(ret, &vpc.StaticRoute{
+				Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: defaultTerm.destinationCIDR},
+				NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: defaultTerm.nextHop},
+				Labels:      routeLabels.withCluster(existingStaticRoute.Labels),
+			})
+			defaultApplied = true
+			continue
+		}
 
-			if filter.termType == routeFilterRemove {
-				klog.Infof("Removing %+v StaticRoute from Yandex.Cloud", existingStaticRoute)
-				deleteRoute = true
-				break
-			}
+		nodeName, ok := routeLabels.getNodeName(existingStaticRoute)
+		if !ok {
+			ret = append(ret, existingStaticRoute)
+			continue
+		}
+		if _, removed := removedNodes[nodeName]; removed {
+			klog.InfoS("Removing StaticRoute from Yandex.Cloud", "nodeName", nodeName, "destinationCIDR", existingStaticRoute.GetDestinationPrefix(), "nextHop", existingStaticRoute.GetNextHopAddress())
+			continue
 		}
 
-		if !deleteRoute && !routeAppended {
+		key := routeLabels.keyOf(nodeName, existingStaticRoute)
+		filter, ok := addTerms[key]
+		if !ok {
+			filter, ok = replacementFor(key)
+		}
+		if !ok {
 			ret = append(ret, existingStaticRoute)
+			continue
+		}
+		if _, done := applied[filter.key()]; done {
+			klog.InfoS("Removing duplicate StaticRoute from Yandex.Cloud", "nodeName", nodeName, "destinationCIDR", existingStaticRoute.GetDestinationPrefix(), "nextHop", existingStaticRoute.GetNextHopAddress())
+			continue
 		}
+
+		ret = append(ret, &vpc.StaticRoute{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: filter.destinationCIDR},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: filter.nextHop},
+			Labels:      routeLabels.withCluster(existingStaticRoute.Labels),
+		})
+		applied[filter.key()] = struct{}{}
 	}
 
 	// final iteration to add missing routes
-	for _, filter := range filterTerms {
-		if filter.termType == routeFilterAddOrUpdate {
-			if _, updated := nodeNamesUpdatedSet[filter.nodeName]; !updated {
-				ret = append(ret, &vpc.StaticRoute{
-					Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: filter.destinationCIDR},
-					NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: filter.nextHop},
-					Labels:      map[string]string{cpiNodeRoleLabel: filter.nodeName},
-				})
-			}
+	for _, key := range addKeys {
+		filter, ok := addTerms[key]
+		if _, done := applied[key]; !ok || done {
+			continue
+		}
+
+		ret = append(ret, &vpc.StaticRoute{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: filter.destinationCIDR},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: filter.nextHop},
+			Labels:      routeLabels.forRoute(filter.nodeName, filter.podCIDRIndex),
+		})
+	}
+
+	if defaultTerm != nil && !defaultApplied {
+		if conflicting := findStaticRouteTo(staticRoutes, defaultTerm.destinationCIDR); conflicting != nil {
+			klog.ErrorS(nil, "RouteTable already has an unmanaged route to the default route destination, leaving it intact",
+				"destinationCIDR", defaultTerm.destinationCIDR, "nextHop", conflicting.GetNextHopAddress())
+		} else {
+			ret = append(ret, &vpc.StaticRoute{
+				Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: defaultTerm.destinationCIDR},
+				NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: defaultTerm.nextHop},
+				Labels:      routeLabels.forDefaultRoute(),
+			})
 		}
 	}
 
+	sortStaticRoutes(routeLabels, ret)
+
 	return
 }
+
+func findStaticRouteTo(staticRoutes []*vpc.StaticRoute, destinationCIDR string) *vpc.StaticRoute {
+	for _, staticRoute := range staticRoutes {
+		if staticRoute.GetDestinationPrefix() == destinationCIDR {
+			return staticRoute
+		}
+	}
+
+	return nil
+}
+
+// sortStaticRoutes orders StaticRoutes by destination prefix, then by Node name and next hop,
+// so that the RouteTable contents don't shift between updates
+func sortStaticRoutes(routeLabels routeLabels, staticRoutes []*vpc.StaticRoute) {
+	sort.SliceStable(staticRoutes, func(i, j int) bool {
+		a, b := staticRoutes[i], staticRoutes[j]
+		if a.GetDestinationPrefix() != b.GetDestinationPrefix() {
+			return a.GetDestinationPrefix() < b.GetDestinationPrefix()
+		}
+
+		aNodeName, _ := routeLabels.getNodeName(a)
+		bNodeName, _ := routeLabels.getNodeName(b)
+		if aNodeName != bNodeName {
+			return aNodeName < bNodeName
+		}
+
+		return a.GetNextHopAddress() < b.GetNextHopAddress()
+	})
+}
@@ -0,0 +1,94 @@
+package yandex
+
+import (
+	"net"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
+	netutils "k8s.io/utils/net"
+)
+
+// TODO: merge the StaticRoutes into supernets behind a config flag once routes are no longer tracked by their Node
+// labels. Until then the potential is only exported as a metric, so that very large clusters can tell whether
+// contiguous PodCIDRs would keep them under the RouteTable quota.
+
+// observeRouteAggregation exports how many StaticRoutes aggregation would save in the RouteTable.
+// It is called with the RouteTable lock held.
+func (yc *Cloud) observeRouteAggregation(rt *managedRouteTable, staticRoutes []*vpc.StaticRoute) {
+	observeRouteTableAggregatableRoutes(rt.id, countAggregatableRoutes(yc.newRouteLabels(), staticRoutes))
+}
+
+// countAggregatableRoutes returns by how many StaticRoutes the cluster's ones would shrink if sibling destination
+// prefixes with identical next hops were merged into their supernets, repeatedly. Routes of different Nodes
+// rarely share next hops, except for Nodes routed through the same Instance.
+func countAggregatableRoutes(routeLabels routeLabels, staticRoutes []*vpc.StaticRoute) int {
+	prefixesByNextHop := make(map[string][]*net.IPNet)
+	var managed int
+	for _, staticRoute := range staticRoutes {
+		if _, ok := routeLabels.getNodeName(staticRoute); !ok {
+			continue
+		}
+		_, prefix, err := netutils.ParseCIDRSloppy(staticRoute.GetDestinationPrefix())
+		if err != nil {
+			continue
+		}
+
+		nextHop := staticRoute.GetNextHopAddress()
+		prefixesByNextHop[nextHop] = append(prefixesByNextHop[nextHop], prefix)
+		managed++
+	}
+
+	var aggregated int
+	for _, prefixes := range prefixesByNextHop {
+		aggregated += len(aggregatePrefixes(prefixes))
+	}
+
+	return managed - aggregated
+}
+
+// aggregatePrefixes merges sibling prefixes into their supernets until none are left, duplicates are merged too
+func aggregatePrefixes(prefixes []*net.IPNet) []*net.IPNet {
+	set := make(map[string]*net.IPNet, len(prefixes))
+	for _, prefix := range prefixes {
+		set[prefix.String()] = prefix
+	}
+
+	for merged := true; merged; {
+		merged = false
+		for key, prefix := range set {
+			ones, bits := prefix.Mask.Size()
+			if ones == 0 {
+				continue
+			}
+
+			sibling := siblingPrefix(prefix)
+			if _, ok := set[sibling.String()]; !ok {
+				continue
+			}
+
+			supernet := &net.IPNet{IP: prefix.IP.Mask(net.CIDRMask(ones-1, bits)), Mask: net.CIDRMask(ones-1, bits)}
+			delete(set, key)
+			delete(set, sibling.String())
+			set[supernet.String()] = supernet
+			merged = true
+			// the map was modified, so the iteration starts over
+			break
+		}
+	}
+
+	ret := make([]*net.IPNet, 0, len(set))
+	for _, prefix := range set {
+		ret = append(ret, prefix)
+	}
+
+	return ret
+}
+
+// siblingPrefix returns the other half of the prefix's supernet
+func siblingPrefix(prefix *net.IPNet) *net.IPNet {
+	ones, _ := prefix.Mask.Size()
+	ip := make(net.IP, len(prefix.IP))
+	copy(ip, prefix.IP)
+	ip[(ones-1)/8] ^= 1 << (7 - uint((ones-1)%8))
+
+	return &net.IPNet{IP: ip, Mask: prefix.Mask}
+}
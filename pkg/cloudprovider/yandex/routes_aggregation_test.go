@@ -0,0 +1,58 @@
+package yandex
+
+import (
+	"testing"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
+)
+
+func TestCountAggregatableRoutes(t *testing.T) {
+	routeLabels := newRouteLabels(defaultRouteLabelsPrefix, "", false)
+	staticRoute := func(nodeName, destinationPrefix, nextHop string) *vpc.StaticRoute {
+		route := &vpc.StaticRoute{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: destinationPrefix},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: nextHop},
+		}
+		if len(nodeName) != 0 {
+			route.Labels = map[string]string{routeLabels.nodeRole: nodeName}
+		}
+		return route
+	}
+
+	tests := []struct {
+		name         string
+		staticRoutes []*vpc.StaticRoute
+		expected     int
+	}{
+		{"distinct next hops", []*vpc.StaticRoute{
+			staticRoute("node-a", "10.0.0.0/24", "192.168.0.1"),
+			staticRoute("node-b", "10.0.1.0/24", "192.168.0.2"),
+		}, 0},
+		{"siblings merged repeatedly", []*vpc.StaticRoute{
+			staticRoute("node-a", "10.0.0.0/24", "192.168.0.1"),
+			staticRoute("node-b", "10.0.1.0/24", "192.168.0.1"),
+			staticRoute("node-c", "10.0.2.0/24", "192.168.0.1"),
+			staticRoute("node-d", "10.0.3.0/24", "192.168.0.1"),
+		}, 3},
+		{"adjacent but not siblings", []*vpc.StaticRoute{
+			staticRoute("node-a", "10.0.1.0/24", "192.168.0.1"),
+			staticRoute("node-b", "10.0.2.0/24", "192.168.0.1"),
+		}, 0},
+		{"IPv6 siblings", []*vpc.StaticRoute{
+			staticRoute("node-a", "fd00:0:0:0::/64", "fd01::1"),
+			staticRoute("node-b", "fd00:0:0:1::/64", "fd01::1"),
+		}, 1},
+		{"unmanaged routes are left alone", []*vpc.StaticRoute{
+			staticRoute("node-a", "10.0.0.0/24", "192.168.0.1"),
+			staticRoute("", "10.0.1.0/24", "192.168.0.1"),
+		}, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := countAggregatableRoutes(routeLabels, tc.staticRoutes); actual != tc.expected {
+				t.Errorf("expected %d aggregatable routes, got %d", tc.expected, actual)
+			}
+		})
+	}
+}
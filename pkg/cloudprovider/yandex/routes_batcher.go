@@ -0,0 +1,118 @@
+package yandex
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// routeBatchDelay is the window during which individual CreateRoute/DeleteRoute calls are coalesced into one RouteTable update
+const routeBatchDelay = 2 * time.Second
+
+type routeBatchApplyFunc func(ctx context.Context, terms []routeFilterTerm) error
+
+// routeBatcher collects routeFilterTerms submitted by concurrent callers and applies them
+// with a single RouteTable update once the batching window expires.
+type routeBatcher struct {
+	delay time.Duration
+	apply routeBatchApplyFunc
+
+	mu      sync.Mutex
+	pending []*pendingRouteFilterTerms
+	timer   *time.Timer
+}
+
+type pendingRouteFilterTerms struct {
+	terms  []routeFilterTerm
+	result chan error
+}
+
+func newRouteBatcher(delay time.Duration, apply routeBatchApplyFunc) *routeBatcher {
+	return &routeBatcher{
+		delay: delay,
+		apply: apply,
+	}
+}
+
+// Submit enqueues terms and blocks until the batch containing them is applied or ctx is done.
+func (rb *routeBatcher) Submit(ctx context.Context, terms ...routeFilterTerm) error {
+	pending := &pendingRouteFilterTerms{
+		terms:  terms,
+		result: make(chan error, 1),
+	}
+
+	rb.mu.Lock()
+	rb.pending = append(rb.pending, pending)
+	if rb.timer == nil {
+		rb.timer = time.AfterFunc(rb.delay, rb.flush)
+	}
+	rb.mu.Unlock()
+
+	select {
+	case err := <-pending.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (rb *routeBatcher) flush() {
+	rb.mu.Lock()
+	batch := rb.pending
+	rb.pending = nil
+	rb.timer = nil
+	rb.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	var terms []routeFilterTerm
+	for _, pending := range batch {
+		terms = append(terms, pending.terms...)
+	}
+
+	klog.InfoS("Applying a batch of route changes", "changes", len(terms))
+	err := rb.apply(context.Background(), mergeRouteFilterTerms(terms))
+
+	for _, pending := range batch {
+		pending.result <- err
+	}
+}
+
+// mergeRouteFilterTerms collapses terms targeting the same route, so that the latest submitted one wins.
+// A Remove term supersedes all previously submitted terms for the Node.
+func mergeRouteFilterTerms(terms []routeFilterTerm) []routeFilterTerm {
+	// superseded terms are marked instead of being removed, so that indexes stay valid and the order is kept
+	superseded := make([]bool, len(terms))
+	byKey := make(map[routeKey]int)
+	byNode := make(map[string][]int)
+
+	for i, term := range terms {
+		switch term.termType {
+		case routeFilterRemove:
+			for _, j := range byNode[term.nodeName] {
+				superseded[j] = true
+			}
+			delete(byNode, term.nodeName)
+		case routeFilterAddOrUpdate:
+			if j, ok := byKey[term.key()]; ok {
+				superseded[j] = true
+			}
+			byKey[term.key()] = i
+		}
+
+		byNode[term.nodeName] = append(byNode[term.nodeName], i)
+	}
+
+	ret := make([]routeFilterTerm, 0, len(terms))
+	for i, term := range terms {
+		if !superseded[i] {
+			ret = append(ret, term)
+		}
+	}
+
+	return ret
+}
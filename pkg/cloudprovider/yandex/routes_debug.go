@@ -0,0 +1,166 @@
+package yandex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"text/tabwriter"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+)
+
+// routeDumpEntry describes a StaticRoute managed by the CCM together with the state of its Node.
+// Unmanaged routes of other clusters' Nodes are dumped with RouteReportForeign only, their Nodes aren't looked up.
+type routeDumpEntry struct {
+	RouteTableID    string `json:"routeTableId"`
+	NodeName        string `json:"nodeName"`
+	PodCIDRIndex    int    `json:"podCIDRIndex"`
+	DestinationCIDR string `json:"destinationCIDR"`
+	NextHop         string `json:"nextHop"`
+	NodeExists      bool   `json:"nodeExists"`
+	Unmanaged       bool   `json:"unmanaged,omitempty"`
+	// ExpectedNextHop is the next hop the route would be programmed with now, empty if it can't be determined
+	ExpectedNextHop string `json:"expectedNextHop,omitempty"`
+	Problem         string `json:"problem,omitempty"`
+}
+
+// dumpRoutes returns all StaticRoutes managed by the CCM, flagging routes of deleted Nodes and ones with outdated next hops
+func (yc *Cloud) dumpRoutes(ctx context.Context) ([]routeDumpEntry, error) {
+	routeLabels := yc.newRouteLabels()
+
+	var entries []routeDumpEntry
+	for _, rt := range yc.routeTables {
+		if err := yc.lockRouteTable(ctx, rt); err != nil {
+			return nil, err
+		}
+		routeTable, err := yc.getRouteTable(ctx, rt)
+		rt.lock.Unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, staticRoute := range routeTable.StaticRoutes {
+			nodeName, managed := routeLabels.getNodeName(staticRoute)
+			if len(nodeName) == 0 || !managed && !yc.config.RouteReportForeign {
+				continue
+			}
+
+			entry := routeDumpEntry{
+				RouteTableID: rt.id,
+				NodeName:     nodeName,
+				PodCIDRIndex: routeLabels.getPodCIDRIndex(staticRoute),
+				NextHop:      staticRoute.GetNextHopAddress(),
+				Unmanaged:    !managed,
+			}
+			var ok bool
+			entry.DestinationCIDR, ok = staticRouteDestinationPrefix(staticRoute)
+			if !ok {
+				entry.Problem = "unsupported destination type"
+				entries = append(entries, entry)
+				continue
+			}
+			if entry.Unmanaged {
+				entries = append(entries, entry)
+				continue
+			}
+
+			kubeNode, err := yc.nodeLister.Get(nodeName)
+			switch {
+			case apierrors.IsNotFound(err):
+				entry.Problem = "orphaned: Node does not exist"
+			case err != nil:
+				return nil, err
+			default:
+				entry.NodeExists = true
+
+				entry.ExpectedNextHop, err = yc.expectedNextHop(ctx, kubeNode, ipFamilyOfCIDR(entry.DestinationCIDR))
+				if err != nil {
+					entry.Problem = err.Error()
+				} else if entry.ExpectedNextHop != entry.NextHop {
+					entry.Problem = "mismatched next hop"
+				}
+			}
+
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].RouteTableID != entries[j].RouteTableID {
+			return entries[i].RouteTableID < entries[j].RouteTableID
+		}
+		return entries[i].DestinationCIDR < entries[j].DestinationCIDR
+	})
+
+	return entries, nil
+}
+
+// expectedNextHop returns the next hop routes of the Node's PodCIDRs of the family would be programmed with now
+func (yc *Cloud) expectedNextHop(ctx context.Context, kubeNode *v1.Node, family v1.IPFamily) (string, error) {
+	if err := checkNextHopGateway(kubeNode); err != nil {
+		return "", err
+	}
+	if nextHopInstanceID := kubeNode.Annotations[nextHopInstanceIDAnnotation]; len(nextHopInstanceID) != 0 {
+		nextHopNode, err := yc.withNextHopInstanceAddresses(ctx, kubeNode, nextHopInstanceID)
+		if err != nil {
+			return "", err
+		}
+
+		return getNodeNextHop(nextHopNode, family, nil, v1.NodeInternalIP, nil)
+	}
+
+	primaryAddresses, err := yc.getPrimaryAddresses(ctx, kubeNode)
+	if err != nil {
+		return "", fmt.Errorf("failed to get primary addresses: %s", err)
+	}
+
+	return getNodeNextHop(kubeNode, family, primaryAddresses, yc.config.NextHopAddressType, yc.config.NextHopSubnetCIDRs)
+}
+
+// serveRouteDump prints managed routes as a table, or as JSON with the "format=json" query parameter
+func (yc *Cloud) serveRouteDump(w http.ResponseWriter, r *http.Request) {
+	// the Node informer is only started by the leader, standby replicas have nothing to compare routes with
+	if yc.nodesSynced != nil {
+		select {
+		case <-yc.nodesSynced:
+		default:
+			http.Error(w, "Node informer cache hasn't synced yet, the replica may not be the leader", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	entries, err := yc.dumpRoutes(r.Context())
+	if err != nil {
+		klog.ErrorS(err, "Failed to dump routes")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			klog.ErrorS(err, "Failed to write routes dump")
+		}
+		return
+	}
+
+	writeRouteDumpTable(w, entries)
+}
+
+func writeRouteDumpTable(w http.ResponseWriter, entries []routeDumpEntry) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROUTE TABLE\tNODE\tINDEX\tDESTINATION\tNEXT HOP\tNODE EXISTS\tMANAGED\tPROBLEM")
+	for _, entry := range entries {
+		problem := entry.Problem
+		if len(problem) == 0 {
+			problem = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%t\t%t\t%s\n",
+			entry.RouteTableID, entry.NodeName, entry.PodCIDRIndex, entry.DestinationCIDR, entry.NextHop, entry.NodeExists, !entry.Unmanaged, problem)
+	}
+	_ = tw.Flush()
+}
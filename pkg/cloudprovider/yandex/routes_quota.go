@@ -0,0 +1,49 @@
+package yandex
+
+import (
+	"math"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	routeTableQuotaReason = "RouteTableQuotaApproaching"
+	// defaultRouteQuotaWarningRatio is the share of RouteTableMaxRoutes StaticRoutes are warned about at
+	defaultRouteQuotaWarningRatio = 0.9
+)
+
+// routeTableQuotaEventRef is what RouteTable quota events are reported on, RouteTables have no Kubernetes object
+var routeTableQuotaEventRef = &v1.ObjectReference{
+	Kind:      "Namespace",
+	Name:      metav1.NamespaceSystem,
+	Namespace: metav1.NamespaceSystem,
+}
+
+// observeRouteTableSize exports the number of StaticRoutes in the RouteTable, including unmanaged ones as they count
+// towards the quota too, and warns once the number crosses RouteQuotaWarningRatio of RouteTableMaxRoutes.
+// It is called with the RouteTable lock held.
+func (yc *Cloud) observeRouteTableSize(rt *managedRouteTable, routes int) {
+	observeRouteTableRoutes(rt.id, routes)
+
+	if yc.config.RouteTableMaxRoutes <= 0 {
+		return
+	}
+	threshold := int(math.Ceil(float64(yc.config.RouteTableMaxRoutes) * yc.config.RouteQuotaWarningRatio))
+	if routes < threshold {
+		rt.quotaWarned = false
+		return
+	}
+	if rt.quotaWarned {
+		return
+	}
+	rt.quotaWarned = true
+
+	klog.Warningf("RouteTable %q has %d StaticRoutes of %d allowed, routes of new Nodes will fail to be created once the quota is exhausted", rt.id, routes, yc.config.RouteTableMaxRoutes)
+	if yc.eventRecorder == nil {
+		return
+	}
+	yc.eventRecorder.Eventf(routeTableQuotaEventRef, v1.EventTypeWarning, routeTableQuotaReason,
+		"RouteTable %q has %d StaticRoutes of %d allowed, increase the quota or reduce the number of Nodes", rt.id, routes, yc.config.RouteTableMaxRoutes)
+}
@@ -0,0 +1,30 @@
+package yandex
+
+import (
+	"testing"
+
+	"k8s.io/client-go/tools/record"
+)
+
+func TestObserveRouteTableSize(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	yc := &Cloud{
+		eventRecorder: recorder,
+		config:        CloudConfig{RouteTableMaxRoutes: 10, RouteQuotaWarningRatio: 0.9},
+	}
+	rt := &managedRouteTable{id: "rt1"}
+
+	for _, routes := range []int{5, 9, 10, 8, 9} {
+		yc.observeRouteTableSize(rt, routes)
+	}
+	// the threshold is crossed twice, staying above it doesn't repeat the warning
+	if len(recorder.Events) != 2 {
+		t.Errorf("expected 2 quota events, got %d", len(recorder.Events))
+	}
+
+	disabled := &Cloud{eventRecorder: recorder}
+	disabled.observeRouteTableSize(&managedRouteTable{id: "rt2"}, 1000)
+	if len(recorder.Events) != 2 {
+		t.Errorf("zero RouteTableMaxRoutes should disable quota warnings, got %d events", len(recorder.Events))
+	}
+}
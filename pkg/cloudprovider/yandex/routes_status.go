@@ -0,0 +1,97 @@
+package yandex
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// routeStatusAnnotation is set on Nodes to the routeStatus JSON of the StaticRoutes last programmed for them,
+// so that route state can be seen with kubectl and drift against the RouteTable detected
+const routeStatusAnnotation = "yandex.cpi.flant.com/route-status"
+
+type routeStatus struct {
+	RouteTableID string             `json:"routeTableId"`
+	Routes       []routeStatusEntry `json:"routes"`
+}
+
+type routeStatusEntry struct {
+	DestinationCIDR string `json:"destinationCIDR"`
+	NextHop         string `json:"nextHop"`
+}
+
+// recordNodeRouteStatus annotates Nodes with the AddOrUpdate terms successfully applied to the RouteTable.
+// Terms are expected to cover all managed PodCIDRs of their Nodes. Failures are only logged, the routes are in place.
+func (yc *Cloud) recordNodeRouteStatus(ctx context.Context, routeTableID string, terms []routeFilterTerm) {
+	if yc.kubeClient == nil {
+		return
+	}
+
+	statuses := make(map[string]*routeStatus)
+	for _, term := range terms {
+		if term.termType != routeFilterAddOrUpdate {
+			continue
+		}
+		status, ok := statuses[term.nodeName]
+		if !ok {
+			status = &routeStatus{RouteTableID: routeTableID}
+			statuses[term.nodeName] = status
+		}
+		status.Routes = append(status.Routes, routeStatusEntry{DestinationCIDR: term.destinationCIDR, NextHop: term.nextHop})
+	}
+
+	for nodeName, status := range statuses {
+		sort.Slice(status.Routes, func(i, j int) bool { return status.Routes[i].DestinationCIDR < status.Routes[j].DestinationCIDR })
+		value, err := json.Marshal(status)
+		if err != nil {
+			klog.ErrorS(err, "Failed to marshal route status of Node", "nodeName", nodeName)
+			continue
+		}
+		yc.patchNodeRouteStatus(ctx, nodeName, string(value))
+	}
+}
+
+// clearNodeRouteStatus removes the routeStatusAnnotation from the Node once its routes are deleted
+func (yc *Cloud) clearNodeRouteStatus(ctx context.Context, nodeName types.NodeName) {
+	if yc.kubeClient == nil {
+		return
+	}
+
+	yc.patchNodeRouteStatus(ctx, string(nodeName), "")
+}
+
+// patchNodeRouteStatus sets the routeStatusAnnotation of the Node to value, or removes it if value is empty.
+// The Node isn't patched if the annotation seen by the lister is up to date already.
+func (yc *Cloud) patchNodeRouteStatus(ctx context.Context, nodeName, value string) {
+	node, err := yc.nodeLister.Get(nodeName)
+	if apierrors.IsNotFound(err) {
+		return
+	}
+	if err == nil && node.Annotations[routeStatusAnnotation] == value {
+		return
+	}
+
+	var annotationValue interface{}
+	if len(value) > 0 {
+		annotationValue = value
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{routeStatusAnnotation: annotationValue},
+		},
+	})
+	if err != nil {
+		klog.ErrorS(err, "Failed to marshal route status patch of Node", "nodeName", nodeName)
+		return
+	}
+
+	_, err = yc.kubeClient.CoreV1().Nodes().Patch(ctx, nodeName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		klog.ErrorS(err, "Failed to update route status annotation of Node", "nodeName", nodeName)
+	}
+}
@@ -0,0 +1,60 @@
+package yandex
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+func TestNodeRouteStatus(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Spec:       v1.NodeSpec{PodCIDRs: []string{"10.100.0.0/24", "fd00:100::/64"}},
+		Status: v1.NodeStatus{Addresses: []v1.NodeAddress{
+			{Type: v1.NodeInternalIP, Address: "192.168.0.10"},
+			{Type: v1.NodeInternalIP, Address: "fd00::10"},
+		}},
+	}
+	rtClient := newFakeRouteTableClient(&vpc.RouteTable{Id: "rt1"})
+	yc := newFakeRouteCloud("rt1", rtClient, &fakeComputeClient{}, node)
+	kubeClient := fake.NewSimpleClientset(node)
+	yc.kubeClient = kubeClient
+	ctx := context.Background()
+
+	route := &cloudprovider.Route{TargetNode: "node-a", DestinationCIDR: "10.100.0.0/24"}
+	if err := yc.CreateRoute(ctx, "", "", route); err != nil {
+		t.Fatal(err)
+	}
+
+	annotated, err := kubeClient.CoreV1().Nodes().Get(ctx, "node-a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"routeTableId":"rt1","routes":[{"destinationCIDR":"10.100.0.0/24","nextHop":"192.168.0.10"},{"destinationCIDR":"fd00:100::/64","nextHop":"fd00::10"}]}`
+	if status := annotated.Annotations[routeStatusAnnotation]; status != expected {
+		t.Errorf("expected route status %s, got %s", expected, status)
+	}
+
+	// the informer cache catches up with the annotated Node
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	_ = indexer.Add(annotated)
+	yc.nodeLister = corev1listers.NewNodeLister(indexer)
+
+	if err := yc.DeleteRoute(ctx, "", route); err != nil {
+		t.Fatal(err)
+	}
+	cleared, err := kubeClient.CoreV1().Nodes().Get(ctx, "node-a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, ok := cleared.Annotations[routeStatusAnnotation]; ok {
+		t.Errorf("route status should be removed along with the routes, got %s", status)
+	}
+}
@@ -0,0 +1,1264 @@
+package yandex
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	//nolint:staticcheck // Ignore SA1019. Need to keep deprecated package for compatibility.
+	"github.com/golang/protobuf/proto"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/compute/v1"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	cloudprovider "k8s.io/cloud-provider"
+	netutils "k8s.io/utils/net"
+
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/yapi"
+)
+
+func TestFilterStaticRoutes(t *testing.T) {
+	routeLabels := newRouteLabels("", "", false)
+	staticRoutes := []*vpc.StaticRoute{
+		{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.0.0/24"},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.1"},
+			Labels:      map[string]string{routeLabels.nodeRole: "node-a"},
+		},
+		{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.1.0/24"},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.2"},
+			Labels:      map[string]string{routeLabels.nodeRole: "node-b"},
+		},
+		{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "0.0.0.0/0"},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.254"},
+		},
+	}
+
+	ret := filterStaticRoutes(routeLabels, staticRoutes,
+		routeFilterTerm{termType: routeFilterAddOrUpdate, nodeName: "node-a", destinationCIDR: "10.0.0.0/24", nextHop: "192.168.0.10"},
+		routeFilterTerm{termType: routeFilterRemove, nodeName: "node-b"},
+		routeFilterTerm{termType: routeFilterAddOrUpdate, nodeName: "node-c", destinationCIDR: "10.0.2.0/24", nextHop: "192.168.0.3"},
+	)
+
+	nextHops := make(map[string]string)
+	for _, route := range ret {
+		nextHops[route.Labels[routeLabels.nodeRole]] = route.GetNextHopAddress()
+	}
+
+	if len(ret) != 3 {
+		t.Fatalf("expected 3 StaticRoutes, got %d", len(ret))
+	}
+	if nextHops["node-a"] != "192.168.0.10" {
+		t.Error("route for node-a should be updated")
+	}
+	if _, ok := nextHops["node-b"]; ok {
+		t.Error("route for node-b should be removed")
+	}
+	if nextHops["node-c"] != "192.168.0.3" {
+		t.Error("route for node-c should be added")
+	}
+	if nextHops[""] != "192.168.0.254" {
+		t.Error("unmanaged route should be preserved")
+	}
+}
+
+func TestFilterStaticRoutesMultiplePodCIDRs(t *testing.T) {
+	routeLabels := newRouteLabels("", "", false)
+	staticRoutes := []*vpc.StaticRoute{
+		{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.0.0/24"},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.1"},
+			Labels:      map[string]string{routeLabels.nodeRole: "node-a"},
+		},
+		{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "fd00:10::/64"},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "fd00::1"},
+			Labels:      routeLabels.forRoute("node-a", 1),
+		},
+	}
+
+	ret := filterStaticRoutes(routeLabels, staticRoutes,
+		routeFilterTerm{termType: routeFilterAddOrUpdate, nodeName: "node-a", podCIDRIndex: 1, destinationCIDR: "fd00:10::/64", nextHop: "fd00::10"},
+	)
+	if len(ret) != 2 {
+		t.Fatalf("expected 2 StaticRoutes, got %d", len(ret))
+	}
+	if ret[0].GetNextHopAddress() != "192.168.0.1" {
+		t.Error("route for the first PodCIDR should be preserved when updating the second one")
+	}
+	if ret[1].GetNextHopAddress() != "fd00::10" {
+		t.Error("route for the second PodCIDR should be updated")
+	}
+
+	ret = filterStaticRoutes(routeLabels, staticRoutes, routeFilterTerm{termType: routeFilterRemove, nodeName: "node-a"})
+	if len(ret) != 0 {
+		t.Errorf("all routes of the Node should be removed, got %d", len(ret))
+	}
+}
+
+func TestFilterStaticRoutesDuplicateTerms(t *testing.T) {
+	routeLabels := newRouteLabels("", "", false)
+	existingRoute := &vpc.StaticRoute{
+		Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.0.0/24"},
+		NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.1"},
+		Labels:      routeLabels.forRoute("node-a", 0),
+	}
+	addTerm := func(destinationCIDR, nextHop string) routeFilterTerm {
+		return routeFilterTerm{termType: routeFilterAddOrUpdate, nodeName: "node-a", destinationCIDR: destinationCIDR, nextHop: nextHop}
+	}
+	nextHops := func(staticRoutes []*vpc.StaticRoute) map[string]string {
+		ret := make(map[string]string)
+		for _, staticRoute := range staticRoutes {
+			ret[staticRoute.GetDestinationPrefix()] = staticRoute.GetNextHopAddress()
+		}
+		return ret
+	}
+
+	for _, tc := range []struct {
+		name     string
+		existing []*vpc.StaticRoute
+		terms    []routeFilterTerm
+		expected map[string]string
+	}{
+		{
+			name:     "identical terms are applied once",
+			terms:    []routeFilterTerm{addTerm("10.0.0.0/24", "192.168.0.10"), addTerm("10.0.0.0/24", "192.168.0.10")},
+			expected: map[string]string{"10.0.0.0/24": "192.168.0.10"},
+		},
+		{
+			name:     "the last of conflicting terms wins",
+			existing: []*vpc.StaticRoute{existingRoute},
+			terms:    []routeFilterTerm{addTerm("10.0.0.0/24", "192.168.0.10"), addTerm("10.0.0.0/24", "192.168.0.11")},
+			expected: map[string]string{"10.0.0.0/24": "192.168.0.11"},
+		},
+		{
+			name:     "distinct destinations of the same PodCIDR index are all programmed",
+			existing: []*vpc.StaticRoute{existingRoute},
+			terms:    []routeFilterTerm{addTerm("10.0.0.0/24", "192.168.0.10"), addTerm("10.0.1.0/24", "192.168.0.10")},
+			expected: map[string]string{"10.0.0.0/24": "192.168.0.10", "10.0.1.0/24": "192.168.0.10"},
+		},
+		{
+			name:     "a route with a changed destination is replaced in place",
+			existing: []*vpc.StaticRoute{existingRoute},
+			terms:    []routeFilterTerm{addTerm("10.0.5.0/24", "192.168.0.1")},
+			expected: map[string]string{"10.0.5.0/24": "192.168.0.1"},
+		},
+		{
+			name:     "duplicate existing routes are removed",
+			existing: []*vpc.StaticRoute{existingRoute, proto.Clone(existingRoute).(*vpc.StaticRoute)},
+			terms:    []routeFilterTerm{addTerm("10.0.0.0/24", "192.168.0.10")},
+			expected: map[string]string{"10.0.0.0/24": "192.168.0.10"},
+		},
+		{
+			name:     "a Remove term supersedes preceding AddOrUpdate terms",
+			existing: []*vpc.StaticRoute{existingRoute},
+			terms:    []routeFilterTerm{addTerm("10.0.1.0/24", "192.168.0.10"), {termType: routeFilterRemove, nodeName: "node-a"}},
+			expected: map[string]string{},
+		},
+	} {
+		ret := filterStaticRoutes(routeLabels, tc.existing, tc.terms...)
+		if len(ret) != len(tc.expected) || !reflect.DeepEqual(nextHops(ret), tc.expected) {
+			t.Errorf("%s: expected StaticRoutes %v, got %v", tc.name, tc.expected, ret)
+		}
+
+		// a RouteTable the terms were applied to must satisfy them, or every reconciliation would update it
+		var addTerms []routeFilterTerm
+		for _, term := range tc.terms {
+			if term.termType == routeFilterAddOrUpdate {
+				addTerms = append(addTerms, term)
+			}
+		}
+		if len(addTerms) == len(tc.terms) && !newStaticRouteIndex(routeLabels, ret).satisfies(routeLabels, mergeRouteFilterTerms(addTerms)) {
+			t.Errorf("%s: filtered StaticRoutes %v should satisfy the terms", tc.name, ret)
+		}
+	}
+}
+
+func TestFilterStaticRoutesForeignPrefix(t *testing.T) {
+	foreignRoute := &vpc.StaticRoute{
+		Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.0.0/24"},
+		NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.1"},
+		Labels:      newRouteLabels("", "", false).forRoute("node-a", 0),
+	}
+
+	ret := filterStaticRoutes(newRouteLabels("other.example.com/", "", false), []*vpc.StaticRoute{foreignRoute},
+		routeFilterTerm{termType: routeFilterRemove, nodeName: "node-a"},
+	)
+	if len(ret) != 1 || ret[0] != foreignRoute {
+		t.Error("routes with a different label prefix should be preserved")
+	}
+}
+
+func TestFilterStaticRoutesForeignCluster(t *testing.T) {
+	foreignRoute := &vpc.StaticRoute{
+		Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.0.0/24"},
+		NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.1"},
+		Labels:      newRouteLabels("", "cluster-b", false).forRoute("node-a", 0),
+	}
+	legacyRoute := &vpc.StaticRoute{
+		Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.1.0/24"},
+		NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.2"},
+		Labels:      newRouteLabels("", "", false).forRoute("node-b", 0),
+	}
+	terms := []routeFilterTerm{
+		{termType: routeFilterRemove, nodeName: "node-a"},
+		{termType: routeFilterAddOrUpdate, nodeName: "node-b", destinationCIDR: "10.0.1.0/24", nextHop: "192.168.0.3"},
+	}
+
+	routeLabels := newRouteLabels("", "cluster-a", false)
+	ret := filterStaticRoutes(routeLabels, []*vpc.StaticRoute{foreignRoute, legacyRoute}, terms...)
+	if len(ret) != 2 || ret[0] != foreignRoute {
+		t.Fatal("routes of another cluster should be preserved")
+	}
+	if ret[1].GetNextHopAddress() != "192.168.0.3" || ret[1].Labels[routeLabels.cluster] != "cluster-a" {
+		t.Errorf("unlabeled route should be updated and claimed by the cluster, got %+v", ret[1])
+	}
+
+	ret = filterStaticRoutes(newRouteLabels("", "cluster-a", true), []*vpc.StaticRoute{foreignRoute, legacyRoute}, terms...)
+	if len(ret) != 3 || ret[0] != foreignRoute || ret[1] != legacyRoute {
+		t.Error("unlabeled routes should be preserved in strict mode")
+	}
+}
+
+func TestFilterStaticRoutesSorted(t *testing.T) {
+	routeLabels := newRouteLabels("", "", false)
+	existingRoute := &vpc.StaticRoute{
+		Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.2.0/24"},
+		NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.3"},
+		Labels:      routeLabels.forRoute("node-c", 0),
+	}
+	terms := []routeFilterTerm{
+		{termType: routeFilterAddOrUpdate, nodeName: "node-b", destinationCIDR: "10.0.1.0/24", nextHop: "192.168.0.2"},
+		{termType: routeFilterAddOrUpdate, nodeName: "node-a", destinationCIDR: "10.0.0.0/24", nextHop: "192.168.0.1"},
+	}
+
+	ret := filterStaticRoutes(routeLabels, []*vpc.StaticRoute{existingRoute}, terms...)
+	var prefixes []string
+	for _, staticRoute := range ret {
+		prefixes = append(prefixes, staticRoute.GetDestinationPrefix())
+	}
+	if !reflect.DeepEqual(prefixes, []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24"}) {
+		t.Errorf("routes should be sorted by destination prefix, got %v", prefixes)
+	}
+}
+
+func TestStaticRoutesEqual(t *testing.T) {
+	routeLabels := newRouteLabels("", "", false)
+	routeA := &vpc.StaticRoute{
+		Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.0.0/24"},
+		NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.1"},
+		Labels:      routeLabels.forRoute("node-a", 0),
+	}
+	routeB := &vpc.StaticRoute{
+		Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.1.0/24"},
+		NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.2"},
+		Labels:      routeLabels.forRoute("node-b", 0),
+	}
+
+	if !staticRoutesEqual([]*vpc.StaticRoute{routeA, routeB}, []*vpc.StaticRoute{routeB, routeA}) {
+		t.Error("StaticRoutes should be equal regardless of order")
+	}
+
+	ret := filterStaticRoutes(routeLabels, []*vpc.StaticRoute{routeA, routeB},
+		routeFilterTerm{termType: routeFilterAddOrUpdate, nodeName: "node-b", destinationCIDR: "10.0.1.0/24", nextHop: "192.168.0.3"},
+	)
+	if staticRoutesEqual([]*vpc.StaticRoute{routeA, routeB}, ret) {
+		t.Error("StaticRoutes with a changed next hop should not be equal")
+	}
+}
+
+func TestMergeRouteFilterTerms(t *testing.T) {
+	ret := mergeRouteFilterTerms([]routeFilterTerm{
+		{termType: routeFilterAddOrUpdate, nodeName: "node-a", podCIDRIndex: 0},
+		{termType: routeFilterAddOrUpdate, nodeName: "node-b", podCIDRIndex: 0},
+		{termType: routeFilterRemove, nodeName: "node-a"},
+		{termType: routeFilterAddOrUpdate, nodeName: "node-b", podCIDRIndex: 1},
+		{termType: routeFilterAddOrUpdate, nodeName: "node-b", nextHop: "192.168.0.2"},
+	})
+
+	if len(ret) != 3 {
+		t.Fatalf("expected 3 terms, got %d", len(ret))
+	}
+	if ret[0].nodeName != "node-a" || ret[0].termType != routeFilterRemove {
+		t.Error("remove term for node-a should supersede the add term")
+	}
+	if ret[2].podCIDRIndex != 0 || ret[2].nextHop != "192.168.0.2" {
+		t.Error("the latest term for the first PodCIDR of node-b should win")
+	}
+
+	ret = mergeRouteFilterTerms([]routeFilterTerm{
+		{termType: routeFilterAddOrUpdate, nodeName: "node-a", destinationCIDR: "10.0.0.0/24"},
+		{termType: routeFilterAddOrUpdate, nodeName: "node-a", destinationCIDR: "10.0.1.0/24"},
+	})
+	if len(ret) != 2 {
+		t.Errorf("terms for distinct destinations of a Node should be kept, got %+v", ret)
+	}
+
+	ret = mergeRouteFilterTerms([]routeFilterTerm{
+		{termType: routeFilterRemove, nodeName: "node-a"},
+		{termType: routeFilterAddOrUpdate, nodeName: "node-a", destinationCIDR: "10.0.0.0/24"},
+		{termType: routeFilterRemove, nodeName: "node-a"},
+	})
+	if len(ret) != 1 || ret[0].termType != routeFilterRemove {
+		t.Errorf("the latest remove term should supersede all previous terms of the Node, got %+v", ret)
+	}
+}
+
+func TestRouteBatcherCoalescesTerms(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		batches [][]routeFilterTerm
+	)
+
+	rb := newRouteBatcher(50*time.Millisecond, func(_ context.Context, terms []routeFilterTerm) error {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, terms)
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for _, nodeName := range []string{"node-a", "node-b", "node-c"} {
+		nodeName := nodeName
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := rb.Submit(context.Background(), routeFilterTerm{termType: routeFilterRemove, nodeName: nodeName}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(batches) != 1 {
+		t.Fatalf("expected a single batch, got %d", len(batches))
+	}
+	if len(batches[0]) != 3 {
+		t.Errorf("expected 3 terms in a batch, got %d", len(batches[0]))
+	}
+}
+
+func TestGetNodeInternalIP(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{
+				{Type: v1.NodeExternalIP, Address: "51.250.0.1"},
+				{Type: v1.NodeInternalIP, Address: "10.10.0.5"},
+				{Type: v1.NodeInternalIP, Address: "192.168.0.5"},
+			},
+		},
+	}
+
+	nextHop, err := getNodeInternalIP(node, v1.IPv4Protocol, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nextHop != "10.10.0.5" {
+		t.Errorf("expected the first InternalIP, got %q", nextHop)
+	}
+
+	nextHop, err = getNodeInternalIP(node, v1.IPv4Protocol, map[string]struct{}{"192.168.0.5": {}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nextHop != "192.168.0.5" {
+		t.Errorf("expected the primary network InternalIP, got %q", nextHop)
+	}
+
+	nextHop, err = getNodeInternalIP(node, v1.IPv4Protocol, map[string]struct{}{"172.16.0.5": {}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nextHop != "10.10.0.5" {
+		t.Errorf("expected fallback to the first InternalIP, got %q", nextHop)
+	}
+
+	if _, err := getNodeInternalIP(node, v1.IPv6Protocol, nil, nil); err == nil || errors.Is(err, errNodeInternalIPNotReady) {
+		t.Errorf("should return a permanent err if there are no InternalIPs of the family, got %v", err)
+	}
+
+	nextHop, err = getNodeNextHop(node, v1.IPv4Protocol, map[string]struct{}{"192.168.0.5": {}}, v1.NodeExternalIP, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nextHop != "51.250.0.1" {
+		t.Errorf("expected the ExternalIP, got %q", nextHop)
+	}
+	if _, err := getNodeNextHop(node, v1.IPv6Protocol, nil, v1.NodeExternalIP, nil); err == nil {
+		t.Error("should return non-nil err if there are no addresses of the requested type")
+	}
+
+	allowedCIDRs, _ := netutils.ParseCIDRs([]string{"192.168.0.0/24"})
+	nextHop, err = getNodeInternalIP(node, v1.IPv4Protocol, nil, allowedCIDRs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nextHop != "192.168.0.5" {
+		t.Errorf("expected the InternalIP within the allowed CIDRs, got %q", nextHop)
+	}
+
+	disallowedCIDRs, _ := netutils.ParseCIDRs([]string{"172.16.0.0/12"})
+	if _, err := getNodeInternalIP(node, v1.IPv4Protocol, nil, disallowedCIDRs); err == nil || errors.Is(err, errNodeInternalIPNotReady) {
+		t.Errorf("should return a permanent err if no InternalIPs are within the allowed CIDRs, got %v", err)
+	}
+
+	newNode := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}}
+	if _, err := getNodeInternalIP(newNode, v1.IPv4Protocol, nil, nil); !errors.Is(err, errNodeInternalIPNotReady) {
+		t.Errorf("should return errNodeInternalIPNotReady until kubelet reports InternalIPs, got %v", err)
+	}
+}
+
+func TestGetRouteFilterTermsFamilies(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Spec:       v1.NodeSpec{PodCIDRs: []string{"fd00:10::/64", "10.0.0.0/24"}},
+		Status: v1.NodeStatus{Addresses: []v1.NodeAddress{
+			{Type: v1.NodeInternalIP, Address: "192.168.0.5"},
+			{Type: v1.NodeInternalIP, Address: "fd00::5"},
+		}},
+	}
+	route := &cloudprovider.Route{TargetNode: "node-a", DestinationCIDR: "10.0.0.0/24"}
+
+	terms, err := getRouteFilterTerms(node, route, nil, nil, v1.NodeInternalIP, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(terms) != 2 {
+		t.Errorf("routes of all families should be programmed by default, got %d", len(terms))
+	}
+
+	terms, err = getRouteFilterTerms(node, route, nil, []string{"ipv4"}, v1.NodeInternalIP, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(terms) != 1 || terms[0].destinationCIDR != "10.0.0.0/24" || terms[0].podCIDRIndex != 1 {
+		t.Errorf("only the IPv4 route should be programmed with its original PodCIDR index, got %+v", terms)
+	}
+}
+
+func TestGetNodeRouteFilterTermsInstanceIDLabel(t *testing.T) {
+	yc := &Cloud{instanceCache: newInstanceCache(time.Minute)}
+	yc.instanceCache.Set(&compute.Instance{
+		Id:   "fhm1",
+		Name: "instance-1",
+		NetworkInterfaces: []*compute.NetworkInterface{
+			{PrimaryV4Address: &compute.PrimaryAddress{Address: "192.168.0.10"}},
+		},
+	})
+	route := &cloudprovider.Route{DestinationCIDR: "10.0.0.0/24"}
+
+	labeled := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a", Labels: map[string]string{instanceIDLabel: "fhm1"}}}
+	terms, err := yc.getNodeRouteFilterTerms(context.Background(), labeled, route, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(terms) != 1 || terms[0].nextHop != "192.168.0.10" {
+		t.Errorf("next hop should be taken from the Instance, got %+v", terms)
+	}
+	if len(labeled.Status.Addresses) != 0 {
+		t.Errorf("the Node must not be modified, got %v", labeled.Status.Addresses)
+	}
+
+	unlabeled := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}}
+	if _, err := yc.getNodeRouteFilterTerms(context.Background(), unlabeled, route, nil); !errors.Is(err, errNodeInternalIPNotReady) {
+		t.Errorf("Node without addresses and the label should not be ready, got %v", err)
+	}
+}
+
+func TestFindDeletedNodes(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	_ = indexer.Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "cached"}})
+	yc := &Cloud{
+		nodeLister: corev1listers.NewNodeLister(indexer),
+		// the informer cache hasn't caught up with the "new" Node yet
+		kubeClient: fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "new"}}),
+		config:     CloudConfig{RouteGCConcurrency: 2},
+	}
+
+	deletedNodes, err := yc.findDeletedNodes(context.Background(), []string{"cached", "new", "deleted", "deleted"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deletedNodes) != 1 {
+		t.Fatalf("only one Node should be reported deleted, got %v", deletedNodes)
+	}
+	if _, ok := deletedNodes["deleted"]; !ok {
+		t.Errorf("Node missing from both the cache and the API server should be reported deleted, got %v", deletedNodes)
+	}
+}
+
+func TestSnapshotRouteNodes(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	_ = indexer.Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}})
+	_ = indexer.Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}})
+	yc := &Cloud{nodeLister: corev1listers.NewNodeLister(indexer)}
+
+	nodes, err := yc.snapshotRouteNodes([]*cloudprovider.Route{{TargetNode: "node-a"}, {TargetNode: "node-a"}, {TargetNode: "deleted"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 {
+		t.Errorf("only Nodes targeted by the routes should be kept, got %v", nodes)
+	}
+	if node, err := nodes.get("node-a"); err != nil || node.Name != "node-a" {
+		t.Errorf("targeted Node should be found, got %v, %v", node, err)
+	}
+	if _, err := nodes.get("deleted"); !apierrors.IsNotFound(err) {
+		t.Errorf("missing Node should not be found, got %v", err)
+	}
+}
+
+func TestResyncRoutes(t *testing.T) {
+	routeLabels := newRouteLabels("", "", false)
+	rt := &managedRouteTable{id: "rt1", lock: newContextLock()}
+	rt.cache.set(&vpc.RouteTable{StaticRoutes: []*vpc.StaticRoute{
+		{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.0.0/24"},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.10"},
+			Labels:      routeLabels.forRoute("node-a", 0),
+		},
+	}})
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	_ = indexer.Add(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Spec:       v1.NodeSpec{PodCIDRs: []string{"10.0.0.0/24"}},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.0.10"}}},
+	})
+	_ = indexer.Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-without-podcidr"}})
+	yc := &Cloud{
+		routeTables: map[string]*managedRouteTable{rt.id: rt},
+		nodeLister:  corev1listers.NewNodeLister(indexer),
+		config:      CloudConfig{RouteTableID: rt.id, RouteLabelPrefix: defaultRouteLabelsPrefix},
+	}
+
+	nodeRoutes, err := yc.listNodeRoutes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeRoutes) != 1 || nodeRoutes[0].Name != routeName("node-a", 0) || nodeRoutes[0].DestinationCIDR != "10.0.0.0/24" {
+		t.Errorf("only Nodes with PodCIDRs should have routes, got %+v", nodeRoutes)
+	}
+
+	// the RouteTable is in sync, so it must not be updated, which would fail without the API
+	if err := yc.ResyncRoutes(context.Background()); err != nil {
+		t.Errorf("resync of an up to date RouteTable should succeed, got %v", err)
+	}
+}
+
+func TestCreateAndDeleteRoute(t *testing.T) {
+	unmanagedRoute := &vpc.StaticRoute{
+		Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "0.0.0.0/0"},
+		NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.254"},
+	}
+	rtClient := newFakeRouteTableClient(&vpc.RouteTable{Id: "rt1", StaticRoutes: []*vpc.StaticRoute{unmanagedRoute}})
+	computeClient := &fakeComputeClient{instances: map[string]*compute.Instance{
+		"fhm2": {Id: "fhm2", NetworkInterfaces: []*compute.NetworkInterface{{PrimaryV4Address: &compute.PrimaryAddress{Address: "192.168.0.11"}}}},
+	}}
+	yc := newFakeRouteCloud("rt1", rtClient, computeClient,
+		&v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+			Spec:       v1.NodeSpec{PodCIDRs: []string{"10.100.0.0/24"}},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.0.10"}}},
+		},
+		// kubelet hasn't reported addresses of node-b yet, they are taken from its Instance
+		&v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-b", Labels: map[string]string{instanceIDLabel: "fhm2"}},
+			Spec:       v1.NodeSpec{PodCIDRs: []string{"10.100.1.0/24"}},
+		},
+	)
+	ctx := context.Background()
+
+	for _, route := range []*cloudprovider.Route{
+		{TargetNode: "node-a", DestinationCIDR: "10.100.0.0/24"},
+		{TargetNode: "node-b", DestinationCIDR: "10.100.1.0/24"},
+	} {
+		if err := yc.CreateRoute(ctx, "", "", route); err != nil {
+			t.Fatalf("failed to create route of Node %q: %v", route.TargetNode, err)
+		}
+	}
+
+	nextHops := make(map[string]string)
+	for _, staticRoute := range rtClient.staticRoutes("rt1") {
+		nextHops[staticRoute.GetDestinationPrefix()] = staticRoute.GetNextHopAddress()
+	}
+	expected := map[string]string{"0.0.0.0/0": "192.168.0.254", "10.100.0.0/24": "192.168.0.10", "10.100.1.0/24": "192.168.0.11"}
+	if !reflect.DeepEqual(nextHops, expected) {
+		t.Errorf("expected StaticRoutes %v, got %v", expected, nextHops)
+	}
+
+	updates := rtClient.updates
+	if err := yc.CreateRoute(ctx, "", "", &cloudprovider.Route{TargetNode: "node-a", DestinationCIDR: "10.100.0.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	if rtClient.updates != updates {
+		t.Errorf("re-creating an existing route should not update the RouteTable")
+	}
+
+	if err := yc.DeleteRoute(ctx, "", &cloudprovider.Route{TargetNode: "node-a", DestinationCIDR: "10.100.0.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	routes, err := yc.ListRoutes(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 || routes[0].TargetNode != "node-b" {
+		t.Errorf("only the route of node-b should be left, got %+v", routes)
+	}
+	if staticRoutes := rtClient.staticRoutes("rt1"); len(staticRoutes) != 2 || !proto.Equal(staticRoutes[0], unmanagedRoute) {
+		t.Errorf("unmanaged route should be kept intact, got %v", staticRoutes)
+	}
+}
+
+func TestCreateRouteNextHopInstance(t *testing.T) {
+	rtClient := newFakeRouteTableClient(&vpc.RouteTable{Id: "rt1"})
+	computeClient := &fakeComputeClient{instances: map[string]*compute.Instance{
+		"fhm-appliance": {Id: "fhm-appliance", NetworkInterfaces: []*compute.NetworkInterface{{PrimaryV4Address: &compute.PrimaryAddress{Address: "192.168.0.100"}}}},
+	}}
+	yc := newFakeRouteCloud("rt1", rtClient, computeClient, &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a", Annotations: map[string]string{nextHopInstanceIDAnnotation: "fhm-appliance"}},
+		Spec:       v1.NodeSpec{PodCIDRs: []string{"10.100.0.0/24"}},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.0.10"}}},
+	})
+	route := &cloudprovider.Route{TargetNode: "node-a", DestinationCIDR: "10.100.0.0/24"}
+
+	for i := 0; i < 2; i++ {
+		if err := yc.CreateRoute(context.Background(), "", "", route); err != nil {
+			t.Fatal(err)
+		}
+	}
+	staticRoutes := rtClient.staticRoutes("rt1")
+	if len(staticRoutes) != 1 || staticRoutes[0].GetNextHopAddress() != "192.168.0.100" {
+		t.Errorf("route should point to the next hop Instance, got %v", staticRoutes)
+	}
+	if rtClient.updates != 1 {
+		t.Errorf("route through the next hop Instance should be recognized as up to date, got %d updates", rtClient.updates)
+	}
+
+	entries, err := yc.dumpRoutes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || len(entries[0].Problem) != 0 {
+		t.Errorf("route through the next hop Instance should not be flagged, got %+v", entries)
+	}
+}
+
+func TestCreateRouteNextHopGateway(t *testing.T) {
+	rtClient := newFakeRouteTableClient(&vpc.RouteTable{Id: "rt1"})
+	yc := newFakeRouteCloud("rt1", rtClient, &fakeComputeClient{},
+		&v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-a", Annotations: map[string]string{nextHopGatewayIDAnnotation: "enp-gateway"}},
+			Spec:       v1.NodeSpec{PodCIDRs: []string{"10.100.0.0/24"}},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.0.10"}}},
+		},
+		&v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-b"},
+			Spec:       v1.NodeSpec{PodCIDRs: []string{"10.100.1.0/24"}},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.0.11"}}},
+		},
+	)
+	routes := []*cloudprovider.Route{
+		{TargetNode: "node-a", DestinationCIDR: "10.100.0.0/24"},
+		{TargetNode: "node-b", DestinationCIDR: "10.100.1.0/24"},
+	}
+
+	if err := yc.CreateRoute(context.Background(), "", "", routes[0]); !errors.Is(err, errNextHopGatewayNotSupported) {
+		t.Errorf("route of the Node requesting a gateway next hop should be rejected, got %v", err)
+	}
+
+	if err := yc.BatchReconcileRoutes(context.Background(), routes); err != nil {
+		t.Fatal(err)
+	}
+	staticRoutes := rtClient.staticRoutes("rt1")
+	if len(staticRoutes) != 1 || staticRoutes[0].GetDestinationPrefix() != "10.100.1.0/24" {
+		t.Errorf("only the route of the Node without a gateway next hop should be created, got %v", staticRoutes)
+	}
+}
+
+func TestDumpRoutes(t *testing.T) {
+	routeLabels := newRouteLabels("", "", false)
+	rt := &managedRouteTable{id: "rt1", lock: newContextLock()}
+	rt.cache.set(&vpc.RouteTable{StaticRoutes: []*vpc.StaticRoute{
+		{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.0.0/24"},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.1"},
+			Labels:      routeLabels.forRoute("node-a", 0),
+		},
+		{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.1.0/24"},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.2"},
+			Labels:      routeLabels.forRoute("node-b", 0),
+		},
+		{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "0.0.0.0/0"},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.254"},
+		},
+	}})
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	_ = indexer.Add(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.0.10"}}},
+	})
+	yc := &Cloud{
+		routeTables: map[string]*managedRouteTable{rt.id: rt},
+		nodeLister:  corev1listers.NewNodeLister(indexer),
+		config:      CloudConfig{RouteLabelPrefix: defaultRouteLabelsPrefix},
+	}
+
+	entries, err := yc.dumpRoutes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("only managed routes should be dumped, got %+v", entries)
+	}
+	if !entries[0].NodeExists || entries[0].ExpectedNextHop != "192.168.0.10" || entries[0].Problem != "mismatched next hop" {
+		t.Errorf("route with an outdated next hop should be flagged, got %+v", entries[0])
+	}
+	if entries[1].NodeExists || len(entries[1].Problem) == 0 {
+		t.Errorf("route of a deleted Node should be flagged as orphaned, got %+v", entries[1])
+	}
+}
+
+func TestListRouteTableRoutesSkipsNonPrefixDestinations(t *testing.T) {
+	routeLabels := newRouteLabels("", "", false)
+	rt := &managedRouteTable{id: "rt1", lock: newContextLock()}
+	rt.cache.set(&vpc.RouteTable{StaticRoutes: []*vpc.StaticRoute{
+		{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.0.0/24"},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.1"},
+			Labels:      routeLabels.forRoute("node-a", 0),
+		},
+		{
+			NextHop: &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.2"},
+			Labels:  routeLabels.forRoute("node-b", 0),
+		},
+	}})
+	yc := &Cloud{config: CloudConfig{RouteLabelPrefix: defaultRouteLabelsPrefix}}
+
+	routes, err := yc.listRouteTableRoutes(context.Background(), rt, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 || routes[0].DestinationCIDR != "10.0.0.0/24" {
+		t.Errorf("routes without a destination prefix should be skipped, got %+v", routes)
+	}
+}
+
+func TestListRoutesReportsForeignRoutes(t *testing.T) {
+	routeLabels := newRouteLabels("", "cluster-a", false)
+	foreignLabels := newRouteLabels("", "cluster-b", false)
+	rt := &managedRouteTable{id: "rt1", lock: newContextLock()}
+	rt.cache.set(&vpc.RouteTable{StaticRoutes: []*vpc.StaticRoute{
+		{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.0.0/24"},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.1"},
+			Labels:      routeLabels.withCluster(routeLabels.forRoute("node-a", 0)),
+		},
+		{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.1.0.0/24"},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.1.1"},
+			Labels:      foreignLabels.withCluster(foreignLabels.forRoute("node-x", 0)),
+		},
+	}})
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	_ = indexer.Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}})
+	yc := &Cloud{
+		routeTables: map[string]*managedRouteTable{rt.id: rt},
+		nodeLister:  corev1listers.NewNodeLister(indexer),
+		config:      CloudConfig{ClusterName: "cluster-a", RouteLabelPrefix: defaultRouteLabelsPrefix, RouteReportForeign: true},
+	}
+	ctx := context.Background()
+
+	routes, err := yc.listRouteTableRoutes(ctx, rt, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 || routes[0].unmanaged || !routes[1].unmanaged || routes[1].TargetNode != "node-x" {
+		t.Errorf("route of the other cluster should be reported as unmanaged, got %+v", routes)
+	}
+
+	cpiRoutes, err := yc.ListRoutes(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cpiRoutes) != 1 || cpiRoutes[0].TargetNode != "node-a" {
+		t.Errorf("unmanaged routes should not be passed to the route controller, got %+v", cpiRoutes)
+	}
+
+	entries, err := yc.dumpRoutes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || !entries[1].Unmanaged || len(entries[1].Problem) != 0 {
+		t.Errorf("route of the other cluster should be dumped as unmanaged, got %+v", entries)
+	}
+}
+
+func TestSubnetsContainIP(t *testing.T) {
+	subnets := []*vpc.Subnet{
+		{V4CidrBlocks: []string{"10.0.0.0/24"}},
+		{V4CidrBlocks: []string{"10.0.1.0/24"}, V6CidrBlocks: []string{"fd00::/64"}},
+	}
+
+	for address, expected := range map[string]bool{
+		"10.0.1.15":   true,
+		"fd00::10":    true,
+		"192.168.0.1": false,
+		"fd01::10":    false,
+		"":            false,
+	} {
+		if actual := subnetsContainIP(subnets, address); actual != expected {
+			t.Errorf("subnetsContainIP(%q) = %v, expected %v", address, actual, expected)
+		}
+	}
+}
+
+func TestRouteManagedCIDRs(t *testing.T) {
+	supernets, err := netutils.ParseCIDRs([]string{"10.0.0.0/16", "fd00::/48"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for cidr, expected := range map[string]bool{
+		"10.0.1.0/24": true,
+		"10.0.0.0/16": true,
+		"10.0.0.0/8":  false,
+		"10.1.0.0/24": false,
+		"fd00::/64":   true,
+		"fd01::/64":   false,
+	} {
+		if actual := cidrWithinAny(cidr, supernets); actual != expected {
+			t.Errorf("cidrWithinAny(%q) = %v, expected %v", cidr, actual, expected)
+		}
+	}
+
+	routeLabels := newRouteLabels("", "", false)
+	routeLabels.managedCIDRs = supernets
+	externalRoute := &vpc.StaticRoute{
+		Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "172.16.0.0/24"},
+		NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.1"},
+		Labels:      routeLabels.forRoute("node-a", 0),
+	}
+	managedRoute := &vpc.StaticRoute{
+		Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.1.0/24"},
+		NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.1"},
+		Labels:      routeLabels.forRoute("node-a", 1),
+	}
+
+	ret := filterStaticRoutes(routeLabels, []*vpc.StaticRoute{externalRoute, managedRoute}, routeFilterTerm{termType: routeFilterRemove, nodeName: "node-a"})
+	if len(ret) != 1 || ret[0] != externalRoute {
+		t.Errorf("routes outside of managed CIDRs should be left intact, got %v", ret)
+	}
+}
+
+func TestRoutesDisabled(t *testing.T) {
+	yc := NewCloud(CloudConfig{RoutesEnabled: false, RouteTableID: "rt1"}, nil)
+	if _, ok := yc.Routes(); ok {
+		t.Errorf("routes should not be supported if route management is disabled")
+	}
+	if err := yc.CreateRoute(context.Background(), "", "", &cloudprovider.Route{TargetNode: "node-a", DestinationCIDR: "10.0.0.0/24"}); err != nil {
+		t.Errorf("CreateRoute should be a no-op, got %v", err)
+	}
+	if err := yc.BatchReconcileRoutes(context.Background(), []*cloudprovider.Route{{TargetNode: "node-a"}}); err != nil {
+		t.Errorf("BatchReconcileRoutes should be a no-op, got %v", err)
+	}
+
+	if _, ok := NewCloud(CloudConfig{RoutesEnabled: true, RouteTableID: "rt1"}, nil).Routes(); !ok {
+		t.Errorf("routes should be supported if a RouteTable is configured")
+	}
+}
+
+func TestStaticRouteIndexSatisfies(t *testing.T) {
+	routeLabels := newRouteLabels("", "cluster", false)
+	routeTable := &vpc.RouteTable{StaticRoutes: []*vpc.StaticRoute{
+		{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.0.0/24"},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.1"},
+			Labels:      routeLabels.forRoute("node-a", 0),
+		},
+		{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.0.1.0/24"},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.2"},
+			Labels:      map[string]string{routeLabels.nodeRole: "node-b"},
+		},
+		{
+			Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "0.0.0.0/0"},
+			NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.254"},
+		},
+	}}
+
+	var cache routeTableCache
+	index := cache.index(routeLabels, routeTable)
+	if cache.index(routeLabels, routeTable) != index {
+		t.Errorf("index should be reused for the same RouteTable")
+	}
+	if len(index.routes) != 2 {
+		t.Errorf("only managed routes should be indexed, got %v", index.routes)
+	}
+
+	upToDate := routeFilterTerm{termType: routeFilterAddOrUpdate, nodeName: "node-a", destinationCIDR: "10.0.0.0/24", nextHop: "192.168.0.1"}
+	for _, testCase := range []struct {
+		terms     []routeFilterTerm
+		satisfied bool
+	}{
+		{terms: []routeFilterTerm{upToDate, {termType: routeFilterRemove, nodeName: "deleted"}}, satisfied: true},
+		{terms: []routeFilterTerm{{termType: routeFilterAddOrUpdate, nodeName: "node-a", destinationCIDR: "10.0.0.0/24", nextHop: "192.168.0.3"}}},
+		{terms: []routeFilterTerm{{termType: routeFilterAddOrUpdate, nodeName: "node-a", podCIDRIndex: 1, destinationCIDR: "fd00::/80", nextHop: "fd01::1"}}},
+		// the route lacks the cluster label, so it's claimed with an update
+		{terms: []routeFilterTerm{{termType: routeFilterAddOrUpdate, nodeName: "node-b", destinationCIDR: "10.0.1.0/24", nextHop: "192.168.0.2"}}},
+		{terms: []routeFilterTerm{upToDate, {termType: routeFilterRemove, nodeName: "node-b"}}},
+	} {
+		if satisfied := index.satisfies(routeLabels, testCase.terms); satisfied != testCase.satisfied {
+			t.Errorf("expected terms %+v to be satisfied: %v, got %v", testCase.terms, testCase.satisfied, satisfied)
+		}
+	}
+}
+
+func TestDefaultRoute(t *testing.T) {
+	routeLabels := newRouteLabels("", "cluster", false)
+	goneNodeRoute := &vpc.StaticRoute{
+		Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "10.100.0.0/24"},
+		NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.10"},
+		Labels:      routeLabels.forRoute("gone-node", 0),
+	}
+	rtClient := newFakeRouteTableClient(&vpc.RouteTable{Id: "rt1", StaticRoutes: []*vpc.StaticRoute{goneNodeRoute}})
+	yc := newFakeRouteCloud("rt1", rtClient, &fakeComputeClient{})
+	yc.config.ClusterName = "cluster"
+	yc.config.RouteDefaultDestination = "0.0.0.0/0"
+	yc.config.RouteDefaultNextHop = "192.168.0.254"
+	ctx := context.Background()
+
+	if err := yc.ensureDefaultRoute(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defaultRoute := findStaticRouteTo(rtClient.staticRoutes("rt1"), "0.0.0.0/0")
+	if defaultRoute == nil || defaultRoute.GetNextHopAddress() != "192.168.0.254" || !routeLabels.isDefaultRoute(defaultRoute) {
+		t.Fatalf("labeled default route should be added, got %v", rtClient.staticRoutes("rt1"))
+	}
+
+	updates := rtClient.updates
+	if err := yc.ensureDefaultRoute(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rtClient.updates != updates {
+		t.Errorf("ensuring an existing default route should not update the RouteTable")
+	}
+
+	routes, err := yc.ListRoutes(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range routes {
+		if route.DestinationCIDR == "0.0.0.0/0" {
+			t.Errorf("the default route should not be reported to the route controller, got %+v", route)
+		}
+	}
+
+	if err := yc.GarbageCollectRoutes(ctx); err != nil {
+		t.Fatal(err)
+	}
+	staticRoutes := rtClient.staticRoutes("rt1")
+	if len(staticRoutes) != 1 || !routeLabels.isDefaultRoute(staticRoutes[0]) {
+		t.Errorf("only the default route should survive GC of the gone Node, got %v", staticRoutes)
+	}
+
+	yc.config.RouteDefaultNextHop = "192.168.0.253"
+	if err := yc.ensureDefaultRoute(ctx); err != nil {
+		t.Fatal(err)
+	}
+	staticRoutes = rtClient.staticRoutes("rt1")
+	if len(staticRoutes) != 1 || staticRoutes[0].GetNextHopAddress() != "192.168.0.253" {
+		t.Errorf("the default route should be updated in place, got %v", staticRoutes)
+	}
+}
+
+func TestDefaultRouteConflict(t *testing.T) {
+	routeLabels := newRouteLabels("", "", false)
+	unmanagedRoute := &vpc.StaticRoute{
+		Destination: &vpc.StaticRoute_DestinationPrefix{DestinationPrefix: "0.0.0.0/0"},
+		NextHop:     &vpc.StaticRoute_NextHopAddress{NextHopAddress: "192.168.0.1"},
+	}
+	term := routeFilterTerm{termType: routeFilterDefaultRoute, destinationCIDR: "0.0.0.0/0", nextHop: "192.168.0.254"}
+
+	ret := filterStaticRoutes(routeLabels, []*vpc.StaticRoute{unmanagedRoute}, term)
+	if len(ret) != 1 || ret[0] != unmanagedRoute {
+		t.Errorf("unmanaged route to the default route destination should be left intact, got %v", ret)
+	}
+}
+
+func TestCreateRouteOperationFailure(t *testing.T) {
+	defer func(backoff wait.Backoff) { routeTableUpdateBackoff = backoff }(routeTableUpdateBackoff)
+	routeTableUpdateBackoff.Duration = time.Millisecond
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Spec:       v1.NodeSpec{PodCIDRs: []string{"10.100.0.0/24"}},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.0.10"}}},
+	}
+	route := &cloudprovider.Route{TargetNode: "node-a", DestinationCIDR: "10.100.0.0/24"}
+	ctx := context.Background()
+
+	t.Run("permanent failure is returned", func(t *testing.T) {
+		rtClient := newFakeRouteTableClient(&vpc.RouteTable{Id: "rt1"})
+		rtClient.updateFailures = []*status.Status{status.New(codes.PermissionDenied, "not allowed")}
+		yc := newFakeRouteCloud("rt1", rtClient, &fakeComputeClient{}, node)
+
+		err := yc.CreateRoute(ctx, "", "", route)
+		var opErr *yapi.OperationError
+		if !errors.As(err, &opErr) || opErr.Status.Code() != codes.PermissionDenied {
+			t.Errorf("expected the failed operation to be returned, got %v", err)
+		}
+		if staticRoutes := rtClient.staticRoutes("rt1"); len(staticRoutes) != 0 {
+			t.Errorf("routes of the failed operation should not be applied, got %v", staticRoutes)
+		}
+	})
+
+	t.Run("DeleteRoute failure is returned", func(t *testing.T) {
+		rtClient := newFakeRouteTableClient(&vpc.RouteTable{Id: "rt1"})
+		yc := newFakeRouteCloud("rt1", rtClient, &fakeComputeClient{}, node)
+		if err := yc.CreateRoute(ctx, "", "", route); err != nil {
+			t.Fatal(err)
+		}
+
+		rtClient.updateFailures = []*status.Status{status.New(codes.PermissionDenied, "not allowed")}
+		err := yc.DeleteRoute(ctx, "", route)
+		var opErr *yapi.OperationError
+		if !errors.As(err, &opErr) || opErr.Status.Code() != codes.PermissionDenied {
+			t.Errorf("expected the failed operation to be returned, got %v", err)
+		}
+		if staticRoutes := rtClient.staticRoutes("rt1"); len(staticRoutes) != 1 {
+			t.Errorf("the route should be kept if the operation fails, got %v", staticRoutes)
+		}
+	})
+
+	t.Run("transient failure is retried", func(t *testing.T) {
+		rtClient := newFakeRouteTableClient(&vpc.RouteTable{Id: "rt1"})
+		rtClient.updateFailures = []*status.Status{status.New(codes.Internal, "internal error")}
+		yc := newFakeRouteCloud("rt1", rtClient, &fakeComputeClient{}, node)
+
+		if err := yc.CreateRoute(ctx, "", "", route); err != nil {
+			t.Fatalf("the failed operation should be retried, got %v", err)
+		}
+		if staticRoutes := rtClient.staticRoutes("rt1"); len(staticRoutes) != 1 {
+			t.Errorf("the route should be applied on retry, got %v", staticRoutes)
+		}
+	})
+
+	t.Run("retries are bounded", func(t *testing.T) {
+		rtClient := newFakeRouteTableClient(&vpc.RouteTable{Id: "rt1"})
+		for i := 0; i < routeTableUpdateBackoff.Steps; i++ {
+			rtClient.updateFailures = append(rtClient.updateFailures, status.New(codes.Unavailable, "unavailable"))
+		}
+		yc := newFakeRouteCloud("rt1", rtClient, &fakeComputeClient{}, node)
+
+		err := yc.CreateRoute(ctx, "", "", route)
+		var opErr *yapi.OperationError
+		if !errors.As(err, &opErr) || opErr.Status.Code() != codes.Unavailable {
+			t.Errorf("expected the last failed operation to be returned, got %v", err)
+		}
+	})
+}
+
+func TestCreateRouteWaitsForNodeLister(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Spec:       v1.NodeSpec{PodCIDRs: []string{"10.100.0.0/24"}},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.0.10"}}},
+	}
+	route := &cloudprovider.Route{TargetNode: "node-a", DestinationCIDR: "10.100.0.0/24"}
+	rtClient := newFakeRouteTableClient(&vpc.RouteTable{Id: "rt1"})
+	yc := newFakeRouteCloud("rt1", rtClient, &fakeComputeClient{}, node)
+	yc.nodesSynced = make(chan struct{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := yc.CreateRoute(ctx, "", "", route); !errors.Is(err, yapi.ErrTransient) {
+		t.Errorf("expected a transient error before the Node informer cache syncs, got %v", err)
+	}
+	if staticRoutes := rtClient.staticRoutes("rt1"); len(staticRoutes) != 0 {
+		t.Errorf("no routes should be added before the Node informer cache syncs, got %v", staticRoutes)
+	}
+
+	close(yc.nodesSynced)
+	if err := yc.CreateRoute(context.Background(), "", "", route); err != nil {
+		t.Fatal(err)
+	}
+	if staticRoutes := rtClient.staticRoutes("rt1"); len(staticRoutes) != 1 {
+		t.Errorf("expected the route to be added once the Node informer cache syncs, got %v", staticRoutes)
+	}
+}
+
+func TestGetRouteTableForNode(t *testing.T) {
+	nodeInZone := func(zone string) *v1.Node {
+		node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-" + zone}}
+		if len(zone) > 0 {
+			node.Labels = map[string]string{v1.LabelTopologyZone: zone}
+		}
+		return node
+	}
+
+	tests := []struct {
+		name         string
+		routeTableID string
+		zone         string
+		expected     string
+	}{
+		{"zonal RouteTable", "rt-default", "ru-central1-a", "rt-a"},
+		{"zone without RouteTable falls back to the default one", "rt-default", "ru-central1-b", "rt-default"},
+		{"Node without zone falls back to the default one", "rt-default", "", "rt-default"},
+		{"zonal RouteTable without default one", "", "ru-central1-a", "rt-a"},
+		{"zone without RouteTable and without default one", "", "ru-central1-b", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			yc := &Cloud{config: CloudConfig{RouteTableID: tc.routeTableID, RouteTablesByZone: map[string]string{"ru-central1-a": "rt-a"}}}
+			yc.routeTables = yc.newManagedRouteTables()
+
+			rt, err := yc.getRouteTableForNode(nodeInZone(tc.zone))
+			if len(tc.expected) == 0 {
+				if err == nil {
+					t.Errorf("expected an error, got RouteTable %q", rt.id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rt.id != tc.expected {
+				t.Errorf("expected RouteTable %q, got %q", tc.expected, rt.id)
+			}
+		})
+	}
+}
+
+func TestZonalRouteTables(t *testing.T) {
+	rtClient := newFakeRouteTableClient(&vpc.RouteTable{Id: "rt-default"}, &vpc.RouteTable{Id: "rt-a"}, &vpc.RouteTable{Id: "rt-b"})
+	nodeA := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a", Labels: map[string]string{v1.LabelTopologyZone: "ru-central1-a"}},
+		Spec:       v1.NodeSpec{PodCIDRs: []string{"10.100.0.0/24"}},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.0.10"}}},
+	}
+	nodeB := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-b", Labels: map[string]string{v1.LabelTopologyZone: "ru-central1-b"}},
+		Spec:       v1.NodeSpec{PodCIDRs: []string{"10.100.1.0/24"}},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.1.10"}}},
+	}
+	yc := newFakeRouteCloud("rt-default", rtClient, nil, nodeA, nodeB)
+	ctx := context.Background()
+
+	setRouteTablesByZone := func(routeTablesByZone map[string]string) {
+		yc.config.RouteTablesByZone = routeTablesByZone
+		yc.routeTables = yc.newManagedRouteTables()
+		for _, rt := range yc.routeTables {
+			rt.batcher.delay = 0
+		}
+	}
+	destinations := func(routeTableID string) []string {
+		var ret []string
+		for _, staticRoute := range rtClient.staticRoutes(routeTableID) {
+			ret = append(ret, staticRoute.GetDestinationPrefix())
+		}
+		return ret
+	}
+
+	// node-a's route is left in the default RouteTable from before its zone got a RouteTable of its own
+	if err := yc.CreateRoute(ctx, "", "", &cloudprovider.Route{TargetNode: "node-a", DestinationCIDR: "10.100.0.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	setRouteTablesByZone(map[string]string{"ru-central1-a": "rt-a", "ru-central1-b": "rt-b"})
+
+	for _, route := range []*cloudprovider.Route{
+		{TargetNode: "node-a", DestinationCIDR: "10.100.0.0/24"},
+		{TargetNode: "node-b", DestinationCIDR: "10.100.1.0/24"},
+	} {
+		if err := yc.CreateRoute(ctx, "", "", route); err != nil {
+			t.Fatalf("failed to create route of Node %q: %v", route.TargetNode, err)
+		}
+	}
+	if actual := destinations("rt-a"); !reflect.DeepEqual(actual, []string{"10.100.0.0/24"}) {
+		t.Errorf("only node-a's route should be in its zonal RouteTable, got %v", actual)
+	}
+	if actual := destinations("rt-b"); !reflect.DeepEqual(actual, []string{"10.100.1.0/24"}) {
+		t.Errorf("only node-b's route should be in its zonal RouteTable, got %v", actual)
+	}
+
+	if err := yc.DeleteRoute(ctx, "", &cloudprovider.Route{TargetNode: "node-a", DestinationCIDR: "10.100.0.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	if actual := destinations("rt-a"); len(actual) != 0 {
+		t.Errorf("node-a's route should be removed from its zonal RouteTable, got %v", actual)
+	}
+	if actual := destinations("rt-default"); len(actual) != 0 {
+		t.Errorf("node-a's route should be removed from the default RouteTable too, got %v", actual)
+	}
+	if actual := destinations("rt-b"); !reflect.DeepEqual(actual, []string{"10.100.1.0/24"}) {
+		t.Errorf("node-b's route should be kept, got %v", actual)
+	}
+}
+
+func TestNewCloudConfigRouteTablesByZone(t *testing.T) {
+	t.Setenv(envAuthMode, authModeMetadata)
+	t.Setenv(envFolderID, "folder")
+	t.Setenv(envClusterName, "cluster")
+	t.Setenv(envLbTgNetworkID, "network")
+
+	tests := []struct {
+		value       string
+		expected    map[string]string
+		expectError bool
+	}{
+		{"", map[string]string{}, false},
+		{"ru-central1-a=rt-a", map[string]string{"ru-central1-a": "rt-a"}, false},
+		{"ru-central1-a=rt-a,ru-central1-b=rt-b", map[string]string{"ru-central1-a": "rt-a", "ru-central1-b": "rt-b"}, false},
+		{"rt-a", nil, true},
+		{"=rt-a", nil, true},
+		{"ru-central1-a=", nil, true},
+		{"ru-central1-a=rt-a,", nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			t.Setenv(envRouteTablesByZone, tc.value)
+
+			config, err := NewCloudConfig()
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got %v", config.RouteTablesByZone)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(config.RouteTablesByZone, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, config.RouteTablesByZone)
+			}
+		})
+	}
+}
+
+func TestRouteTablesValidationTimeout(t *testing.T) {
+	opts := yapi.APIOptions{MaxRetries: 2, RetryBaseDelay: 100 * time.Millisecond}
+	// every RouteTable is given 3 attempts and the jittered delays before the 2 retries
+	expected := 2 * (3*routeTableValidationCallTimeout + 200*time.Millisecond + 400*time.Millisecond)
+	if actual := routeTablesValidationTimeout(2, opts); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
@@ -0,0 +1,143 @@
+package yandex
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/yapi"
+)
+
+const (
+	// defaultShutdownGracePeriod leaves some of the default 30s Pod termination grace period for unwinding
+	defaultShutdownGracePeriod = 20 * time.Second
+	// shutdownUnwindTimeout is how long operations cancelled after the grace period get to release their locks
+	shutdownUnwindTimeout = 5 * time.Second
+)
+
+// errShuttingDown is transient, so that work rejected during shutdown is retried by the next leader
+var errShuttingDown = yapi.NewError(yapi.ErrTransient, errors.New("CCM is shutting down"))
+
+// operationDrainer tracks in-flight route and NLB operations, so that the CCM lets them complete before exiting
+// instead of leaving RouteTables and NLBs half-updated. A nil operationDrainer tracks nothing.
+type operationDrainer struct {
+	mu       sync.Mutex
+	draining bool
+	inFlight sync.WaitGroup
+
+	// ctx is cancelled once the grace period expires, which aborts OperationWaiter polls of tracked operations
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newOperationDrainer() *operationDrainer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &operationDrainer{ctx: ctx, cancel: cancel}
+}
+
+// begin registers an operation. It returns a context that is also cancelled on forced shutdown and the func to call
+// once the operation is done. Operations are rejected with errShuttingDown once draining has started.
+func (d *operationDrainer) begin(ctx context.Context) (context.Context, func(), error) {
+	if d == nil {
+		return ctx, func() {}, nil
+	}
+
+	d.mu.Lock()
+	if d.draining {
+		d.mu.Unlock()
+		return ctx, nil, errShuttingDown
+	}
+	d.inFlight.Add(1)
+	d.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-d.ctx.Done():
+			cancel()
+		case <-done:
+		}
+	}()
+
+	return ctx, func() {
+		close(done)
+		cancel()
+		d.inFlight.Done()
+	}, nil
+}
+
+// drain stops accepting operations and waits up to gracePeriod for in-flight ones. The remaining ones are cancelled
+// then and given shutdownUnwindTimeout to return. It reports whether all operations completed within gracePeriod.
+func (d *operationDrainer) drain(gracePeriod time.Duration) bool {
+	d.mu.Lock()
+	d.draining = true
+	d.mu.Unlock()
+
+	// draining is set under mu before waiting, so that no operation is added to a WaitGroup being waited for
+	completed := make(chan struct{})
+	go func() {
+		d.inFlight.Wait()
+		close(completed)
+	}()
+
+	select {
+	case <-completed:
+		d.cancel()
+		return true
+	case <-time.After(gracePeriod):
+	}
+
+	d.cancel()
+	select {
+	case <-completed:
+	case <-time.After(shutdownUnwindTimeout):
+		klog.ErrorS(nil, "Cancelled operations haven't returned in time", "timeout", shutdownUnwindTimeout)
+	}
+
+	return false
+}
+
+// stopOnShutdown returns a channel closed once stop is closed or Shutdown is called
+func (yc *Cloud) stopOnShutdown(stop <-chan struct{}) <-chan struct{} {
+	merged := make(chan struct{})
+	go func() {
+		defer close(merged)
+		select {
+		case <-stop:
+		case <-yc.stopLoops:
+		}
+	}()
+
+	return merged
+}
+
+// Shutdown stops the periodic loops and accepting route and NLB operations, waits for in-flight ones for
+// ShutdownGracePeriod, cancelling the remaining ones afterwards, and flushes their spans. It's called once the CCM
+// is asked to terminate.
+func (yc *Cloud) Shutdown() {
+	if yc.stopHTTP != nil {
+		defer close(yc.stopHTTP)
+	}
+	if yc.stopLoops != nil {
+		close(yc.stopLoops)
+	}
+
+	klog.InfoS("Draining in-flight cloud operations", "gracePeriod", yc.config.ShutdownGracePeriod)
+	if yc.drainer.drain(yc.config.ShutdownGracePeriod) {
+		klog.InfoS("All in-flight cloud operations have completed")
+	} else {
+		klog.ErrorS(errShuttingDown, "Cancelled in-flight cloud operations after the grace period", "gracePeriod", yc.config.ShutdownGracePeriod)
+	}
+
+	if yc.tracingShutdown != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownUnwindTimeout)
+		defer cancel()
+		if err := yc.tracingShutdown(ctx); err != nil {
+			klog.ErrorS(err, "Failed to flush traces of cloud operations")
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package yandex
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/yapi"
+)
+
+func TestOperationDrainer(t *testing.T) {
+	t.Run("waits for in-flight operations and rejects new ones", func(t *testing.T) {
+		d := newOperationDrainer()
+		_, done, err := d.begin(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		drained := make(chan bool)
+		go func() { drained <- d.drain(time.Minute) }()
+
+		// drain runs concurrently, poll until it starts rejecting new operations
+		for {
+			var lateDone func()
+			_, lateDone, err = d.begin(context.Background())
+			if err != nil {
+				break
+			}
+			lateDone()
+			time.Sleep(time.Millisecond)
+		}
+		if !errors.Is(err, yapi.ErrTransient) {
+			t.Errorf("expected a transient error, got %v", err)
+		}
+
+		done()
+		if !<-drained {
+			t.Error("expected the in-flight operation to complete within the grace period")
+		}
+	})
+
+	t.Run("cancels operations after the grace period", func(t *testing.T) {
+		d := newOperationDrainer()
+		ctx, done, err := d.begin(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			<-ctx.Done()
+			done()
+		}()
+
+		if d.drain(10 * time.Millisecond) {
+			t.Error("expected the in-flight operation not to complete within the grace period")
+		}
+		if ctx.Err() == nil {
+			t.Error("expected the in-flight operation to be cancelled")
+		}
+	})
+}
+
+func TestShutdownStopsLoops(t *testing.T) {
+	yc := NewCloud(CloudConfig{}, nil)
+	// stop of the leader election is never closed on termination
+	loopsStop := yc.stopOnShutdown(make(chan struct{}))
+
+	select {
+	case <-loopsStop:
+		t.Fatal("loops should run until Shutdown")
+	default:
+	}
+
+	yc.Shutdown()
+	select {
+	case <-loopsStop:
+	case <-time.After(time.Second):
+		t.Error("loops should be stopped by Shutdown")
+	}
+}
@@ -10,35 +10,77 @@ import (
 
 var (
 	deprecatedRegExpProviderID = regexp.MustCompile(`^` + providerName + `://([^/]+)/([^/]+)/([^/]+)$`)
-	regExpProviderID           = regexp.MustCompile(`^` + providerName + `://(.+)$`)
+	regExpProviderID           = regexp.MustCompile(`^` + providerName + `://([^/]+)$`)
+	// Instance IDs are 20 lowercase alphanumeric characters starting with a letter, e.g. "fhm0b28lgfp4tkoa3jl6"
+	regExpInstanceID = regexp.MustCompile(`^[a-z][a-z0-9]{19}$`)
+	// zone names are in the following form: ${regionName}-${zoneLetter}, e.g. "ru-central1-a" or "ru-central1-d"
+	regExpZone = regexp.MustCompile(`^([a-z]+-[a-z]+[0-9]+)-[a-z]$`)
 )
 
 // GetRegion returns region of the provided zone.
 func GetRegion(zoneName string) (string, error) {
-	// zoneName is in the following form: ${regionName}-${ix}.
-	// So for input "ru-central1-a" output will be "ru-central1".
-	ix := strings.LastIndex(zoneName, "-")
-	if ix == -1 {
-		return "", fmt.Errorf("unexpected input: %s", zoneName)
+	// For input "ru-central1-a" output will be "ru-central1".
+	matches := regExpZone.FindStringSubmatch(zoneName)
+	if len(matches) != 2 {
+		return "", fmt.Errorf("unexpected zone name: %q", zoneName)
 	}
 
-	return zoneName[:ix], nil
+	return matches[1], nil
 }
 
-func MapNodeNameToInstanceName(nodeName types.NodeName) string {
-	return string(nodeName)
+// nodeNameMapping converts Kubernetes Node names to Compute Instance names for clusters where kubelet's
+// --hostname-override diverges from the Instance name, e.g. a short name vs. the FQDN. The zero value maps names as is.
+type nodeNameMapping struct {
+	stripSuffix  string
+	appendSuffix string
+	// regexp replaces the suffixes if set, Node names it doesn't match are used as is
+	regexp      *regexp.Regexp
+	replacement string
 }
 
+func (m nodeNameMapping) instanceName(nodeName types.NodeName) string {
+	if m.regexp != nil {
+		return m.regexp.ReplaceAllString(string(nodeName), m.replacement)
+	}
+
+	return strings.TrimSuffix(string(nodeName), m.stripSuffix) + m.appendSuffix
+}
+
+// mapNodeNameToInstanceName returns the name of the Instance backing the Node
+func (yc *Cloud) mapNodeNameToInstanceName(nodeName types.NodeName) string {
+	return yc.config.nodeNameMapping.instanceName(nodeName)
+}
+
+// InvalidProviderIDError is returned for ProviderIDs not matching any of the supported formats
+type InvalidProviderIDError struct {
+	ProviderID string
+}
+
+func (e *InvalidProviderIDError) Error() string {
+	return fmt.Sprintf("can't parse providerID %q, expected %s://<instanceID>, <instanceID> or %s://<folderID>/<zone>/<instanceName>", e.ProviderID, providerName, providerName)
+}
+
+// ParseProviderID extracts the Instance ID from the "yandex://<instanceID>" ProviderID or a bare Instance ID.
+// For the deprecated "yandex://<folderID>/<zone>/<instanceName>" format the Instance name is returned instead
+// and instanceNameIsId is false. Malformed ProviderIDs result in an *InvalidProviderIDError.
 func ParseProviderID(providerID string) (instanceName string, instanceNameIsId bool, err error) {
 	deprecatedMatches := deprecatedRegExpProviderID.FindStringSubmatch(providerID)
 	if len(deprecatedMatches) == 4 {
 		return deprecatedMatches[3], false, nil
 	}
 
-	matches := regExpProviderID.FindStringSubmatch(providerID)
-	if len(matches) == 2 {
-		return matches[1], true, nil
+	instanceID := providerID
+	if matches := regExpProviderID.FindStringSubmatch(providerID); len(matches) == 2 {
+		instanceID = matches[1]
 	}
+	if !regExpInstanceID.MatchString(instanceID) {
+		return "", false, &InvalidProviderIDError{ProviderID: providerID}
+	}
+
+	return instanceID, true, nil
+}
 
-	return "", false, fmt.Errorf("can't parse providerID %q", providerID)
+// FormatProviderID returns the ProviderID of the Instance, the inverse of ParseProviderID
+func FormatProviderID(instanceID string) string {
+	return providerName + "://" + instanceID
 }
@@ -1,38 +1,89 @@
 package yandex
 
-import "testing"
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
 
 func TestParseProviderID(t *testing.T) {
-	const (
-		deprecatedProviderID = "yandex://folder/zone/testid"
-		providerID           = "yandex://testid"
-		invalidProviderID    = "mail://test"
-	)
+	const instanceID = "fhm0b28lgfp4tkoa3jl6"
+
+	testCases := []struct {
+		providerID       string
+		instanceName     string
+		instanceNameIsId bool
+	}{
+		{providerID: "yandex://" + instanceID, instanceName: instanceID, instanceNameIsId: true},
+		{providerID: instanceID, instanceName: instanceID, instanceNameIsId: true},
+		{providerID: "yandex://folder/zone/testname", instanceName: "testname", instanceNameIsId: false},
+	}
+
+	for _, tc := range testCases {
+		instanceName, instanceNameIsId, err := ParseProviderID(tc.providerID)
+		if err != nil {
+			t.Errorf("unexpected error for providerID %q: %s", tc.providerID, err)
+			continue
+		}
+		if instanceName != tc.instanceName || instanceNameIsId != tc.instanceNameIsId {
+			t.Errorf("providerID %q parsed as (%q, %t), expected (%q, %t)", tc.providerID, instanceName, instanceNameIsId, tc.instanceName, tc.instanceNameIsId)
+		}
+	}
 
-	name, instanceNameIsId, err := ParseProviderID(deprecatedProviderID)
-	if err != nil {
-		t.Error(err)
+	for _, providerID := range []string{"", "mail://test", "yandex://testid", "yandex://", "testid", "yandex://folder/" + instanceID, "aws://" + instanceID} {
+		_, _, err := ParseProviderID(providerID)
+		var invalidProviderIDErr *InvalidProviderIDError
+		if !errors.As(err, &invalidProviderIDErr) {
+			t.Errorf("should return InvalidProviderIDError on invalid providerID %q, got %v", providerID, err)
+		}
 	}
-	if instanceNameIsId {
-		t.Error("deprecatedProviderID should not return positive instanceNameIsId")
+
+	if providerID := FormatProviderID(instanceID); providerID != "yandex://"+instanceID {
+		t.Errorf("unexpected ProviderID %q", providerID)
 	}
-	if len(name) == 0 {
-		t.Error("name field is empty")
+	if parsed, _, _ := ParseProviderID(FormatProviderID(instanceID)); parsed != instanceID {
+		t.Errorf("FormatProviderID and ParseProviderID are not inverse, got %q", parsed)
 	}
+}
 
-	id, instanceNameIsId, err := ParseProviderID(providerID)
-	if err != nil {
-		t.Error(err)
+func TestGetRegion(t *testing.T) {
+	for _, zone := range []string{"ru-central1-a", "ru-central1-b", "ru-central1-c", "ru-central1-d"} {
+		region, err := GetRegion(zone)
+		if err != nil {
+			t.Error(err)
+		}
+		if region != "ru-central1" {
+			t.Errorf("unexpected region %q for zone %q", region, zone)
+		}
 	}
-	if !instanceNameIsId {
-		t.Error("deprecatedProviderID should return positive instanceNameIsId")
+
+	for _, zone := range []string{"", "ru-central1", "central1-a"} {
+		if _, err := GetRegion(zone); err == nil {
+			t.Errorf("should return non-nil err on invalid zone %q", zone)
+		}
 	}
-	if len(id) == 0 {
-		t.Error("id field is empty")
+}
+
+func TestNodeNameMapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		mapping  nodeNameMapping
+		nodeName types.NodeName
+		expected string
+	}{
+		{"identity by default", nodeNameMapping{}, "node-1.ru-central1.internal", "node-1.ru-central1.internal"},
+		{"strip suffix", nodeNameMapping{stripSuffix: ".ru-central1.internal"}, "node-1.ru-central1.internal", "node-1"},
+		{"strip missing suffix", nodeNameMapping{stripSuffix: ".ru-central1.internal"}, "node-1", "node-1"},
+		{"append suffix", nodeNameMapping{appendSuffix: ".example.com"}, "node-1", "node-1.example.com"},
+		{"regexp", nodeNameMapping{regexp: regexp.MustCompile(`^([^.]+)\..*$`), replacement: "$1"}, "node-1.example.com", "node-1"},
+		{"unmatched regexp", nodeNameMapping{regexp: regexp.MustCompile(`^([^.]+)\..*$`), replacement: "$1"}, "node-1", "node-1"},
 	}
 
-	_, _, err = ParseProviderID(invalidProviderID)
-	if err == nil {
-		t.Error("should return non-nil err on invalid ProviderID")
+	for _, tt := range tests {
+		if name := tt.mapping.instanceName(tt.nodeName); name != tt.expected {
+			t.Errorf("%s: expected Instance name %q for Node %q, got %q", tt.name, tt.expected, tt.nodeName, name)
+		}
 	}
 }
@@ -0,0 +1,27 @@
+package yandex
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/compute/v1"
+)
+
+func TestGetZoneByProviderID(t *testing.T) {
+	yc := &Cloud{instanceCache: newInstanceCache(defaultInstanceCacheTTL)}
+	yc.instanceCache.Set(&compute.Instance{Id: "fhm0b28lgfp4tkoa3jl6", ZoneId: "ru-central1-d"})
+
+	zone, err := yc.GetZoneByProviderID(context.Background(), "yandex://fhm0b28lgfp4tkoa3jl6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone.FailureDomain != "ru-central1-d" || zone.Region != "ru-central1" {
+		t.Errorf("unexpected zone %+v", zone)
+	}
+
+	for _, providerID := range []string{"", "fhm1234567890", "aws://fhm1234567890", "yandex://folder/fhm1234567890"} {
+		if _, err := yc.GetZoneByProviderID(context.Background(), providerID); err == nil {
+			t.Errorf("should return non-nil err on malformed providerID %q", providerID)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Package tracing exports OpenTelemetry spans of cloud operations. Until Setup is called with an endpoint,
+// spans are started on the global no-op TracerProvider and cost next to nothing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/version"
+)
+
+const (
+	instrumentationName = "github.com/deckhouse/yandex-cloud-controller-manager"
+	serviceName         = "yandex-cloud-controller-manager"
+)
+
+// Setup exports spans to the OTLP gRPC endpoint in the host:port form. The returned func flushes pending spans
+// and stops the exporter, it should be called on shutdown.
+func Setup(ctx context.Context, endpoint string, insecure bool) (func(context.Context) error, error) {
+	opts := []otlpgrpc.Option{otlpgrpc.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlpgrpc.WithInsecure())
+	}
+
+	exporter, err := otlp.NewExporter(ctx, otlpgrpc.NewDriver(opts...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter for %q: %s", endpoint, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.ServiceNameKey.String(serviceName),
+			semconv.ServiceVersionKey.String(version.Get().Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span of the operation as a child of the span in ctx, if any
+func Start(ctx context.Context, operation string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, operation, trace.WithAttributes(attributes...))
+}
+
+// End records the error of the operation, if any, and ends its span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
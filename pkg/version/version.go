@@ -0,0 +1,29 @@
+// Package version holds build information of the CCM, set at build time with
+// -ldflags "-X github.com/deckhouse/yandex-cloud-controller-manager/pkg/version.Version=..."
+package version
+
+import "runtime"
+
+var (
+	Version   = "unknown"
+	GitCommit = "unknown"
+	BuildDate = "unknown"
+)
+
+// Info describes the running CCM build
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the build information embedded into the binary
+func Get() Info {
+	return Info{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
@@ -2,13 +2,24 @@ package yapi
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"strings"
+	"time"
 
 	//nolint:staticcheck // Ignore SA1019. Need to keep deprecated package for compatibility.
 	"github.com/golang/protobuf/proto"
 	"github.com/yandex-cloud/go-genproto/yandex/cloud/operation"
 	ycsdk "github.com/yandex-cloud/go-sdk"
 	ycsdkoperation "github.com/yandex-cloud/go-sdk/operation"
+	"github.com/yandex-cloud/go-sdk/pkg/sdkerrors"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+
+	"github.com/deckhouse/yandex-cloud-controller-manager/pkg/tracing"
 )
 
 type OperationWaiter func(ctx context.Context, origFunc func() (*operation.Operation, error)) (proto.Message, *ycsdkoperation.Operation, error)
@@ -20,6 +31,84 @@ type CloudContext struct {
 	OperationWaiter OperationWaiter
 }
 
+// APIOptions tunes the behaviour of the underlying Yandex.Cloud SDK client
+type APIOptions struct {
+	// Endpoint is the Yandex.Cloud API endpoint, public one is used if empty
+	Endpoint string
+	// TLSConfig overrides TLS settings of API connections, e.g. to trust a private CA
+	TLSConfig *tls.Config
+
+	// QPS is the sustained rate of API calls allowed, non-positive value disables rate limiting
+	QPS float64
+	// Burst is the maximum number of API calls allowed to be made at once
+	Burst int
+
+	// MaxRetries is the number of times a Get or List call failed with a transient error is retried
+	MaxRetries int
+	// RetryBaseDelay is the delay before the first retry, it is doubled for every subsequent one
+	RetryBaseDelay time.Duration
+
+	// OperationTimeout bounds waiting for a single operation to complete, non-positive value disables the bound
+	OperationTimeout time.Duration
+	// OperationPollInterval is the interval operations are polled at unless the API suggests another one
+	OperationPollInterval time.Duration
+
+	// MutationCredentials authenticate Create, Update, Delete and other mutating calls, along with polling of the
+	// operations they start. Get and List calls keep using the main credentials. Nil makes all calls use the main ones.
+	MutationCredentials ycsdk.Credentials
+}
+
+// OperationTimeoutError is returned by OperationWaiter when an operation hasn't completed within OperationTimeout.
+// The operation itself is not cancelled and may still complete later.
+type OperationTimeoutError struct {
+	OperationID string
+	Timeout     time.Duration
+}
+
+func (e *OperationTimeoutError) Error() string {
+	return fmt.Sprintf("operation (id=%s) hasn't completed in %s", e.OperationID, e.Timeout)
+}
+
+// Is makes timed out operations ErrTransient, they are worth checking again soon
+func (e *OperationTimeoutError) Is(target error) bool {
+	return target == ErrTransient
+}
+
+// OperationError is returned by OperationWaiter when an operation has failed. Unlike the SDK error, it keeps
+// the details of the operation's status, e.g. the exceeded quota or the missing permission.
+type OperationError struct {
+	OperationID string
+	Status      *status.Status
+}
+
+func (e *OperationError) Error() string {
+	msg := fmt.Sprintf("operation (id=%s) failed: code = %s desc = %s", e.OperationID, e.Status.Code(), e.Status.Message())
+	if details := OperationErrorDetails(e.Status); len(details) > 0 {
+		msg += fmt.Sprintf(" details = [%s]", strings.Join(details, "; "))
+	}
+
+	return msg
+}
+
+// GRPCStatus makes status.Code and WrapError see the code of the failed operation
+func (e *OperationError) GRPCStatus() *status.Status {
+	return e.Status
+}
+
+// OperationErrorDetails renders the details attached to the status, detail types unknown to the binary are reported by their type URL
+func OperationErrorDetails(st *status.Status) []string {
+	var details []string
+	for i, detail := range st.Details() {
+		if message, ok := detail.(proto.Message); ok {
+			details = append(details, fmt.Sprintf("%s: %v", proto.MessageName(message), message))
+		} else {
+			details = append(details, st.Proto().Details[i].TypeUrl)
+		}
+	}
+
+	return details
+}
+
 type YandexCloudAPI struct {
 	cloudCtx *CloudContext
 
@@ -30,31 +119,45 @@ type YandexCloudAPI struct {
 	OperationWaiter OperationWaiter
 }
 
-func NewYandexCloudAPI(creds ycsdk.Credentials, regionID, folderID string) (*YandexCloudAPI, error) {
-	sdk, err := ycsdk.Build(context.Background(), ycsdk.Config{Credentials: creds})
+func NewYandexCloudAPI(creds ycsdk.Credentials, regionID, folderID string, opts APIOptions) (*YandexCloudAPI, error) {
+	// errors are classified after all retries, then retries come in the chain, so that every attempt is subject to the rate limit
+	dialOpts := []grpc.DialOption{grpc.WithChainUnaryInterceptor(errorClassifierInterceptor)}
+	if opts.MaxRetries > 0 {
+		dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(retryInterceptor(opts.MaxRetries, opts.RetryBaseDelay)))
+	}
+	if opts.QPS > 0 {
+		limiter := rate.NewLimiter(rate.Limit(opts.QPS), opts.Burst)
+		dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(rateLimitInterceptor(limiter)))
+	}
+
+	sdk, err := ycsdk.Build(context.Background(), ycsdk.Config{
+		Credentials: creds,
+		Endpoint:    opts.Endpoint,
+		TLSConfig:   opts.TLSConfig,
+	}, dialOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Yandex.Cloud SDK: %s", err)
 	}
 
-	opWaiter := func(ctx context.Context, origFunc func() (*operation.Operation, error)) (proto.Message, *ycsdkoperation.Operation, error) {
-		op, err := sdk.WrapOperation(origFunc())
-		if err != nil {
-			return nil, nil, err
-		}
-
-		err = op.Wait(ctx)
+	clients := newServiceClients(sdk)
+	mutationSDK := sdk
+	if opts.MutationCredentials != nil {
+		// the dial options, and so the rate limiter, are shared, the limit applies to calls of both accounts together
+		mutationSDK, err = ycsdk.Build(context.Background(), ycsdk.Config{
+			Credentials: opts.MutationCredentials,
+			Endpoint:    opts.Endpoint,
+			TLSConfig:   opts.TLSConfig,
+		}, dialOpts...)
 		if err != nil {
-			return nil, op, err
+			return nil, fmt.Errorf("failed to create Yandex.Cloud SDK for mutations: %s", err)
 		}
 
-		resp, err := op.Response()
-		if err != nil {
-			return nil, op, err
-		}
-
-		return resp, op, nil
+		clients = splitServiceClients(clients, newServiceClients(mutationSDK))
 	}
 
+	// operations are polled with the credentials they were started with
+	opWaiter := newOperationWaiter(mutationSDK.Operation(), opts.OperationTimeout, opts.OperationPollInterval)
+
 	cloudCtx := &CloudContext{
 		RegionID: regionID,
 		FolderID: folderID,
@@ -63,11 +166,63 @@ func NewYandexCloudAPI(creds ycsdk.Credentials, regionID, folderID string) (*Yan
 	}
 
 	return &YandexCloudAPI{
-		LbSvc:      NewLoadBalancerService(sdk.LoadBalancer().NetworkLoadBalancer(), sdk.LoadBalancer().TargetGroup(), cloudCtx),
-		ComputeSvc: NewComputeService(sdk.Compute().Instance(), sdk.Compute().Zone(), cloudCtx),
-		VPCSvc:     NewVPCService(sdk.VPC().Network(), sdk.VPC().Subnet(), sdk.VPC().RouteTable(), cloudCtx),
+		LbSvc:      NewLoadBalancerService(clients.nlb, clients.targetGroup, cloudCtx),
+		ComputeSvc: NewComputeService(clients.instance, clients.zone, cloudCtx),
+		VPCSvc:     NewVPCService(clients.network, clients.subnet, clients.routeTable, clients.securityGroup, cloudCtx),
 		cloudCtx:   cloudCtx,
 
 		OperationWaiter: opWaiter,
 	}, nil
 }
+
+func newOperationWaiter(client ycsdkoperation.Client, timeout, pollInterval time.Duration) OperationWaiter {
+	if pollInterval <= 0 {
+		pollInterval = ycsdkoperation.DefaultPollInterval
+	}
+
+	return func(ctx context.Context, origFunc func() (*operation.Operation, error)) (_ proto.Message, op *ycsdkoperation.Operation, err error) {
+		ctx, span := tracing.Start(ctx, "OperationWaiter")
+		defer func() {
+			if op != nil {
+				span.SetAttributes(attribute.String("operationId", op.Id()))
+			}
+			tracing.End(span, err)
+		}()
+
+		opProto, err := origFunc()
+		if err != nil {
+			return nil, nil, err
+		}
+		op = ycsdkoperation.New(client, opProto)
+		// the ID allows correlating the change with the Yandex.Cloud audit logs
+		klog.InfoS("Waiting for operation", "operationId", op.Id(), "description", op.Description())
+
+		waitCtx := ctx
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			waitCtx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		err = op.WaitInterval(waitCtx, pollInterval)
+		if op.Failed() {
+			opErr := &OperationError{OperationID: op.Id(), Status: op.ErrorStatus()}
+			klog.ErrorS(opErr, "Operation failed", "operationId", op.Id(), "code", opErr.Status.Code(), "details", OperationErrorDetails(opErr.Status))
+			return nil, op, WrapError(opErr)
+		}
+		if err != nil {
+			// only the own deadline is reported as a timeout, the caller's one is returned as is
+			if waitCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+				return nil, op, &OperationTimeoutError{OperationID: op.Id(), Timeout: timeout}
+			}
+			return nil, op, WrapError(err)
+		}
+
+		resp, err := op.Response()
+		if err != nil {
+			return nil, op, WrapError(sdkerrors.WithMessagef(err, "operation (id=%s) response is invalid", op.Id()))
+		}
+
+		return resp, op, nil
+	}
+}
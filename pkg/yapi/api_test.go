@@ -0,0 +1,136 @@
+package yapi
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/operation"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// pendingOperationClient reports every operation as still running
+type pendingOperationClient struct {
+	operation.OperationServiceClient
+}
+
+func (pendingOperationClient) Get(_ context.Context, in *operation.GetOperationRequest, _ ...grpc.CallOption) (*operation.Operation, error) {
+	return &operation.Operation{Id: in.OperationId}, nil
+}
+
+func TestOperationWaiterTimeout(t *testing.T) {
+	opWaiter := newOperationWaiter(pendingOperationClient{}, 50*time.Millisecond, 10*time.Millisecond)
+
+	_, _, err := opWaiter(context.Background(), func() (*operation.Operation, error) {
+		return &operation.Operation{Id: "op1"}, nil
+	})
+	var timeoutErr *OperationTimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.OperationID != "op1" {
+		t.Fatalf("expected OperationTimeoutError for a hanging operation, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, _, err = opWaiter(ctx, func() (*operation.Operation, error) {
+		return &operation.Operation{Id: "op2"}, nil
+	})
+	if err == nil || errors.As(err, &timeoutErr) {
+		t.Errorf("the caller's deadline should not be reported as OperationTimeoutError, got %v", err)
+	}
+}
+
+// failedOperationClient reports every operation as failed with quota details
+type failedOperationClient struct {
+	operation.OperationServiceClient
+}
+
+func (failedOperationClient) Get(_ context.Context, in *operation.GetOperationRequest, _ ...grpc.CallOption) (*operation.Operation, error) {
+	st, err := status.New(codes.ResourceExhausted, "quota exceeded").WithDetails(&errdetails.QuotaFailure{
+		Violations: []*errdetails.QuotaFailure_Violation{{Subject: "vpc.routeTables.count"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &operation.Operation{Id: in.OperationId, Done: true, Result: &operation.Operation_Error{Error: st.Proto()}}, nil
+}
+
+func TestOperationWaiterError(t *testing.T) {
+	opWaiter := newOperationWaiter(failedOperationClient{}, time.Second, 10*time.Millisecond)
+
+	_, _, err := opWaiter(context.Background(), func() (*operation.Operation, error) {
+		return &operation.Operation{Id: "op1"}, nil
+	})
+	var opErr *OperationError
+	if !errors.As(err, &opErr) || opErr.OperationID != "op1" {
+		t.Fatalf("expected OperationError for a failed operation, got %v", err)
+	}
+	if status.Code(err) != codes.ResourceExhausted || !errors.Is(err, ErrTransient) {
+		t.Errorf("the code of the failed operation should be preserved, got %v", status.Code(err))
+	}
+	if !strings.Contains(err.Error(), "vpc.routeTables.count") {
+		t.Errorf("status details should be included in the error, got %q", err)
+	}
+}
+
+func TestOperationWaiterSpan(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	prevProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(prevProvider)
+
+	opWaiter := newOperationWaiter(failedOperationClient{}, time.Second, 10*time.Millisecond)
+	_, _, _ = opWaiter(context.Background(), func() (*operation.Operation, error) {
+		return &operation.Operation{Id: "op1"}, nil
+	})
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "OperationWaiter" {
+		t.Fatalf("expected a single OperationWaiter span, got %v", spans)
+	}
+	if spans[0].StatusCode != otelcodes.Error {
+		t.Errorf("the span of a failed operation should have the error status, got %v", spans[0].StatusCode)
+	}
+	if !reflect.DeepEqual(spans[0].Attributes, []attribute.KeyValue{attribute.String("operationId", "op1")}) {
+		t.Errorf("the span should record the operation ID, got %v", spans[0].Attributes)
+	}
+}
+
+// unpolledOperationClient fails the test if an operation is polled
+type unpolledOperationClient struct {
+	operation.OperationServiceClient
+	t *testing.T
+}
+
+func (c unpolledOperationClient) Get(_ context.Context, in *operation.GetOperationRequest, _ ...grpc.CallOption) (*operation.Operation, error) {
+	c.t.Errorf("completed operation %q should not be polled", in.OperationId)
+	return nil, status.Error(codes.Internal, "unexpected poll")
+}
+
+func TestOperationWaiterCompletedWithError(t *testing.T) {
+	opWaiter := newOperationWaiter(unpolledOperationClient{t: t}, time.Second, 10*time.Millisecond)
+
+	// some operations are returned already completed, their error must not be mistaken for success
+	st := status.New(codes.FailedPrecondition, "RouteTable is being updated")
+	_, _, err := opWaiter(context.Background(), func() (*operation.Operation, error) {
+		return &operation.Operation{Id: "op1", Done: true, Result: &operation.Operation_Error{Error: st.Proto()}}, nil
+	})
+	var opErr *OperationError
+	if !errors.As(err, &opErr) || opErr.OperationID != "op1" {
+		t.Fatalf("expected OperationError for an operation completed with an error, got %v", err)
+	}
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("the code of the failed operation should be classified, got %v", ErrorKind(err))
+	}
+}
@@ -0,0 +1,208 @@
+package yapi
+
+import (
+	"context"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/compute/v1"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/loadbalancer/v1"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/operation"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
+	ycsdk "github.com/yandex-cloud/go-sdk"
+	"google.golang.org/grpc"
+)
+
+// RouteTableClient is the part of the VPC RouteTable API used by the CCM, so that it can be replaced with a fake in tests
+type RouteTableClient interface {
+	Get(ctx context.Context, in *vpc.GetRouteTableRequest, opts ...grpc.CallOption) (*vpc.RouteTable, error)
+	Update(ctx context.Context, in *vpc.UpdateRouteTableRequest, opts ...grpc.CallOption) (*operation.Operation, error)
+}
+
+// ComputeClient is the part of the Compute Instance API used by the CCM, so that it can be replaced with a fake in tests
+type ComputeClient interface {
+	Get(ctx context.Context, in *compute.GetInstanceRequest, opts ...grpc.CallOption) (*compute.Instance, error)
+	List(ctx context.Context, in *compute.ListInstancesRequest, opts ...grpc.CallOption) (*compute.ListInstancesResponse, error)
+	UpdateNetworkInterface(ctx context.Context, in *compute.UpdateInstanceNetworkInterfaceRequest, opts ...grpc.CallOption) (*operation.Operation, error)
+}
+
+// NLBClient is the part of the NetworkLoadBalancer API used by the CCM, so that it can be replaced with a fake in tests
+type NLBClient interface {
+	List(ctx context.Context, in *loadbalancer.ListNetworkLoadBalancersRequest, opts ...grpc.CallOption) (*loadbalancer.ListNetworkLoadBalancersResponse, error)
+	Create(ctx context.Context, in *loadbalancer.CreateNetworkLoadBalancerRequest, opts ...grpc.CallOption) (*operation.Operation, error)
+	Update(ctx context.Context, in *loadbalancer.UpdateNetworkLoadBalancerRequest, opts ...grpc.CallOption) (*operation.Operation, error)
+	Delete(ctx context.Context, in *loadbalancer.DeleteNetworkLoadBalancerRequest, opts ...grpc.CallOption) (*operation.Operation, error)
+	AttachTargetGroup(ctx context.Context, in *loadbalancer.AttachNetworkLoadBalancerTargetGroupRequest, opts ...grpc.CallOption) (*operation.Operation, error)
+	DetachTargetGroup(ctx context.Context, in *loadbalancer.DetachNetworkLoadBalancerTargetGroupRequest, opts ...grpc.CallOption) (*operation.Operation, error)
+	AddListener(ctx context.Context, in *loadbalancer.AddNetworkLoadBalancerListenerRequest, opts ...grpc.CallOption) (*operation.Operation, error)
+	RemoveListener(ctx context.Context, in *loadbalancer.RemoveNetworkLoadBalancerListenerRequest, opts ...grpc.CallOption) (*operation.Operation, error)
+}
+
+// serviceClients are the Yandex.Cloud API clients the services are built of
+type serviceClients struct {
+	nlb           loadbalancer.NetworkLoadBalancerServiceClient
+	targetGroup   loadbalancer.TargetGroupServiceClient
+	instance      compute.InstanceServiceClient
+	zone          compute.ZoneServiceClient
+	network       vpc.NetworkServiceClient
+	subnet        vpc.SubnetServiceClient
+	routeTable    vpc.RouteTableServiceClient
+	securityGroup vpc.SecurityGroupServiceClient
+}
+
+func newServiceClients(sdk *ycsdk.SDK) serviceClients {
+	return serviceClients{
+		nlb:           sdk.LoadBalancer().NetworkLoadBalancer(),
+		targetGroup:   sdk.LoadBalancer().TargetGroup(),
+		instance:      sdk.Compute().Instance(),
+		zone:          sdk.Compute().Zone(),
+		network:       sdk.VPC().Network(),
+		subnet:        sdk.VPC().Subnet(),
+		routeTable:    sdk.VPC().RouteTable(),
+		securityGroup: sdk.VPC().SecurityGroup(),
+	}
+}
+
+// splitServiceClients routes Get and List calls to the read clients and all the other, mutating, calls to the write ones.
+// A mutating call missing an override below still goes to the write client, so a read-only account never fails writes.
+func splitServiceClients(read, write serviceClients) serviceClients {
+	return serviceClients{
+		nlb:           &splitNLBClient{NetworkLoadBalancerServiceClient: write.nlb, read: read.nlb},
+		targetGroup:   &splitTargetGroupClient{TargetGroupServiceClient: write.targetGroup, read: read.targetGroup},
+		instance:      &splitInstanceClient{InstanceServiceClient: write.instance, read: read.instance},
+		zone:          read.zone,
+		network:       &splitNetworkClient{NetworkServiceClient: write.network, read: read.network},
+		subnet:        &splitSubnetClient{SubnetServiceClient: write.subnet, read: read.subnet},
+		routeTable:    &splitRouteTableClient{RouteTableServiceClient: write.routeTable, read: read.routeTable},
+		securityGroup: &splitSecurityGroupClient{SecurityGroupServiceClient: write.securityGroup, read: read.securityGroup},
+	}
+}
+
+type splitNLBClient struct {
+	loadbalancer.NetworkLoadBalancerServiceClient
+	read loadbalancer.NetworkLoadBalancerServiceClient
+}
+
+func (c *splitNLBClient) Get(ctx context.Context, in *loadbalancer.GetNetworkLoadBalancerRequest, opts ...grpc.CallOption) (*loadbalancer.NetworkLoadBalancer, error) {
+	return c.read.Get(ctx, in, opts...)
+}
+
+func (c *splitNLBClient) List(ctx context.Context, in *loadbalancer.ListNetworkLoadBalancersRequest, opts ...grpc.CallOption) (*loadbalancer.ListNetworkLoadBalancersResponse, error) {
+	return c.read.List(ctx, in, opts...)
+}
+
+func (c *splitNLBClient) GetTargetStates(ctx context.Context, in *loadbalancer.GetTargetStatesRequest, opts ...grpc.CallOption) (*loadbalancer.GetTargetStatesResponse, error) {
+	return c.read.GetTargetStates(ctx, in, opts...)
+}
+
+func (c *splitNLBClient) ListOperations(ctx context.Context, in *loadbalancer.ListNetworkLoadBalancerOperationsRequest, opts ...grpc.CallOption) (*loadbalancer.ListNetworkLoadBalancerOperationsResponse, error) {
+	return c.read.ListOperations(ctx, in, opts...)
+}
+
+type splitTargetGroupClient struct {
+	loadbalancer.TargetGroupServiceClient
+	read loadbalancer.TargetGroupServiceClient
+}
+
+func (c *splitTargetGroupClient) Get(ctx context.Context, in *loadbalancer.GetTargetGroupRequest, opts ...grpc.CallOption) (*loadbalancer.TargetGroup, error) {
+	return c.read.Get(ctx, in, opts...)
+}
+
+func (c *splitTargetGroupClient) List(ctx context.Context, in *loadbalancer.ListTargetGroupsRequest, opts ...grpc.CallOption) (*loadbalancer.ListTargetGroupsResponse, error) {
+	return c.read.List(ctx, in, opts...)
+}
+
+func (c *splitTargetGroupClient) ListOperations(ctx context.Context, in *loadbalancer.ListTargetGroupOperationsRequest, opts ...grpc.CallOption) (*loadbalancer.ListTargetGroupOperationsResponse, error) {
+	return c.read.ListOperations(ctx, in, opts...)
+}
+
+type splitInstanceClient struct {
+	compute.InstanceServiceClient
+	read compute.InstanceServiceClient
+}
+
+func (c *splitInstanceClient) Get(ctx context.Context, in *compute.GetInstanceRequest, opts ...grpc.CallOption) (*compute.Instance, error) {
+	return c.read.Get(ctx, in, opts...)
+}
+
+func (c *splitInstanceClient) List(ctx context.Context, in *compute.ListInstancesRequest, opts ...grpc.CallOption) (*compute.ListInstancesResponse, error) {
+	return c.read.List(ctx, in, opts...)
+}
+
+func (c *splitInstanceClient) GetSerialPortOutput(ctx context.Context, in *compute.GetInstanceSerialPortOutputRequest, opts ...grpc.CallOption) (*compute.GetInstanceSerialPortOutputResponse, error) {
+	return c.read.GetSerialPortOutput(ctx, in, opts...)
+}
+
+func (c *splitInstanceClient) ListOperations(ctx context.Context, in *compute.ListInstanceOperationsRequest, opts ...grpc.CallOption) (*compute.ListInstanceOperationsResponse, error) {
+	return c.read.ListOperations(ctx, in, opts...)
+}
+
+type splitNetworkClient struct {
+	vpc.NetworkServiceClient
+	read vpc.NetworkServiceClient
+}
+
+func (c *splitNetworkClient) Get(ctx context.Context, in *vpc.GetNetworkRequest, opts ...grpc.CallOption) (*vpc.Network, error) {
+	return c.read.Get(ctx, in, opts...)
+}
+
+func (c *splitNetworkClient) List(ctx context.Context, in *vpc.ListNetworksRequest, opts ...grpc.CallOption) (*vpc.ListNetworksResponse, error) {
+	return c.read.List(ctx, in, opts...)
+}
+
+func (c *splitNetworkClient) ListSubnets(ctx context.Context, in *vpc.ListNetworkSubnetsRequest, opts ...grpc.CallOption) (*vpc.ListNetworkSubnetsResponse, error) {
+	return c.read.ListSubnets(ctx, in, opts...)
+}
+
+func (c *splitNetworkClient) ListOperations(ctx context.Context, in *vpc.ListNetworkOperationsRequest, opts ...grpc.CallOption) (*vpc.ListNetworkOperationsResponse, error) {
+	return c.read.ListOperations(ctx, in, opts...)
+}
+
+type splitSubnetClient struct {
+	vpc.SubnetServiceClient
+	read vpc.SubnetServiceClient
+}
+
+func (c *splitSubnetClient) Get(ctx context.Context, in *vpc.GetSubnetRequest, opts ...grpc.CallOption) (*vpc.Subnet, error) {
+	return c.read.Get(ctx, in, opts...)
+}
+
+func (c *splitSubnetClient) List(ctx context.Context, in *vpc.ListSubnetsRequest, opts ...grpc.CallOption) (*vpc.ListSubnetsResponse, error) {
+	return c.read.List(ctx, in, opts...)
+}
+
+func (c *splitSubnetClient) ListOperations(ctx context.Context, in *vpc.ListSubnetOperationsRequest, opts ...grpc.CallOption) (*vpc.ListSubnetOperationsResponse, error) {
+	return c.read.ListOperations(ctx, in, opts...)
+}
+
+type splitRouteTableClient struct {
+	vpc.RouteTableServiceClient
+	read vpc.RouteTableServiceClient
+}
+
+func (c *splitRouteTableClient) Get(ctx context.Context, in *vpc.GetRouteTableRequest, opts ...grpc.CallOption) (*vpc.RouteTable, error) {
+	return c.read.Get(ctx, in, opts...)
+}
+
+func (c *splitRouteTableClient) List(ctx context.Context, in *vpc.ListRouteTablesRequest, opts ...grpc.CallOption) (*vpc.ListRouteTablesResponse, error) {
+	return c.read.List(ctx, in, opts...)
+}
+
+func (c *splitRouteTableClient) ListOperations(ctx context.Context, in *vpc.ListRouteTableOperationsRequest, opts ...grpc.CallOption) (*vpc.ListRouteTableOperationsResponse, error) {
+	return c.read.ListOperations(ctx, in, opts...)
+}
+
+type splitSecurityGroupClient struct {
+	vpc.SecurityGroupServiceClient
+	read vpc.SecurityGroupServiceClient
+}
+
+func (c *splitSecurityGroupClient) Get(ctx context.Context, in *vpc.GetSecurityGroupRequest, opts ...grpc.CallOption) (*vpc.SecurityGroup, error) {
+	return c.read.Get(ctx, in, opts...)
+}
+
+func (c *splitSecurityGroupClient) List(ctx context.Context, in *vpc.ListSecurityGroupsRequest, opts ...grpc.CallOption) (*vpc.ListSecurityGroupsResponse, error) {
+	return c.read.List(ctx, in, opts...)
+}
+
+func (c *splitSecurityGroupClient) ListOperations(ctx context.Context, in *vpc.ListSecurityGroupOperationsRequest, opts ...grpc.CallOption) (*vpc.ListSecurityGroupOperationsResponse, error) {
+	return c.read.ListOperations(ctx, in, opts...)
+}
@@ -0,0 +1,46 @@
+package yapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/operation"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
+	"google.golang.org/grpc"
+)
+
+// recordingRouteTableClient records the calls made through it, unimplemented methods panic
+type recordingRouteTableClient struct {
+	vpc.RouteTableServiceClient
+	calls []string
+}
+
+func (c *recordingRouteTableClient) Get(context.Context, *vpc.GetRouteTableRequest, ...grpc.CallOption) (*vpc.RouteTable, error) {
+	c.calls = append(c.calls, "Get")
+	return &vpc.RouteTable{}, nil
+}
+
+func (c *recordingRouteTableClient) Update(context.Context, *vpc.UpdateRouteTableRequest, ...grpc.CallOption) (*operation.Operation, error) {
+	c.calls = append(c.calls, "Update")
+	return &operation.Operation{}, nil
+}
+
+func TestSplitServiceClients(t *testing.T) {
+	read, write := &recordingRouteTableClient{}, &recordingRouteTableClient{}
+	clients := splitServiceClients(serviceClients{routeTable: read}, serviceClients{routeTable: write})
+
+	ctx := context.Background()
+	if _, err := clients.routeTable.Get(ctx, &vpc.GetRouteTableRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clients.routeTable.Update(ctx, &vpc.UpdateRouteTableRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(read.calls) != 1 || read.calls[0] != "Get" {
+		t.Errorf("expected only Get to go to the read client, got %v", read.calls)
+	}
+	if len(write.calls) != 1 || write.calls[0] != "Update" {
+		t.Errorf("expected only Update to go to the write client, got %v", write.calls)
+	}
+}
@@ -5,16 +5,19 @@ import (
 	"fmt"
 
 	"github.com/yandex-cloud/go-genproto/yandex/cloud/compute/v1"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/operation"
+	"google.golang.org/genproto/protobuf/field_mask"
+	"k8s.io/klog/v2"
 )
 
 type ComputeService struct {
 	cloudCtx *CloudContext
 
-	InstanceSvc compute.InstanceServiceClient
+	InstanceSvc ComputeClient
 	ZoneSvc     compute.ZoneServiceClient
 }
 
-func NewComputeService(iSvc compute.InstanceServiceClient, zSvc compute.ZoneServiceClient,
+func NewComputeService(iSvc ComputeClient, zSvc compute.ZoneServiceClient,
 	cloudCtx *CloudContext) *ComputeService {
 
 	return &ComputeService{
@@ -39,8 +42,25 @@ func (cs *ComputeService) FindInstanceByName(ctx context.Context, instanceName s
 		return nil, fmt.Errorf("more than 1 Instances found by the name %q", instanceName)
 	}
 	if len(result.Instances) == 0 {
-		return nil, fmt.Errorf("no than 1 Instances found by the name %q", instanceName)
+		return nil, nil
 	}
 
 	return result.Instances[0], nil
 }
+
+// UpdateNetworkInterfaceSecurityGroups replaces SecurityGroups of the Instance's network interface
+func (cs *ComputeService) UpdateNetworkInterfaceSecurityGroups(ctx context.Context, instanceID, interfaceIndex string, sgIDs []string) error {
+	req := &compute.UpdateInstanceNetworkInterfaceRequest{
+		InstanceId:            instanceID,
+		NetworkInterfaceIndex: interfaceIndex,
+		UpdateMask:            &field_mask.FieldMask{Paths: []string{"security_group_ids"}},
+		SecurityGroupIds:      sgIDs,
+	}
+	klog.InfoS("Updating Instance network interface SecurityGroups", "instanceId", instanceID, "operation", "updateNetworkInterface", "request", req)
+
+	_, _, err := cs.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
+		return cs.InstanceSvc.UpdateNetworkInterface(ctx, req)
+	})
+
+	return err
+}
@@ -0,0 +1,101 @@
+package yapi
+
+import (
+	"context"
+	"errors"
+
+	pkgerrors "github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Kinds of errors, matched with errors.Is, so that callers can tell failures worth retrying soon from permanent ones
+var (
+	// ErrTransient is a failure that is likely to go away on retry: API unavailability, throttling, timeouts
+	ErrTransient = errors.New("transient error")
+	// ErrNotFound is a missing resource
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is a resource modified concurrently or being in a state the call can't be applied in
+	ErrConflict = errors.New("conflict")
+)
+
+// Error is an error classified with one of the error kinds. The gRPC status of the wrapped error is preserved,
+// so status.Code keeps working on it.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+// NewError classifies err with the kind explicitly
+func NewError(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &Error{Kind: kind, Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *Error) GRPCStatus() *status.Status {
+	return status.Convert(pkgerrors.Cause(e.Err))
+}
+
+// WrapError classifies err by its gRPC code. Already classified and unrecognized errors are returned as is.
+func WrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var classified *Error
+	if errors.As(err, &classified) {
+		return err
+	}
+
+	if kind := errorKindOfCode(status.Code(pkgerrors.Cause(err))); kind != nil {
+		return &Error{Kind: kind, Err: err}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &Error{Kind: ErrTransient, Err: err}
+	}
+
+	return err
+}
+
+func errorKindOfCode(code codes.Code) error {
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return ErrTransient
+	case codes.NotFound:
+		return ErrNotFound
+	case codes.AlreadyExists, codes.Aborted, codes.FailedPrecondition:
+		return ErrConflict
+	default:
+		return nil
+	}
+}
+
+// ErrorKind names the kind of err for logs and alerting: "transient", "not_found", "conflict" or "permanent"
+func ErrorKind(err error) string {
+	err = WrapError(err)
+	switch {
+	case errors.Is(err, ErrTransient):
+		return "transient"
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrConflict):
+		return "conflict"
+	default:
+		return "permanent"
+	}
+}
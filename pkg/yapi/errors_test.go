@@ -0,0 +1,48 @@
+package yapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/yandex-cloud/go-sdk/pkg/sdkerrors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWrapError(t *testing.T) {
+	tests := []struct {
+		err          error
+		expectedKind string
+	}{
+		{status.Error(codes.Unavailable, ""), "transient"},
+		{status.Error(codes.ResourceExhausted, ""), "transient"},
+		{status.Error(codes.NotFound, ""), "not_found"},
+		{status.Error(codes.FailedPrecondition, ""), "conflict"},
+		{status.Error(codes.InvalidArgument, ""), "permanent"},
+		{sdkerrors.WithMessagef(status.Error(codes.Aborted, ""), "operation (id=%s) failed", "op1"), "conflict"},
+		{pkgerrors.Wrap(context.DeadlineExceeded, "waiting"), "transient"},
+		{&OperationTimeoutError{OperationID: "op1", Timeout: time.Minute}, "transient"},
+		{errors.New("boom"), "permanent"},
+	}
+
+	for _, tc := range tests {
+		if kind := ErrorKind(tc.err); kind != tc.expectedKind {
+			t.Errorf("ErrorKind(%v) = %q, expected %q", tc.err, kind, tc.expectedKind)
+		}
+	}
+
+	err := pkgerrors.Wrap(WrapError(status.Error(codes.NotFound, "no such LB")), "failed to get LB")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("wrapped error should match ErrNotFound")
+	}
+	var classified *Error
+	if !errors.As(err, &classified) || status.Code(classified) != codes.NotFound {
+		t.Errorf("classified error should keep its gRPC status, got %v", classified)
+	}
+	if err.Error() != "failed to get LB: rpc error: code = NotFound desc = no such LB" {
+		t.Errorf("classification should not change the message, got %q", err.Error())
+	}
+}
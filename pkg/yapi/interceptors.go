@@ -0,0 +1,83 @@
+package yapi
+
+import (
+	"context"
+	"math/rand"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorClassifierInterceptor classifies errors of all API calls, it comes first in the chain to see the final error
+func errorClassifierInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return WrapError(invoker(ctx, method, req, reply, cc, opts...))
+}
+
+// rateLimitInterceptor delays every outgoing call until the limiter allows it.
+// If the caller's context expires (or is certain to expire) before that, the call fails without reaching the API.
+func rateLimitInterceptor(limiter *rate.Limiter) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// retryInterceptor retries idempotent (Get and List) calls failed with a transient error,
+// doubling the delay between attempts. Mutating calls are passed through as is.
+func retryInterceptor(maxRetries int, baseDelay time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !isIdempotentMethod(method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		var err error
+		for attempt := 0; ; attempt++ {
+			err = invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil || attempt >= maxRetries || !isTransientError(err) || ctx.Err() != nil {
+				return err
+			}
+
+			timer := time.NewTimer(retryDelay(baseDelay, attempt))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// isIdempotentMethod reports whether the full gRPC method name (e.g. "/yandex.cloud.vpc.v1.RouteTableService/Get")
+// refers to a read-only call that is safe to repeat
+func isIdempotentMethod(method string) bool {
+	name := path.Base(method)
+	return strings.HasPrefix(name, "Get") || strings.HasPrefix(name, "List")
+}
+
+func isTransientError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryDelay returns the exponential backoff delay for the given attempt with up to 50% jitter added
+func retryDelay(baseDelay time.Duration, attempt int) time.Duration {
+	delay := baseDelay << attempt
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
@@ -0,0 +1,68 @@
+package yapi
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryInterceptor(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		errs          []error
+		expectedCalls int
+		expectedCode  codes.Code
+	}{
+		{
+			name:          "get succeeds after transient errors",
+			method:        "/yandex.cloud.compute.v1.InstanceService/Get",
+			errs:          []error{status.Error(codes.Unavailable, ""), status.Error(codes.DeadlineExceeded, ""), nil},
+			expectedCalls: 3,
+			expectedCode:  codes.OK,
+		},
+		{
+			name:          "list gives up after max retries",
+			method:        "/yandex.cloud.vpc.v1.RouteTableService/List",
+			errs:          []error{status.Error(codes.Unavailable, ""), status.Error(codes.Unavailable, ""), status.Error(codes.Unavailable, ""), nil},
+			expectedCalls: 3,
+			expectedCode:  codes.Unavailable,
+		},
+		{
+			name:          "non-transient error is not retried",
+			method:        "/yandex.cloud.compute.v1.InstanceService/Get",
+			errs:          []error{status.Error(codes.NotFound, ""), nil},
+			expectedCalls: 1,
+			expectedCode:  codes.NotFound,
+		},
+		{
+			name:          "mutation is not retried",
+			method:        "/yandex.cloud.vpc.v1.RouteTableService/Update",
+			errs:          []error{status.Error(codes.Unavailable, ""), nil},
+			expectedCalls: 1,
+			expectedCode:  codes.Unavailable,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int
+			invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				err := tc.errs[calls]
+				calls++
+				return err
+			}
+
+			err := retryInterceptor(2, 0)(context.Background(), tc.method, nil, nil, nil, invoker)
+			if code := status.Code(err); code != tc.expectedCode {
+				t.Errorf("expected code %s, got %s", tc.expectedCode, code)
+			}
+			if calls != tc.expectedCalls {
+				t.Errorf("expected %d calls, got %d", tc.expectedCalls, calls)
+			}
+		})
+	}
+}
@@ -3,26 +3,30 @@ package yapi
 import (
 	"context"
 	"fmt"
-	"log"
+	"net"
 	"strings"
 
+	//nolint:staticcheck // Ignore SA1019. Need to keep deprecated package for compatibility.
+	"github.com/golang/protobuf/proto"
 	"github.com/yandex-cloud/go-genproto/yandex/cloud/loadbalancer/v1"
+	"google.golang.org/genproto/protobuf/field_mask"
 
 	"github.com/yandex-cloud/go-genproto/yandex/cloud/operation"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
 )
 
 type LoadBalancerService struct {
 	cloudCtx *CloudContext
 
-	LbSvc loadbalancer.NetworkLoadBalancerServiceClient
+	LbSvc NLBClient
 	TgSvc loadbalancer.TargetGroupServiceClient
 }
 
-func NewLoadBalancerService(lbSvc loadbalancer.NetworkLoadBalancerServiceClient, tgSvc loadbalancer.TargetGroupServiceClient,
+func NewLoadBalancerService(lbSvc NLBClient, tgSvc loadbalancer.TargetGroupServiceClient,
 	cloudCtx *CloudContext) *LoadBalancerService {
 
 	return &LoadBalancerService{
@@ -33,78 +37,158 @@ func NewLoadBalancerService(lbSvc loadbalancer.NetworkLoadBalancerServiceClient,
 	}
 }
 
-func (ySvc *LoadBalancerService) CreateOrUpdateLB(ctx context.Context, name string, listenerSpec []*loadbalancer.ListenerSpec, attachedTGs []*loadbalancer.AttachedTargetGroup) (string, error) {
-	var nlbType = loadbalancer.NetworkLoadBalancer_EXTERNAL
-	for _, listener := range listenerSpec {
-		if _, ok := listener.Address.(*loadbalancer.ListenerSpec_InternalAddressSpec); ok {
-			nlbType = loadbalancer.NetworkLoadBalancer_INTERNAL
-			break
-		}
-	}
+// CreateOrUpdateLB ensures the LB exists with the given Listeners and attached TargetGroups, returning distinct addresses of its Listeners
+func (ySvc *LoadBalancerService) CreateOrUpdateLB(ctx context.Context, folderID, name string, labels map[string]string, listenerSpec []*loadbalancer.ListenerSpec, attachedTGs []*loadbalancer.AttachedTargetGroup) ([]string, error) {
+	nlbType := getNLBType(listenerSpec)
 
-	log.Printf("Getting LB by name: %q", name)
-	lb, err := ySvc.GetLbByName(ctx, name)
+	klog.InfoS("Getting LB by name", "lbName", name, "folderId", folderID)
+	lb, err := ySvc.GetLbByName(ctx, folderID, name)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
-			log.Println("LB not found, creating new LB")
+			klog.InfoS("LB not found, creating new LB", "lbName", name)
 		} else {
-			return "", err
+			return nil, err
 		}
 	}
 
 	lbCreateRequest := &loadbalancer.CreateNetworkLoadBalancerRequest{
-		FolderId:             ySvc.cloudCtx.FolderID,
+		FolderId:             folderID,
 		Name:                 name,
 		RegionId:             ySvc.cloudCtx.RegionID,
 		Type:                 nlbType,
+		Labels:               labels,
 		ListenerSpecs:        listenerSpec,
 		AttachedTargetGroups: attachedTGs,
 	}
 
 	if lb == nil {
-		log.Printf("Creating LoadBalancer: %+v", *lbCreateRequest)
+		klog.InfoS("Creating LoadBalancer", "lbName", name, "operation", "create", "request", lbCreateRequest)
 
 		result, _, err := ySvc.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
 			return ySvc.LbSvc.Create(ctx, lbCreateRequest)
 		})
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
-		return result.(*loadbalancer.NetworkLoadBalancer).Listeners[0].Address, nil
+		return ListenerAddresses(result.(*loadbalancer.NetworkLoadBalancer).Listeners, ""), nil
 	}
 
 	if lb != nil && shouldRecreate(lb, lbCreateRequest) {
-		log.Printf("Re-creating LoadBalancer: %+v", *lbCreateRequest)
+		klog.InfoS("Re-creating LoadBalancer", "lbName", name, "operation", "recreate", "request", lbCreateRequest)
 
 		_, _, err := ySvc.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
 			return ySvc.LbSvc.Delete(ctx, &loadbalancer.DeleteNetworkLoadBalancerRequest{NetworkLoadBalancerId: lb.Id})
 		})
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		result, _, err := ySvc.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
 			return ySvc.LbSvc.Create(ctx, lbCreateRequest)
 		})
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
-		return result.(*loadbalancer.NetworkLoadBalancer).Listeners[0].Address, nil
+		return ListenerAddresses(result.(*loadbalancer.NetworkLoadBalancer).Listeners, ""), nil
 	}
 
-	log.Printf("LB %q already exists, attempting an update\n", name)
+	klog.InfoS("LB already exists, attempting an update", "lbName", name)
 
-	dirty := false
+	if err := ySvc.ensureLBLabels(ctx, lb, labels); err != nil {
+		return nil, err
+	}
 
 	listenersToAdd, listenersToRemove := diffListeners(listenerSpec, lb.Listeners)
+	lb, err = ySvc.updateLB(ctx, folderID, lb, listenersToAdd, listenersToRemove, attachedTGs)
+	if err != nil {
+		return nil, err
+	}
+
+	return ListenerAddresses(lb.Listeners, ""), nil
+}
+
+// ensureLBLabels adds missing labels to the existing LB, labels set by others are kept
+func (ySvc *LoadBalancerService) ensureLBLabels(ctx context.Context, lb *loadbalancer.NetworkLoadBalancer, labels map[string]string) error {
+	newLabels, changed := mergeLabels(lb.Labels, labels)
+	if !changed {
+		return nil
+	}
+
+	req := &loadbalancer.UpdateNetworkLoadBalancerRequest{
+		NetworkLoadBalancerId: lb.Id,
+		UpdateMask:            &field_mask.FieldMask{Paths: []string{"labels"}},
+		Labels:                newLabels,
+	}
+	klog.InfoS("Updating LB labels", "lbName", lb.Name, "operation", "update", "request", req)
+
+	_, _, err := ySvc.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
+		return ySvc.LbSvc.Update(ctx, req)
+	})
+	if err != nil {
+		return err
+	}
+	lb.Labels = newLabels
+
+	return nil
+}
+
+// ensureTGLabels adds missing labels to the existing TG, labels set by others are kept
+func (ySvc *LoadBalancerService) ensureTGLabels(ctx context.Context, tg *loadbalancer.TargetGroup, labels map[string]string) error {
+	newLabels, changed := mergeLabels(tg.Labels, labels)
+	if !changed {
+		return nil
+	}
+
+	req := &loadbalancer.UpdateTargetGroupRequest{
+		TargetGroupId: tg.Id,
+		UpdateMask:    &field_mask.FieldMask{Paths: []string{"labels"}},
+		Labels:        newLabels,
+	}
+	klog.InfoS("Updating TargetGroup labels", "tgName", tg.Name, "operation", "update", "request", req)
+
+	_, _, err := ySvc.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
+		return ySvc.TgSvc.Update(ctx, req)
+	})
+	if err != nil {
+		return err
+	}
+	tg.Labels = newLabels
+
+	return nil
+}
+
+// mergeLabels returns the existing labels with the given ones added or overridden, and whether anything changed
+func mergeLabels(existing, labels map[string]string) (map[string]string, bool) {
+	merged := make(map[string]string, len(existing)+len(labels))
+	for key, value := range existing {
+		merged[key] = value
+	}
+
+	changed := false
+	for key, value := range labels {
+		if existingValue, ok := existing[key]; !ok || existingValue != value {
+			merged[key] = value
+			changed = true
+		}
+	}
+
+	return merged, changed
+}
+
+// updateLB applies Listener and attached TargetGroup changes to the existing LB, returning its up-to-date state
+func (ySvc *LoadBalancerService) updateLB(ctx context.Context, folderID string, lb *loadbalancer.NetworkLoadBalancer,
+	listenersToAdd []*loadbalancer.ListenerSpec, listenersToRemove []*loadbalancer.Listener, attachedTGs []*loadbalancer.AttachedTargetGroup) (*loadbalancer.NetworkLoadBalancer, error) {
+	var err error
+	dirty := false
+
 	for _, listener := range listenersToRemove {
 		req := &loadbalancer.RemoveNetworkLoadBalancerListenerRequest{
 			NetworkLoadBalancerId: lb.Id,
 			ListenerName:          listener.Name,
 		}
-		log.Printf("Removing Listener: %+v", *req)
+		klog.InfoS("Removing Listener", "lbName", lb.Name, "operation", "removeListener", "request", req)
 
 		// todo(31337Ghost) it will be better to send requests concurrently
 		_, _, err := ySvc.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
@@ -112,7 +196,7 @@ func (ySvc *LoadBalancerService) CreateOrUpdateLB(ctx context.Context, name stri
 		})
 
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		dirty = true
@@ -122,7 +206,7 @@ func (ySvc *LoadBalancerService) CreateOrUpdateLB(ctx context.Context, name stri
 			NetworkLoadBalancerId: lb.Id,
 			ListenerSpec:          listener,
 		}
-		log.Printf("Adding Listener: %+v", *req)
+		klog.InfoS("Adding Listener", "lbName", lb.Name, "operation", "addListener", "request", req)
 
 		// todo(31337Ghost) it will be better to send requests concurrently
 		_, _, err := ySvc.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
@@ -130,19 +214,39 @@ func (ySvc *LoadBalancerService) CreateOrUpdateLB(ctx context.Context, name stri
 		})
 
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		dirty = true
 	}
 
-	tgsToAttach, tgsToDetach := diffAttachedTargetGroups(attachedTGs, lb.AttachedTargetGroups)
+	tgsToAttach, tgsToDetach, healthChecksChanged := diffAttachedTargetGroups(attachedTGs, lb.AttachedTargetGroups)
+	if healthChecksChanged {
+		// health checks of an attached TargetGroup can't be changed without detaching it,
+		// so replace all attached TargetGroups at once to avoid a gap in traffic
+		req := &loadbalancer.UpdateNetworkLoadBalancerRequest{
+			NetworkLoadBalancerId: lb.Id,
+			UpdateMask:            &field_mask.FieldMask{Paths: []string{"attached_target_groups"}},
+			AttachedTargetGroups:  attachedTGs,
+		}
+		klog.InfoS("Updating attached TargetGroups", "lbName", lb.Name, "operation", "update", "request", req)
+
+		_, _, err := ySvc.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
+			return ySvc.LbSvc.Update(ctx, req)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		tgsToAttach, tgsToDetach = nil, nil
+		dirty = true
+	}
 	for _, tg := range tgsToDetach {
 		req := &loadbalancer.DetachNetworkLoadBalancerTargetGroupRequest{
 			NetworkLoadBalancerId: lb.Id,
 			TargetGroupId:         tg.TargetGroupId,
 		}
-		log.Printf("Detaching TargetGroup: %+v", *req)
+		klog.InfoS("Detaching TargetGroup", "lbName", lb.Name, "operation", "detachTargetGroup", "request", req)
 
 		// todo(31337Ghost) it will be better to send requests concurrently
 		_, _, err := ySvc.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
@@ -150,7 +254,7 @@ func (ySvc *LoadBalancerService) CreateOrUpdateLB(ctx context.Context, name stri
 		})
 
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		dirty = true
@@ -160,7 +264,7 @@ func (ySvc *LoadBalancerService) CreateOrUpdateLB(ctx context.Context, name stri
 			NetworkLoadBalancerId: lb.Id,
 			AttachedTargetGroup:   tg,
 		}
-		log.Printf("Attaching TargetGroup: %+v", *req)
+		klog.InfoS("Attaching TargetGroup", "lbName", lb.Name, "operation", "attachTargetGroup", "request", req)
 
 		// todo(31337Ghost) it will be better to send requests concurrently
 		_, _, err := ySvc.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
@@ -168,7 +272,7 @@ func (ySvc *LoadBalancerService) CreateOrUpdateLB(ctx context.Context, name stri
 		})
 
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		dirty = true
@@ -176,19 +280,186 @@ func (ySvc *LoadBalancerService) CreateOrUpdateLB(ctx context.Context, name stri
 
 	// Ensure that after all manipulations with LoadBalancer in the cloud it still exists.
 	if dirty {
-		log.Printf("Retrieving LoadBalancer %q after update", name)
-		lb, err = ySvc.GetLbByName(ctx, name)
+		klog.InfoS("Retrieving LoadBalancer after update", "lbName", lb.Name)
+		lb, err = ySvc.GetLbByName(ctx, folderID, lb.Name)
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+		if lb == nil {
+			return nil, fmt.Errorf("LoadBalancer disappeared during the update")
 		}
 	}
 
-	return lb.Listeners[0].Address, nil
+	return lb, nil
 }
 
-func (ySvc *LoadBalancerService) GetTGsByClusterName(ctx context.Context, clusterName string) (ret []*loadbalancer.TargetGroup, err error) {
+// EnsureSharedLBListeners reconciles Listeners named with the ownerPrefix on the LB shared by multiple Services,
+// leaving Listeners of other owners intact. Returns distinct addresses of owner's Listeners.
+func (ySvc *LoadBalancerService) EnsureSharedLBListeners(ctx context.Context, folderID, name, ownerPrefix string, labels map[string]string, listenerSpec []*loadbalancer.ListenerSpec, attachedTGs []*loadbalancer.AttachedTargetGroup) ([]string, error) {
+	klog.InfoS("Getting shared LB by name", "lbName", name, "folderId", folderID)
+	lb, err := ySvc.GetLbByName(ctx, folderID, name)
+	if err != nil {
+		return nil, err
+	}
+	if lb == nil {
+		return ySvc.CreateOrUpdateLB(ctx, folderID, name, labels, listenerSpec, attachedTGs)
+	}
+
+	// unlike a dedicated LB, a shared one is never re-created, since it would disrupt other owners
+	if nlbType := getNLBType(listenerSpec); lb.Type != nlbType {
+		return nil, fmt.Errorf("shared LB %q is %s, but %s Listeners are requested", name, lb.Type, nlbType)
+	}
+
+	var ownedListeners []*loadbalancer.Listener
+	for _, listener := range lb.Listeners {
+		if strings.HasPrefix(listener.Name, ownerPrefix) {
+			ownedListeners = append(ownedListeners, listener)
+			continue
+		}
+
+		for _, spec := range listenerSpec {
+			if spec.Port == listener.Port && spec.Protocol == listener.Protocol && listenerSpecIPVersion(spec) == listenerIPVersion(listener) {
+				return nil, fmt.Errorf("%s port %d of shared LB %q is already claimed by Listener %q", spec.Protocol, spec.Port, name, listener.Name)
+			}
+		}
+	}
+
+	if err := ySvc.ensureLBLabels(ctx, lb, labels); err != nil {
+		return nil, err
+	}
+
+	// all Listeners of a shared LB of the same IP version are exposed on the same address
+	addressByIPVersion := make(map[loadbalancer.IpVersion]string)
+	for _, listener := range lb.Listeners {
+		if _, ok := addressByIPVersion[listenerIPVersion(listener)]; !ok {
+			addressByIPVersion[listenerIPVersion(listener)] = listener.Address
+		}
+	}
+	for _, spec := range listenerSpec {
+		if address, ok := addressByIPVersion[listenerSpecIPVersion(spec)]; ok {
+			setListenerAddress(spec, address)
+		}
+	}
+
+	listenersToAdd, listenersToRemove := diffListeners(listenerSpec, ownedListeners)
+	lb, err = ySvc.updateLB(ctx, folderID, lb, listenersToAdd, listenersToRemove, attachedTGs)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := ListenerAddresses(lb.Listeners, ownerPrefix)
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no Listeners of %q found on shared LB %q after update", ownerPrefix, name)
+	}
+
+	return addresses, nil
+}
+
+// RemoveSharedLBListeners removes Listeners named with the ownerPrefix from the shared LB.
+// The LB itself is removed along with its last Listener.
+func (ySvc *LoadBalancerService) RemoveSharedLBListeners(ctx context.Context, folderID, name, ownerPrefix string) error {
+	klog.InfoS("Getting shared LB by name", "lbName", name, "folderId", folderID)
+	lb, err := ySvc.GetLbByName(ctx, folderID, name)
+	if err != nil {
+		return err
+	}
+	if lb == nil {
+		klog.InfoS("Shared LB does not exist, skipping Listeners deletion", "lbName", name)
+		return nil
+	}
+
+	var ownedListeners []*loadbalancer.Listener
+	for _, listener := range lb.Listeners {
+		if strings.HasPrefix(listener.Name, ownerPrefix) {
+			ownedListeners = append(ownedListeners, listener)
+		}
+	}
+	if len(ownedListeners) == len(lb.Listeners) {
+		klog.InfoS("No Listeners of other owners left on shared LB", "lbName", name)
+		return ySvc.RemoveLBByName(ctx, folderID, name)
+	}
+
+	_, err = ySvc.updateLB(ctx, folderID, lb, nil, ownedListeners, lb.AttachedTargetGroups)
+	return err
+}
+
+func getNLBType(listenerSpec []*loadbalancer.ListenerSpec) loadbalancer.NetworkLoadBalancer_Type {
+	for _, listener := range listenerSpec {
+		if _, ok := listener.Address.(*loadbalancer.ListenerSpec_InternalAddressSpec); ok {
+			return loadbalancer.NetworkLoadBalancer_INTERNAL
+		}
+	}
+
+	return loadbalancer.NetworkLoadBalancer_EXTERNAL
+}
+
+// setListenerAddress sets the address of the Listener unless it's explicitly requested
+func setListenerAddress(spec *loadbalancer.ListenerSpec, address string) {
+	ipVersion := listenerSpecIPVersion(spec)
+
+	switch addressSpec := spec.Address.(type) {
+	case *loadbalancer.ListenerSpec_ExternalAddressSpec:
+		if len(addressSpec.ExternalAddressSpec.Address) == 0 {
+			addressSpec.ExternalAddressSpec.Address = address
+			addressSpec.ExternalAddressSpec.IpVersion = ipVersion
+		}
+	case *loadbalancer.ListenerSpec_InternalAddressSpec:
+		if len(addressSpec.InternalAddressSpec.Address) == 0 {
+			addressSpec.InternalAddressSpec.Address = address
+			addressSpec.InternalAddressSpec.IpVersion = ipVersion
+		}
+	}
+}
+
+// listenerSpecIPVersion returns the IP version requested for the Listener, IPv4 is the default one
+func listenerSpecIPVersion(spec *loadbalancer.ListenerSpec) loadbalancer.IpVersion {
+	switch addressSpec := spec.Address.(type) {
+	case *loadbalancer.ListenerSpec_ExternalAddressSpec:
+		if addressSpec.ExternalAddressSpec.IpVersion == loadbalancer.IpVersion_IPV6 {
+			return loadbalancer.IpVersion_IPV6
+		}
+	case *loadbalancer.ListenerSpec_InternalAddressSpec:
+		if addressSpec.InternalAddressSpec.IpVersion == loadbalancer.IpVersion_IPV6 {
+			return loadbalancer.IpVersion_IPV6
+		}
+	}
+
+	return loadbalancer.IpVersion_IPV4
+}
+
+// listenerIPVersion determines the IP version of the Listener by its address, since the API doesn't report it
+func listenerIPVersion(listener *loadbalancer.Listener) loadbalancer.IpVersion {
+	if ip := net.ParseIP(listener.Address); ip != nil && ip.To4() == nil {
+		return loadbalancer.IpVersion_IPV6
+	}
+
+	return loadbalancer.IpVersion_IPV4
+}
+
+// ListenerAddresses returns distinct addresses of Listeners named with the prefix, IPv4 ones first
+func ListenerAddresses(listeners []*loadbalancer.Listener, prefix string) []string {
+	var addresses []string
+	seen := make(map[string]struct{})
+	for _, ipVersion := range []loadbalancer.IpVersion{loadbalancer.IpVersion_IPV4, loadbalancer.IpVersion_IPV6} {
+		for _, listener := range listeners {
+			if !strings.HasPrefix(listener.Name, prefix) || listenerIPVersion(listener) != ipVersion {
+				continue
+			}
+			if _, ok := seen[listener.Address]; ok {
+				continue
+			}
+
+			seen[listener.Address] = struct{}{}
+			addresses = append(addresses, listener.Address)
+		}
+	}
+
+	return addresses
+}
+
+func (ySvc *LoadBalancerService) GetTGsByClusterName(ctx context.Context, folderID, clusterName string) (ret []*loadbalancer.TargetGroup, err error) {
 	result, err := ySvc.TgSvc.List(ctx, &loadbalancer.ListTargetGroupsRequest{
-		FolderId: ySvc.cloudCtx.FolderID,
+		FolderId: folderID,
 		// FIXME: properly implement iterator
 		PageSize: 1000,
 	})
@@ -205,28 +476,33 @@ func (ySvc *LoadBalancerService) GetTGsByClusterName(ctx context.Context, cluste
 	return
 }
 
-func (ySvc *LoadBalancerService) RemoveLBByName(ctx context.Context, name string) error {
-	log.Printf("Retrieving LB by name %q", name)
-	lb, err := ySvc.GetLbByName(ctx, name)
+func (ySvc *LoadBalancerService) RemoveLBByName(ctx context.Context, folderID, name string) error {
+	klog.InfoS("Retrieving LB by name", "lbName", name, "folderId", folderID)
+	lb, err := ySvc.GetLbByName(ctx, folderID, name)
 	if err != nil {
 		return err
 	}
 	if lb == nil {
-		log.Printf("LB by Name %q does not exist, skipping deletion\n", name)
+		klog.InfoS("LB does not exist, skipping deletion", "lbName", name)
 		return nil
 	}
 
+	return ySvc.RemoveLB(ctx, lb)
+}
+
+// RemoveLB deletes the LB, an LB that is already gone is not an error
+func (ySvc *LoadBalancerService) RemoveLB(ctx context.Context, lb *loadbalancer.NetworkLoadBalancer) error {
 	lbDeleteRequest := &loadbalancer.DeleteNetworkLoadBalancerRequest{
 		NetworkLoadBalancerId: lb.Id,
 	}
 
-	log.Printf("Deleting LB by ID %q", lb.Id)
-	_, _, err = ySvc.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
+	klog.InfoS("Deleting LB", "lbName", lb.Name, "lbId", lb.Id, "operation", "delete")
+	_, _, err := ySvc.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
 		return ySvc.LbSvc.Delete(ctx, lbDeleteRequest)
 	})
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
-			log.Printf("LB %q does not exist, skipping\n", name)
+			klog.InfoS("LB does not exist, skipping", "lbName", lb.Name)
 		} else {
 			return err
 		}
@@ -235,25 +511,26 @@ func (ySvc *LoadBalancerService) RemoveLBByName(ctx context.Context, name string
 	return nil
 }
 
-func (ySvc *LoadBalancerService) CreateOrUpdateTG(ctx context.Context, tgName string, targets []*loadbalancer.Target) (string, error) {
-	log.Printf("retrieving TargetGroup by name %q", tgName)
-	tg, err := ySvc.GetTgByName(ctx, tgName)
+func (ySvc *LoadBalancerService) CreateOrUpdateTG(ctx context.Context, folderID, tgName string, labels map[string]string, targets []*loadbalancer.Target) (string, error) {
+	klog.InfoS("Retrieving TargetGroup by name", "tgName", tgName, "folderId", folderID)
+	tg, err := ySvc.GetTgByName(ctx, folderID, tgName)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
-			log.Println("TG not found, creating new TG")
+			klog.InfoS("TG not found, creating new TG", "tgName", tgName)
 		} else {
 			return "", err
 		}
 	}
 	if tg == nil {
 		tgCreateRequest := &loadbalancer.CreateTargetGroupRequest{
-			FolderId: ySvc.cloudCtx.FolderID,
+			FolderId: folderID,
 			Name:     tgName,
 			RegionId: ySvc.cloudCtx.RegionID,
+			Labels:   labels,
 			Targets:  targets,
 		}
 
-		log.Printf("Creating TargetGroup: %+v", *tgCreateRequest)
+		klog.InfoS("Creating TargetGroup", "tgName", tgName, "operation", "create", "request", tgCreateRequest)
 
 		result, _, err := ySvc.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
 			return ySvc.TgSvc.Create(ctx, tgCreateRequest)
@@ -264,6 +541,10 @@ func (ySvc *LoadBalancerService) CreateOrUpdateTG(ctx context.Context, tgName st
 		return result.(*loadbalancer.TargetGroup).Id, nil
 	}
 
+	if err := ySvc.ensureTGLabels(ctx, tg, labels); err != nil {
+		return "", err
+	}
+
 	dirty := false
 
 	targetsToAdd, targetsToRemove := diffTargetGroupTargets(targets, tg.Targets)
@@ -272,7 +553,7 @@ func (ySvc *LoadBalancerService) CreateOrUpdateTG(ctx context.Context, tgName st
 			TargetGroupId: tg.Id,
 			Targets:       targetsToAdd,
 		}
-		log.Printf("Adding Targets: %+v", *req)
+		klog.InfoS("Adding Targets", "tgName", tgName, "operation", "addTargets", "request", req)
 
 		_, _, err := ySvc.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
 			return ySvc.TgSvc.AddTargets(ctx, req)
@@ -289,7 +570,7 @@ func (ySvc *LoadBalancerService) CreateOrUpdateTG(ctx context.Context, tgName st
 			TargetGroupId: tg.Id,
 			Targets:       targetsToRemove,
 		}
-		log.Printf("Removing Targets: %+v", *req)
+		klog.InfoS("Removing Targets", "tgName", tgName, "operation", "removeTargets", "request", req)
 
 		_, _, err := ySvc.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
 			return ySvc.TgSvc.RemoveTargets(ctx, req)
@@ -304,8 +585,8 @@ func (ySvc *LoadBalancerService) CreateOrUpdateTG(ctx context.Context, tgName st
 
 	// Ensure that after all manipulations with TargetGroup in the cloud it still exists.
 	if dirty {
-		log.Printf("Retrieving TargetGroup %q after update", tgName)
-		tg, err = ySvc.GetTgByName(ctx, tgName)
+		klog.InfoS("Retrieving TargetGroup after update", "tgName", tgName)
+		tg, err = ySvc.GetTgByName(ctx, folderID, tgName)
 		if err != nil {
 			return "", err
 		}
@@ -319,14 +600,14 @@ func (ySvc *LoadBalancerService) RemoveTGByID(ctx context.Context, tgId string)
 		TargetGroupId: tgId,
 	}
 
-	log.Printf("Removing TargetGroup: %+v", *tgDeleteRequest)
+	klog.InfoS("Removing TargetGroup", "tgId", tgId, "operation", "delete", "request", tgDeleteRequest)
 
 	_, _, err := ySvc.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
 		return ySvc.TgSvc.Delete(ctx, tgDeleteRequest)
 	})
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
-			log.Printf("TG by ID %q does not exist, skipping\n", tgId)
+			klog.InfoS("TG does not exist, skipping", "tgId", tgId)
 		} else {
 			return err
 		}
@@ -335,9 +616,9 @@ func (ySvc *LoadBalancerService) RemoveTGByID(ctx context.Context, tgId string)
 	return nil
 }
 
-func (ySvc *LoadBalancerService) GetLbByName(ctx context.Context, name string) (*loadbalancer.NetworkLoadBalancer, error) {
+func (ySvc *LoadBalancerService) GetLbByName(ctx context.Context, folderID, name string) (*loadbalancer.NetworkLoadBalancer, error) {
 	result, err := ySvc.LbSvc.List(ctx, &loadbalancer.ListNetworkLoadBalancersRequest{
-		FolderId: ySvc.cloudCtx.FolderID,
+		FolderId: folderID,
 		PageSize: 2,
 		Filter:   fmt.Sprintf("name = \"%s\"", name),
 	})
@@ -356,9 +637,34 @@ func (ySvc *LoadBalancerService) GetLbByName(ctx context.Context, name string) (
 	return result.NetworkLoadBalancers[0], nil
 }
 
-func (ySvc *LoadBalancerService) GetTgByName(ctx context.Context, name string) (*loadbalancer.TargetGroup, error) {
+// FindLbByLabel returns the first LB in the Folder having the label with the value
+func (ySvc *LoadBalancerService) FindLbByLabel(ctx context.Context, folderID, key, value string) (*loadbalancer.NetworkLoadBalancer, error) {
+	req := &loadbalancer.ListNetworkLoadBalancersRequest{
+		FolderId: folderID,
+		PageSize: 1000,
+	}
+	for {
+		result, err := ySvc.LbSvc.List(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, lb := range result.NetworkLoadBalancers {
+			if lb.Labels[key] == value {
+				return lb, nil
+			}
+		}
+
+		if len(result.NextPageToken) == 0 {
+			return nil, nil
+		}
+		req.PageToken = result.NextPageToken
+	}
+}
+
+func (ySvc *LoadBalancerService) GetTgByName(ctx context.Context, folderID, name string) (*loadbalancer.TargetGroup, error) {
 	result, err := ySvc.TgSvc.List(ctx, &loadbalancer.ListTargetGroupsRequest{
-		FolderId: ySvc.cloudCtx.FolderID,
+		FolderId: folderID,
 		PageSize: 2,
 		Filter:   fmt.Sprintf("name = \"%s\"", name),
 	})
@@ -377,9 +683,22 @@ func (ySvc *LoadBalancerService) GetTgByName(ctx context.Context, name string) (
 	return result.TargetGroups[0], nil
 }
 
+// GetTgByID returns the TargetGroup with the ID, or nil if it doesn't exist
+func (ySvc *LoadBalancerService) GetTgByID(ctx context.Context, tgID string) (*loadbalancer.TargetGroup, error) {
+	tg, err := ySvc.TgSvc.Get(ctx, &loadbalancer.GetTargetGroupRequest{TargetGroupId: tgID})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return tg, nil
+}
+
 func shouldRecreate(oldBalancer *loadbalancer.NetworkLoadBalancer, newBalancerSpec *loadbalancer.CreateNetworkLoadBalancerRequest) bool {
 	if newBalancerSpec.Type != oldBalancer.Type {
-		log.Println("LB type mismatch, recreating")
+		klog.InfoS("LB type mismatch, recreating", "lbName", oldBalancer.Name)
 		return true
 	}
 
@@ -448,20 +767,31 @@ func nlbListenersAreEqual(actual *loadbalancer.Listener, expected *loadbalancer.
 	if actual.TargetPort != expected.TargetPort {
 		return false
 	}
+	if listenerIPVersion(actual) != listenerSpecIPVersion(expected) {
+		return false
+	}
+	// pinning an internal Listener to another Subnet requires recreating it
+	if internal := expected.GetInternalAddressSpec(); internal != nil && actual.SubnetId != internal.SubnetId {
+		return false
+	}
 	return true
 }
 
-func diffAttachedTargetGroups(expectedTGs []*loadbalancer.AttachedTargetGroup, actualTGs []*loadbalancer.AttachedTargetGroup) (tgsToAttach []*loadbalancer.AttachedTargetGroup, tgsToDetach []*loadbalancer.AttachedTargetGroup) {
+func diffAttachedTargetGroups(expectedTGs []*loadbalancer.AttachedTargetGroup, actualTGs []*loadbalancer.AttachedTargetGroup) (tgsToAttach []*loadbalancer.AttachedTargetGroup, tgsToDetach []*loadbalancer.AttachedTargetGroup, healthChecksChanged bool) {
 	foundSet := make(map[string]bool)
 
 	for _, actual := range actualTGs {
 		found := false
 		for _, expected := range expectedTGs {
-			if nlbAttachedTargetGroupsAreEqual(actual, expected) {
-				foundSet[expected.TargetGroupId] = true
-				found = true
-				break
+			if actual.TargetGroupId != expected.TargetGroupId {
+				continue
 			}
+			if !NLBHealthChecksAreEqual(actual.HealthChecks, expected.HealthChecks) {
+				healthChecksChanged = true
+			}
+			foundSet[expected.TargetGroupId] = true
+			found = true
+			break
 		}
 		if !found {
 			tgsToDetach = append(tgsToDetach, actual)
@@ -474,19 +804,23 @@ func diffAttachedTargetGroups(expectedTGs []*loadbalancer.AttachedTargetGroup, a
 		}
 	}
 
-	return tgsToAttach, tgsToDetach
+	return tgsToAttach, tgsToDetach, healthChecksChanged
 }
 
-func nlbAttachedTargetGroupsAreEqual(actual *loadbalancer.AttachedTargetGroup, expected *loadbalancer.AttachedTargetGroup) bool {
-	if actual.TargetGroupId != expected.TargetGroupId {
+// NLBHealthChecksAreEqual reports whether health checks attached to an NLB TargetGroup match the expected ones
+func NLBHealthChecksAreEqual(actualHealthChecks []*loadbalancer.HealthCheck, expectedHealthChecks []*loadbalancer.HealthCheck) bool {
+	if len(actualHealthChecks) == 0 {
 		return false
 	}
-	if len(actual.HealthChecks) == 0 {
+	actualHealthCheck := actualHealthChecks[0]
+	expectedHealthCheck := expectedHealthChecks[0]
+	if actualHealthCheck.Name != expectedHealthCheck.Name {
 		return false
 	}
-	actualHealthCheck := actual.HealthChecks[0]
-	expectedHealthCheck := expected.HealthChecks[0]
-	if actualHealthCheck.Name != expectedHealthCheck.Name {
+	if !proto.Equal(actualHealthCheck.Interval, expectedHealthCheck.Interval) {
+		return false
+	}
+	if !proto.Equal(actualHealthCheck.Timeout, expectedHealthCheck.Timeout) {
 		return false
 	}
 	if actualHealthCheck.UnhealthyThreshold != expectedHealthCheck.UnhealthyThreshold {
@@ -495,6 +829,13 @@ func nlbAttachedTargetGroupsAreEqual(actual *loadbalancer.AttachedTargetGroup, e
 	if actualHealthCheck.HealthyThreshold != expectedHealthCheck.HealthyThreshold {
 		return false
 	}
+	if expectedHealthCheckTcpOptions := expectedHealthCheck.GetTcpOptions(); expectedHealthCheckTcpOptions != nil {
+		actualHealthCheckTcpOptions := actualHealthCheck.GetTcpOptions()
+		if actualHealthCheckTcpOptions == nil {
+			return false
+		}
+		return actualHealthCheckTcpOptions.Port == expectedHealthCheckTcpOptions.Port
+	}
 	actualHealthCheckHttpOptions := actualHealthCheck.GetHttpOptions()
 	if actualHealthCheckHttpOptions == nil {
 		return false
@@ -0,0 +1,64 @@
+package yapi
+
+import (
+	"testing"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/loadbalancer/v1"
+)
+
+func TestDiffListenersIPVersion(t *testing.T) {
+	actual := []*loadbalancer.Listener{
+		{Name: "tcp-80", Address: "203.0.113.10", Port: 80, Protocol: loadbalancer.Listener_TCP, TargetPort: 30080},
+	}
+	expected := []*loadbalancer.ListenerSpec{
+		{Name: "tcp-80", Port: 80, Protocol: loadbalancer.Listener_TCP, TargetPort: 30080,
+			Address: &loadbalancer.ListenerSpec_ExternalAddressSpec{ExternalAddressSpec: &loadbalancer.ExternalAddressSpec{}}},
+		{Name: "tcp-80-ipv6", Port: 80, Protocol: loadbalancer.Listener_TCP, TargetPort: 30080,
+			Address: &loadbalancer.ListenerSpec_ExternalAddressSpec{ExternalAddressSpec: &loadbalancer.ExternalAddressSpec{IpVersion: loadbalancer.IpVersion_IPV6}}},
+	}
+
+	toAdd, toRemove := diffListeners(expected, actual)
+	if len(toRemove) != 0 || len(toAdd) != 1 || toAdd[0].Name != "tcp-80-ipv6" {
+		t.Errorf("only the IPv6 Listener should be added, got %d to add and %d to remove", len(toAdd), len(toRemove))
+	}
+
+	actual = append(actual, &loadbalancer.Listener{Name: "tcp-80-ipv6", Address: "2001:db8::10", Port: 80, Protocol: loadbalancer.Listener_TCP, TargetPort: 30080})
+	if toAdd, toRemove = diffListeners(expected, actual); len(toAdd) != 0 || len(toRemove) != 0 {
+		t.Errorf("dual-stack Listeners should be up to date, got %d to add and %d to remove", len(toAdd), len(toRemove))
+	}
+	if addresses := ListenerAddresses(actual, ""); len(addresses) != 2 || addresses[0] != "203.0.113.10" || addresses[1] != "2001:db8::10" {
+		t.Errorf("addresses of both families should be reported, got %v", addresses)
+	}
+}
+
+func TestDiffListenersSubnet(t *testing.T) {
+	actual := []*loadbalancer.Listener{
+		{Name: "tcp-80", Address: "10.0.0.10", Port: 80, Protocol: loadbalancer.Listener_TCP, TargetPort: 30080, SubnetId: "subnet-a"},
+		{Name: "tcp-80-subnet-b", Address: "10.1.0.10", Port: 80, Protocol: loadbalancer.Listener_TCP, TargetPort: 30080, SubnetId: "subnet-b"},
+	}
+	expected := []*loadbalancer.ListenerSpec{
+		{Name: "tcp-80", Port: 80, Protocol: loadbalancer.Listener_TCP, TargetPort: 30080,
+			Address: &loadbalancer.ListenerSpec_InternalAddressSpec{InternalAddressSpec: &loadbalancer.InternalAddressSpec{SubnetId: "subnet-a"}}},
+		{Name: "tcp-80-subnet-b", Port: 80, Protocol: loadbalancer.Listener_TCP, TargetPort: 30080,
+			Address: &loadbalancer.ListenerSpec_InternalAddressSpec{InternalAddressSpec: &loadbalancer.InternalAddressSpec{SubnetId: "subnet-c"}}},
+	}
+
+	toAdd, toRemove := diffListeners(expected, actual)
+	if len(toAdd) != 1 || toAdd[0].Name != "tcp-80-subnet-b" || len(toRemove) != 1 || toRemove[0].Name != "tcp-80-subnet-b" {
+		t.Errorf("only the Listener moved to another Subnet should be rebuilt, got %d to add and %d to remove", len(toAdd), len(toRemove))
+	}
+}
+
+func TestNLBHealthChecksAreEqual(t *testing.T) {
+	httpHealthChecks := []*loadbalancer.HealthCheck{{Name: "kube-health-check",
+		Options: &loadbalancer.HealthCheck_HttpOptions_{HttpOptions: &loadbalancer.HealthCheck_HttpOptions{Port: 10256, Path: "/healthz"}}}}
+	tcpHealthChecks := []*loadbalancer.HealthCheck{{Name: "kube-health-check",
+		Options: &loadbalancer.HealthCheck_TcpOptions_{TcpOptions: &loadbalancer.HealthCheck_TcpOptions{Port: 30081}}}}
+
+	if !NLBHealthChecksAreEqual(httpHealthChecks, httpHealthChecks) || !NLBHealthChecksAreEqual(tcpHealthChecks, tcpHealthChecks) {
+		t.Errorf("identical health checks should be equal")
+	}
+	if NLBHealthChecksAreEqual(httpHealthChecks, tcpHealthChecks) || NLBHealthChecksAreEqual(tcpHealthChecks, httpHealthChecks) {
+		t.Errorf("health checks of different protocols should not be equal")
+	}
+}
@@ -1,25 +1,183 @@
 package yapi
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/operation"
 	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
 )
 
 type VPCService struct {
 	cloudCtx *CloudContext
 
-	NetworkSvc    vpc.NetworkServiceClient
-	SubnetSvc     vpc.SubnetServiceClient
-	RouteTableSvc vpc.RouteTableServiceClient
+	NetworkSvc       vpc.NetworkServiceClient
+	SubnetSvc        vpc.SubnetServiceClient
+	RouteTableSvc    RouteTableClient
+	SecurityGroupSvc vpc.SecurityGroupServiceClient
 }
 
-func NewVPCService(nSvc vpc.NetworkServiceClient, sSvc vpc.SubnetServiceClient, rtSvc vpc.RouteTableServiceClient,
-	cloudCtx *CloudContext) *VPCService {
+func NewVPCService(nSvc vpc.NetworkServiceClient, sSvc vpc.SubnetServiceClient, rtSvc RouteTableClient,
+	sgSvc vpc.SecurityGroupServiceClient, cloudCtx *CloudContext) *VPCService {
 
 	return &VPCService{
-		NetworkSvc:    nSvc,
-		SubnetSvc:     sSvc,
-		RouteTableSvc: rtSvc,
+		NetworkSvc:       nSvc,
+		SubnetSvc:        sSvc,
+		RouteTableSvc:    rtSvc,
+		SecurityGroupSvc: sgSvc,
 
 		cloudCtx: cloudCtx,
 	}
 }
+
+func (vs *VPCService) GetSecurityGroupByName(ctx context.Context, name string) (*vpc.SecurityGroup, error) {
+	result, err := vs.SecurityGroupSvc.List(ctx, &vpc.ListSecurityGroupsRequest{
+		FolderId: vs.cloudCtx.FolderID,
+		PageSize: 2,
+		Filter:   fmt.Sprintf("name = \"%s\"", name),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.SecurityGroups) > 1 {
+		return nil, fmt.Errorf("more than 1 SecurityGroups found by the name %q", name)
+	}
+	if len(result.SecurityGroups) == 0 {
+		return nil, nil
+	}
+
+	return result.SecurityGroups[0], nil
+}
+
+// CreateOrUpdateSecurityGroup ensures that the SecurityGroup exists in the Network and has exactly the provided rules
+func (vs *VPCService) CreateOrUpdateSecurityGroup(ctx context.Context, name, networkID string, ruleSpecs []*vpc.SecurityGroupRuleSpec) (string, error) {
+	klog.InfoS("Retrieving SecurityGroup by name", "sgName", name)
+	sg, err := vs.GetSecurityGroupByName(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	if sg == nil {
+		req := &vpc.CreateSecurityGroupRequest{
+			FolderId:  vs.cloudCtx.FolderID,
+			Name:      name,
+			NetworkId: networkID,
+			RuleSpecs: ruleSpecs,
+		}
+		klog.InfoS("Creating SecurityGroup", "sgName", name, "operation", "create", "request", req)
+
+		result, _, err := vs.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
+			return vs.SecurityGroupSvc.Create(ctx, req)
+		})
+		if err != nil {
+			return "", err
+		}
+
+		return result.(*vpc.SecurityGroup).Id, nil
+	}
+
+	if sg.NetworkId != networkID {
+		return "", fmt.Errorf("SecurityGroup %q belongs to Network %q instead of %q", name, sg.NetworkId, networkID)
+	}
+
+	var ruleIDs []string
+	actualRules := sets.NewString()
+	for _, rule := range sg.Rules {
+		ruleIDs = append(ruleIDs, rule.Id)
+		actualRules.Insert(securityGroupRuleFingerprint(rule.Direction, rule.ProtocolName, rule.Ports, rule.GetCidrBlocks()))
+	}
+	expectedRules := sets.NewString()
+	for _, spec := range ruleSpecs {
+		expectedRules.Insert(securityGroupRuleFingerprint(spec.Direction, spec.GetProtocolName(), spec.Ports, spec.GetCidrBlocks()))
+	}
+	if actualRules.Equal(expectedRules) {
+		return sg.Id, nil
+	}
+
+	req := &vpc.UpdateSecurityGroupRulesRequest{
+		SecurityGroupId:   sg.Id,
+		DeletionRuleIds:   ruleIDs,
+		AdditionRuleSpecs: ruleSpecs,
+	}
+	klog.InfoS("Updating SecurityGroup rules", "sgName", name, "operation", "updateRules", "request", req)
+
+	_, _, err = vs.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
+		return vs.SecurityGroupSvc.UpdateRules(ctx, req)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return sg.Id, nil
+}
+
+func (vs *VPCService) RemoveSecurityGroupByID(ctx context.Context, sgID string) error {
+	req := &vpc.DeleteSecurityGroupRequest{
+		SecurityGroupId: sgID,
+	}
+	klog.InfoS("Removing SecurityGroup", "sgId", sgID, "operation", "delete")
+
+	_, _, err := vs.cloudCtx.OperationWaiter(ctx, func() (*operation.Operation, error) {
+		return vs.SecurityGroupSvc.Delete(ctx, req)
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			klog.InfoS("SecurityGroup does not exist, skipping", "sgId", sgID)
+		} else {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func securityGroupRuleFingerprint(direction vpc.SecurityGroupRule_Direction, protocol string, ports *vpc.PortRange, cidrBlocks *vpc.CidrBlocks) string {
+	var fromPort, toPort int64
+	if ports != nil {
+		fromPort, toPort = ports.FromPort, ports.ToPort
+	}
+
+	var v4CidrBlocks, v6CidrBlocks []string
+	if cidrBlocks != nil {
+		v4CidrBlocks = sets.NewString(cidrBlocks.V4CidrBlocks...).List()
+		v6CidrBlocks = sets.NewString(cidrBlocks.V6CidrBlocks...).List()
+	}
+
+	return fmt.Sprintf("%s/%s/%d-%d/%s/%s", direction, strings.ToUpper(protocol), fromPort, toPort,
+		strings.Join(v4CidrBlocks, ","), strings.Join(v6CidrBlocks, ","))
+}
+
+// Ping makes a cheap authenticated call to check that the API is reachable and Credentials are valid
+func (vs *VPCService) Ping(ctx context.Context) error {
+	_, err := vs.NetworkSvc.List(ctx, &vpc.ListNetworksRequest{
+		FolderId: vs.cloudCtx.FolderID,
+		PageSize: 1,
+	})
+
+	return err
+}
+
+// ListNetworkSubnets returns all Subnets of the Network
+func (vs *VPCService) ListNetworkSubnets(ctx context.Context, networkID string) ([]*vpc.Subnet, error) {
+	var subnets []*vpc.Subnet
+	req := &vpc.ListNetworkSubnetsRequest{NetworkId: networkID}
+	for {
+		result, err := vs.NetworkSvc.ListSubnets(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		subnets = append(subnets, result.Subnets...)
+
+		if len(result.NextPageToken) == 0 {
+			return subnets, nil
+		}
+		req.PageToken = result.NextPageToken
+	}
+}
@@ -0,0 +1,75 @@
+package yapi
+
+import (
+	"context"
+	"testing"
+
+	//nolint:staticcheck // Ignore SA1019. Need to keep deprecated package for compatibility.
+	"github.com/golang/protobuf/proto"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/operation"
+	"github.com/yandex-cloud/go-genproto/yandex/cloud/vpc/v1"
+	ycsdkoperation "github.com/yandex-cloud/go-sdk/operation"
+	"google.golang.org/grpc"
+)
+
+// fakeSecurityGroupClient lists a single SecurityGroup and records rule updates
+type fakeSecurityGroupClient struct {
+	vpc.SecurityGroupServiceClient
+	sg      *vpc.SecurityGroup
+	updates []*vpc.UpdateSecurityGroupRulesRequest
+}
+
+func (c *fakeSecurityGroupClient) List(_ context.Context, _ *vpc.ListSecurityGroupsRequest, _ ...grpc.CallOption) (*vpc.ListSecurityGroupsResponse, error) {
+	return &vpc.ListSecurityGroupsResponse{SecurityGroups: []*vpc.SecurityGroup{c.sg}}, nil
+}
+
+func (c *fakeSecurityGroupClient) UpdateRules(_ context.Context, in *vpc.UpdateSecurityGroupRulesRequest, _ ...grpc.CallOption) (*operation.Operation, error) {
+	c.updates = append(c.updates, in)
+	return &operation.Operation{Done: true}, nil
+}
+
+func completedOperationWaiter(_ context.Context, origFunc func() (*operation.Operation, error)) (proto.Message, *ycsdkoperation.Operation, error) {
+	_, err := origFunc()
+	return nil, nil, err
+}
+
+func TestCreateOrUpdateSecurityGroupV6CidrBlocks(t *testing.T) {
+	ports := &vpc.PortRange{FromPort: 30080, ToPort: 30080}
+	sgClient := &fakeSecurityGroupClient{sg: &vpc.SecurityGroup{Id: "sg1", Name: "sg", NetworkId: "network", Rules: []*vpc.SecurityGroupRule{{
+		Id:           "rule1",
+		Direction:    vpc.SecurityGroupRule_INGRESS,
+		ProtocolName: "TCP",
+		Ports:        ports,
+		Target: &vpc.SecurityGroupRule_CidrBlocks{CidrBlocks: &vpc.CidrBlocks{
+			V4CidrBlocks: []string{"203.0.113.0/24"},
+			V6CidrBlocks: []string{"::/0"},
+		}},
+	}}}}
+	vs := NewVPCService(nil, nil, nil, sgClient, &CloudContext{OperationWaiter: completedOperationWaiter})
+
+	ruleSpec := func(v6CidrBlocks ...string) []*vpc.SecurityGroupRuleSpec {
+		return []*vpc.SecurityGroupRuleSpec{{
+			Direction: vpc.SecurityGroupRule_INGRESS,
+			Protocol:  &vpc.SecurityGroupRuleSpec_ProtocolName{ProtocolName: "TCP"},
+			Ports:     ports,
+			Target: &vpc.SecurityGroupRuleSpec_CidrBlocks{CidrBlocks: &vpc.CidrBlocks{
+				V4CidrBlocks: []string{"203.0.113.0/24"},
+				V6CidrBlocks: v6CidrBlocks,
+			}},
+		}}
+	}
+
+	if _, err := vs.CreateOrUpdateSecurityGroup(context.Background(), "sg", "network", ruleSpec("::/0")); err != nil {
+		t.Fatal(err)
+	}
+	if len(sgClient.updates) != 0 {
+		t.Fatalf("unchanged rules should not be updated, got %d updates", len(sgClient.updates))
+	}
+
+	if _, err := vs.CreateOrUpdateSecurityGroup(context.Background(), "sg", "network", ruleSpec("2001:db8::/32")); err != nil {
+		t.Fatal(err)
+	}
+	if len(sgClient.updates) != 1 || sgClient.updates[0].AdditionRuleSpecs[0].GetCidrBlocks().V6CidrBlocks[0] != "2001:db8::/32" {
+		t.Errorf("narrowed IPv6 ranges should be applied, got %v", sgClient.updates)
+	}
+}